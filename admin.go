@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"merge-hotel/cache"
+	"merge-hotel/entity"
+	"merge-hotel/override"
+	"merge-hotel/suppress"
+)
+
+const (
+	// ErrUnauthorized is returned when the admin token is missing or invalid.
+	ErrUnauthorized = "Unauthorized. A valid admin token is required."
+	// ErrHotelNotCached is returned when the hotel to evict is not in the cache.
+	ErrHotelNotCached = "Hotel not found in cache."
+	// ErrWarmUpFailed is returned when the cache warm-up fails.
+	ErrWarmUpFailed = "Failed to warm up cache. Please try again later."
+	// ErrInvalidOverride is returned when the body of an override is not valid JSON.
+	ErrInvalidOverride = "Invalid override. The body must be a JSON object with hotel_id, field, op and value."
+	// ErrOverrideNotFound is returned when the override to delete does not exist.
+	ErrOverrideNotFound = "Override not found."
+	// ErrOverrideNotSaved is returned when the overrides cannot be saved.
+	ErrOverrideNotSaved = "Failed to save overrides. Please try again later."
+)
+
+type AdminUsecase interface {
+	Usecase
+	// CachedHotels returns a snapshot of the hotels in the cache and the cache statistics.
+	CachedHotels() ([]cache.Item[string, entity.Hotel], cache.Stats)
+	// EvictHotel removes a hotel from the cache. It reports whether the hotel was cached.
+	EvictHotel(hotelID string) bool
+	// EvictDestination removes all the hotels of a destination from the cache and returns how many were removed.
+	EvictDestination(destinationID int) int
+	// EvictSupplier removes all the hotels that a supplier contributed to from the cache and returns how many were removed.
+	EvictSupplier(supplierName string) int
+	// FlushCache removes all the hotels from the cache.
+	FlushCache()
+	// WarmUp pre-populates the cache with all the hotels known to the suppliers and returns how many were cached.
+	WarmUp(ctx context.Context) (int, error)
+	// Overrides returns the overrides of a hotel, or all the overrides if hotelID is empty.
+	Overrides(hotelID string) []override.Override
+	// AddOverride stores an override and returns it with its ID. The error wraps override.ErrInvalid if the
+	// override cannot be applied.
+	AddOverride(o override.Override) (override.Override, error)
+	// DeleteOverride removes an override. It reports whether the override existed.
+	DeleteOverride(id string) (bool, error)
+}
+
+type AdminHandler struct {
+	hotelService AdminUsecase
+}
+
+func NewAdminHandler(hotels AdminUsecase) *AdminHandler {
+	return &AdminHandler{
+		hotelService: hotels,
+	}
+}
+
+// CachedHotel is the admin view of a cached hotel.
+type CachedHotel struct {
+	HotelID       string   `json:"hotel_id"`
+	DestinationID int      `json:"destination_id"`
+	Suppliers     []string `json:"suppliers"`
+	Overrides     []string `json:"overrides,omitempty"` // IDs of the overrides applied to the hotel
+	AgeSeconds    float64  `json:"age_seconds"`
+	TTLSeconds    float64  `json:"ttl_seconds"` // remaining time before the hotel expires, -1 if it never expires
+}
+
+// RequireToken returns a middleware that only lets through requests with the given bearer token.
+func RequireToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		// compare in constant time so that the token cannot be guessed from response times
+		if !found || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			abortWithProblem(c, http.StatusUnauthorized, CodeUnauthorized, ErrUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ListCache lists the cached hotels with their age and remaining TTL.
+func (h *AdminHandler) ListCache(c *gin.Context) {
+	items, stats := h.hotelService.CachedHotels()
+
+	now := time.Now()
+	hotels := make([]CachedHotel, len(items))
+	for i, item := range items {
+		ttl := -1.0
+		if !item.ExpiresAt.IsZero() {
+			ttl = item.ExpiresAt.Sub(now).Seconds()
+		}
+		hotels[i] = CachedHotel{
+			HotelID:       item.Key,
+			DestinationID: item.Value.DestinationID,
+			Suppliers:     item.Value.Provenance.Suppliers,
+			Overrides:     item.Value.Provenance.Overrides,
+			AgeSeconds:    now.Sub(item.CreatedAt).Seconds(),
+			TTLSeconds:    ttl,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stats": stats, "hotels": hotels})
+}
+
+// EvictHotel evicts a single hotel from the cache.
+func (h *AdminHandler) EvictHotel(c *gin.Context) {
+	if !h.hotelService.EvictHotel(c.Param("id")) {
+		abortWithProblem(c, http.StatusNotFound, CodeNotFound, ErrHotelNotCached)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"evicted": 1})
+}
+
+// EvictDestination evicts all the hotels of a destination from the cache.
+func (h *AdminHandler) EvictDestination(c *gin.Context) {
+	destinationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || destinationID < 0 {
+		abortWithInvalidParam(c, "id", ErrInvalidDestinationID)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"evicted": h.hotelService.EvictDestination(destinationID)})
+}
+
+// EvictSupplier evicts all the hotels that a supplier contributed to from the cache.
+func (h *AdminHandler) EvictSupplier(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"evicted": h.hotelService.EvictSupplier(c.Param("name"))})
+}
+
+// FlushCache evicts every hotel from the cache.
+func (h *AdminHandler) FlushCache(c *gin.Context) {
+	h.hotelService.FlushCache()
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
+
+// WarmUp pre-populates the cache for all known hotel IDs.
+func (h *AdminHandler) WarmUp(c *gin.Context) {
+	cached, err := h.hotelService.WarmUp(c)
+	if err != nil {
+		abortWithProblem(c, http.StatusInternalServerError, CodeInternalError, ErrWarmUpFailed)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cached": cached})
+}
+
+// ListOverrides lists the overrides in the order they are applied in, only those of a hotel if the hotel
+// query parameter is set.
+func (h *AdminHandler) ListOverrides(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"overrides": h.hotelService.Overrides(c.Query("hotel"))})
+}
+
+// AddOverride adds an override. It applies to the hotel from the next search, after the data of the suppliers is merged.
+func (h *AdminHandler) AddOverride(c *gin.Context) {
+	var o override.Override
+	if err := c.ShouldBindJSON(&o); err != nil {
+		abortWithProblem(c, http.StatusBadRequest, CodeInvalidBody, ErrInvalidOverride)
+		return
+	}
+	added, err := h.hotelService.AddOverride(o)
+	if errors.Is(err, override.ErrInvalid) {
+		abortWithProblem(c, http.StatusBadRequest, CodeInvalidBody, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save overrides")
+		abortWithProblem(c, http.StatusInternalServerError, CodeInternalError, ErrOverrideNotSaved)
+		return
+	}
+	c.JSON(http.StatusCreated, added)
+}
+
+// DeleteOverride deletes an override, which no longer applies from the next search.
+func (h *AdminHandler) DeleteOverride(c *gin.Context) {
+	deleted, err := h.hotelService.DeleteOverride(c.Param("id"))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save overrides")
+		abortWithProblem(c, http.StatusInternalServerError, CodeInternalError, ErrOverrideNotSaved)
+		return
+	}
+	if !deleted {
+		abortWithProblem(c, http.StatusNotFound, CodeNotFound, ErrOverrideNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": 1})
+}
+
+// ListSuppressions runs the search of the query parameters, like GET /hotels, and lists the hotels, images and
+// amenities that the suppression rules removed from its result.
+func (h *AdminHandler) ListSuppressions(c *gin.Context) {
+	hotelIDs, destinationID, ok := parseSearch(c)
+	if !ok {
+		return
+	}
+	result, err := h.hotelService.GetHotels(c, hotelIDs, destinationID)
+	if err != nil {
+		abortWithProblem(c, http.StatusInternalServerError, CodeInternalError, ErrInternalServerError)
+		return
+	}
+	suppressed := result.Suppressed
+	if suppressed == nil {
+		suppressed = []suppress.Suppression{}
+	}
+	c.JSON(http.StatusOK, gin.H{"suppressed": suppressed})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"merge-hotel/override"
+	"merge-hotel/suppress"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/gin-gonic/gin"
+)
+
+const adminToken = "s3cret"
+
+// newAdminRouter routes the admin endpoints to the handler of the usecase, like main does.
+func newAdminRouter(usecase AdminUsecase) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	handler := NewAdminHandler(usecase)
+	router := gin.New()
+	admin := router.Group("/admin", RequireToken(adminToken))
+	admin.GET("/cache", handler.ListCache)
+	admin.DELETE("/cache", handler.FlushCache)
+	admin.DELETE("/cache/hotels/:id", handler.EvictHotel)
+	admin.DELETE("/cache/destinations/:id", handler.EvictDestination)
+	admin.DELETE("/cache/suppliers/:name", handler.EvictSupplier)
+	admin.POST("/cache/warmup", handler.WarmUp)
+	admin.GET("/overrides", handler.ListOverrides)
+	admin.POST("/overrides", handler.AddOverride)
+	admin.DELETE("/overrides/:id", handler.DeleteOverride)
+	admin.GET("/suppressions", handler.ListSuppressions)
+	return router
+}
+
+// serveAdmin sends an admin request with the token, and decodes the JSON response into v if it is not nil.
+func serveAdmin(t *testing.T, router *gin.Engine, method, target, body string, status int, v any) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	testutil.Equals(t, status, rec.Code, rec.Body.String())
+	if v != nil {
+		testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), v))
+	}
+}
+
+// cachedHotelIDs lists the IDs of the hotels in the cache, through the admin API.
+func cachedHotelIDs(t *testing.T, router *gin.Engine) []string {
+	t.Helper()
+	var listed struct {
+		Hotels []CachedHotel `json:"hotels"`
+	}
+	serveAdmin(t, router, http.MethodGet, "/admin/cache", "", http.StatusOK, &listed)
+	var ids []string
+	for _, hotel := range listed.Hotels {
+		ids = append(ids, hotel.HotelID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestRequireToken(t *testing.T) {
+	router := newAdminRouter(newFixtureUsecase(t))
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{name: "missing token", status: http.StatusUnauthorized},
+		{name: "wrong token", authorization: "Bearer " + adminToken + "x", status: http.StatusUnauthorized},
+		{name: "prefix of the token", authorization: "Bearer " + adminToken[:3], status: http.StatusUnauthorized},
+		{name: "not a bearer token", authorization: adminToken, status: http.StatusUnauthorized},
+		{name: "valid token", authorization: "Bearer " + adminToken, status: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/admin/cache", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			testutil.Equals(t, tc.status, rec.Code)
+			if tc.status == http.StatusUnauthorized {
+				testutil.Equals(t, ProblemContentType, rec.Header().Get("Content-Type"))
+				var problem Problem
+				testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+				testutil.Equals(t, CodeUnauthorized, problem.Code)
+			}
+		})
+	}
+}
+
+func TestAdminWarmUpAndFlush(t *testing.T) {
+	router := newAdminRouter(newFixtureUsecase(t))
+	testutil.Equals(t, []string(nil), cachedHotelIDs(t, router))
+
+	var warmed struct {
+		Cached int `json:"cached"`
+	}
+	serveAdmin(t, router, http.MethodPost, "/admin/cache/warmup", "", http.StatusOK, &warmed)
+	testutil.Equals(t, 3, warmed.Cached)
+	testutil.Equals(t, []string{"SjyX", "f8c9", "iJhz"}, cachedHotelIDs(t, router))
+
+	serveAdmin(t, router, http.MethodDelete, "/admin/cache", "", http.StatusOK, nil)
+	testutil.Equals(t, []string(nil), cachedHotelIDs(t, router))
+}
+
+func TestAdminEvict(t *testing.T) {
+	type evicted struct {
+		Evicted int `json:"evicted"`
+	}
+	for _, tc := range []struct {
+		name      string
+		target    string
+		evicted   int
+		remaining []string
+	}{
+		{name: "hotel", target: "/admin/cache/hotels/iJhz", evicted: 1, remaining: []string{"SjyX", "f8c9"}},
+		{name: "destination", target: "/admin/cache/destinations/5432", evicted: 2, remaining: []string{"f8c9"}},
+		{name: "unknown destination", target: "/admin/cache/destinations/1", remaining: []string{"SjyX", "f8c9", "iJhz"}},
+		{name: "unknown supplier", target: "/admin/cache/suppliers/Unknown", remaining: []string{"SjyX", "f8c9", "iJhz"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			router := newAdminRouter(newFixtureUsecase(t))
+			serveAdmin(t, router, http.MethodPost, "/admin/cache/warmup", "", http.StatusOK, nil)
+
+			var got evicted
+			serveAdmin(t, router, http.MethodDelete, tc.target, "", http.StatusOK, &got)
+			testutil.Equals(t, tc.evicted, got.Evicted)
+			testutil.Equals(t, tc.remaining, cachedHotelIDs(t, router))
+		})
+	}
+
+	t.Run("supplier", func(t *testing.T) {
+		usecase := newFixtureUsecase(t)
+		router := newAdminRouter(usecase)
+		serveAdmin(t, router, http.MethodPost, "/admin/cache/warmup", "", http.StatusOK, nil)
+		items, _ := usecase.CachedHotels()
+		var contributed, others []string
+		for _, item := range items {
+			if slices.Contains(item.Value.Provenance.Suppliers, "Paperflies") {
+				contributed = append(contributed, item.Key)
+			} else {
+				others = append(others, item.Key)
+			}
+		}
+		slices.Sort(others)
+		testutil.Assert(t, len(contributed) > 0, "expected Paperflies to contribute to the cached hotels")
+
+		var got evicted
+		serveAdmin(t, router, http.MethodDelete, "/admin/cache/suppliers/Paperflies", "", http.StatusOK, &got)
+		testutil.Equals(t, len(contributed), got.Evicted)
+		testutil.Equals(t, others, cachedHotelIDs(t, router))
+	})
+
+	t.Run("hotel not cached", func(t *testing.T) {
+		router := newAdminRouter(newFixtureUsecase(t))
+		serveAdmin(t, router, http.MethodDelete, "/admin/cache/hotels/iJhz", "", http.StatusNotFound, nil)
+	})
+
+	t.Run("invalid destination", func(t *testing.T) {
+		router := newAdminRouter(newFixtureUsecase(t))
+		serveAdmin(t, router, http.MethodDelete, "/admin/cache/destinations/-1", "", http.StatusBadRequest, nil)
+	})
+}
+
+func TestAdminOverrides(t *testing.T) {
+	router := newAdminRouter(newFixtureUsecase(t))
+	serveAdmin(t, router, http.MethodPost, "/admin/cache/warmup", "", http.StatusOK, nil)
+
+	serveAdmin(t, router, http.MethodPost, "/admin/overrides", `{"hotel_id": "iJhz"`, http.StatusBadRequest, nil)
+	serveAdmin(t, router, http.MethodPost, "/admin/overrides", `{"hotel_id": "iJhz", "field": "stars", "op": "replace", "value": 5}`, http.StatusBadRequest, nil)
+
+	// adding an override evicts its hotel, so that the next search applies it
+	var added override.Override
+	serveAdmin(t, router, http.MethodPost, "/admin/overrides", `{"hotel_id": "iJhz", "field": "name", "op": "replace", "value": "Villas"}`, http.StatusCreated, &added)
+	testutil.Assert(t, added.ID != "", "expected the override to have an ID")
+	testutil.Equals(t, []string{"SjyX", "f8c9"}, cachedHotelIDs(t, router))
+
+	var listed struct {
+		Overrides []override.Override `json:"overrides"`
+	}
+	serveAdmin(t, router, http.MethodGet, "/admin/overrides?hotel=iJhz", "", http.StatusOK, &listed)
+	testutil.Equals(t, 1, len(listed.Overrides))
+	testutil.Equals(t, added.ID, listed.Overrides[0].ID)
+
+	serveAdmin(t, router, http.MethodDelete, "/admin/overrides/"+added.ID, "", http.StatusOK, nil)
+	serveAdmin(t, router, http.MethodDelete, "/admin/overrides/"+added.ID, "", http.StatusNotFound, nil)
+	serveAdmin(t, router, http.MethodGet, "/admin/overrides", "", http.StatusOK, &listed)
+	testutil.Equals(t, 0, len(listed.Overrides))
+}
+
+func TestAdminListSuppressions(t *testing.T) {
+	rules, err := suppress.NewRuleSet([]suppress.Rule{{Reason: "closed", HotelIDs: []string{"SjyX"}}})
+	testutil.Ok(t, err)
+	usecase := newFixtureUsecase(t, fixtureSetup{opts: UsecaseOptions{Suppression: rules}})
+	router := newAdminRouter(usecase)
+
+	var listed struct {
+		Suppressed []suppress.Suppression `json:"suppressed"`
+	}
+	serveAdmin(t, router, http.MethodGet, "/admin/suppressions?hotels=SjyX,iJhz", "", http.StatusOK, &listed)
+	testutil.Equals(t, []suppress.Suppression{{HotelID: "SjyX", Kind: suppress.Hotel, Reason: "closed"}}, listed.Suppressed)
+
+	serveAdmin(t, router, http.MethodGet, "/admin/suppressions?hotels=iJhz", "", http.StatusOK, &listed)
+	testutil.Equals(t, []suppress.Suppression{}, listed.Suppressed)
+
+	result, err := usecase.GetHotels(context.Background(), []string{"SjyX"}, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(result.Hotels))
+}
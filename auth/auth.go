@@ -0,0 +1,345 @@
+// Package auth authenticates the requests to the supplier APIs. The credentials are wrapped in Secret,
+// which is redacted whenever it is printed or logged.
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+)
+
+// Scheme is the way the requests to a supplier are authenticated.
+type Scheme string
+
+const (
+	// None sends the requests as they are.
+	None Scheme = "none"
+	// APIKey sends the secret in a header, or in a query parameter.
+	APIKey Scheme = "api_key"
+	// Basic sends the username and the secret with HTTP basic authentication.
+	Basic Scheme = "basic"
+	// Bearer sends the secret as a static bearer token.
+	Bearer Scheme = "bearer"
+	// OAuth2 sends a bearer token obtained with the OAuth2 client-credentials grant, the secret being the client secret.
+	OAuth2 Scheme = "oauth2"
+	// HMAC signs the requests with HMAC-SHA256, the secret being the signing key.
+	HMAC Scheme = "hmac"
+)
+
+// ParseScheme returns the scheme with the given name. An empty name means None.
+func ParseScheme(name string) (Scheme, error) {
+	switch scheme := Scheme(name); scheme {
+	case "":
+		return None, nil
+	case None, APIKey, Basic, Bearer, OAuth2, HMAC:
+		return scheme, nil
+	default:
+		return "", fmt.Errorf("unknown auth type %q, must be one of none, api_key, basic, bearer, oauth2 or hmac", name)
+	}
+}
+
+const (
+	// DefaultAPIKeyHeader is the header of the API key if neither a header nor a query parameter is configured.
+	DefaultAPIKeyHeader = "X-API-Key"
+	// DefaultSignatureHeader is the header of the HMAC signature if no header is configured.
+	DefaultSignatureHeader = "X-Signature"
+	// TimestampHeader is the header of the Unix time at which a request was signed.
+	TimestampHeader = "X-Timestamp"
+	// MaxSignatureAge is how far the time a request was signed at can be from the time it is verified at,
+	// so that a captured request cannot be replayed later.
+	MaxSignatureAge = 5 * time.Minute
+)
+
+// Secret is a credential. It is redacted when printed, logged or marshalled, use Reveal to get its value.
+type Secret string
+
+const redacted = "[REDACTED]"
+
+// String implements fmt.Stringer, redacting the secret.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString implements fmt.GoStringer, redacting the secret.
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+// MarshalText implements encoding.TextMarshaler, redacting the secret in JSON and YAML.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Reveal returns the value of the secret.
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// LoadSecret reads a secret from the environment variable env, or else from the file at path.
+// The surrounding whitespace of a file is trimmed, as secret files usually end with a newline.
+func LoadSecret(env, path string) (Secret, error) {
+	var value string
+	switch {
+	case env != "":
+		var ok bool
+		if value, ok = os.LookupEnv(env); !ok {
+			return "", fmt.Errorf("environment variable %s is not set", env)
+		}
+	case path != "":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		value = strings.TrimSpace(string(data))
+	default:
+		return "", errors.New("no secret source")
+	}
+	if value == "" {
+		return "", errors.New("the secret is empty")
+	}
+	return Secret(value), nil
+}
+
+// Options configure how the requests are authenticated.
+type Options struct {
+	Scheme Scheme
+	// Header is the header of the API key or of the HMAC signature.
+	Header string
+	// Param is the query parameter of the API key, used instead of a header if set.
+	Param string
+	// Username is the username of basic authentication.
+	Username string
+	// Secret is the API key, password, bearer token, OAuth2 client secret or HMAC key, depending on the scheme.
+	Secret Secret
+	// TokenURL, ClientID and Scopes configure the OAuth2 client-credentials grant.
+	TokenURL string
+	ClientID string
+	Scopes   []string
+}
+
+// Transport is an http.RoundTripper that authenticates the requests before sending them with the wrapped transport.
+// The requests are cloned, so the credentials never appear in the requests of the caller, e.g. in its errors.
+type Transport struct {
+	opts Options
+	next http.RoundTripper
+	now  func() time.Time
+
+	mu     sync.Mutex // guards the OAuth2 token, and serialises its refreshes
+	token  string
+	expiry time.Time
+}
+
+// NewTransport creates a Transport that wraps next. It returns next itself if the scheme is None.
+func NewTransport(opts Options, next http.RoundTripper) http.RoundTripper {
+	if opts.Scheme == None || opts.Scheme == "" {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Transport{opts: opts, next: next, now: time.Now}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	authed, err := t.authenticate(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.next.RoundTrip(authed)
+	if err != nil || res.StatusCode != http.StatusUnauthorized || t.opts.Scheme != OAuth2 {
+		return res, err
+	}
+
+	// the token was revoked or expired early, so fetch a new one and retry once if the body can be sent again
+	t.invalidate(authed.Header.Get("Authorization"))
+	retry := req
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return res, nil
+		}
+		retry = req.Clone(req.Context())
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if authed, err = t.authenticate(retry); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(authed)
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport, if it supports it.
+func (t *Transport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// authenticate returns a copy of the request with the credentials of the scheme.
+func (t *Transport) authenticate(req *http.Request) (*http.Request, error) {
+	authed := req.Clone(req.Context())
+	switch t.opts.Scheme {
+	case APIKey:
+		if t.opts.Param != "" {
+			query := authed.URL.Query()
+			query.Set(t.opts.Param, t.opts.Secret.Reveal())
+			authed.URL.RawQuery = query.Encode()
+			break
+		}
+		authed.Header.Set(headerOrDefault(t.opts.Header, DefaultAPIKeyHeader), t.opts.Secret.Reveal())
+	case Basic:
+		authed.SetBasicAuth(t.opts.Username, t.opts.Secret.Reveal())
+	case Bearer:
+		authed.Header.Set("Authorization", "Bearer "+t.opts.Secret.Reveal())
+	case OAuth2:
+		token, err := t.accessToken(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("oauth2 token: %w", err)
+		}
+		authed.Header.Set("Authorization", "Bearer "+token)
+	case HMAC:
+		if err := t.sign(authed); err != nil {
+			return nil, fmt.Errorf("sign request: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown auth type %q", t.opts.Scheme)
+	}
+	return authed, nil
+}
+
+// tokenExpiryMargin is how long before its expiry a token is refreshed, so that it does not expire in flight.
+const tokenExpiryMargin = 30 * time.Second
+
+// tokenResponse is the response of the token endpoint of an OAuth2 server.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// ExpiresIn is the lifetime of the token in seconds. Zero means that the lifetime is unknown,
+	// in which case the token is used until the supplier rejects it.
+	ExpiresIn int `json:"expires_in"`
+}
+
+// accessToken returns the cached OAuth2 token, fetching a new one if there is none or it is about to expire.
+// The lock is held while fetching, so that concurrent requests wait for a single token.
+func (t *Transport) accessToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && (t.expiry.IsZero() || t.now().Before(t.expiry)) {
+		return t.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(t.opts.Scopes) > 0 {
+		form.Set("scope", strings.Join(t.opts.Scopes, " "))
+	}
+	var res tokenResponse
+	err := requests.URL(t.opts.TokenURL).
+		Transport(t.next).
+		BasicAuth(t.opts.ClientID, t.opts.Secret.Reveal()).
+		BodyForm(form).
+		Accept("application/json").
+		ToJSON(&res).
+		Fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	if res.AccessToken == "" {
+		return "", errors.New("no access_token in the token response")
+	}
+	if res.TokenType != "" && !strings.EqualFold(res.TokenType, "bearer") {
+		return "", fmt.Errorf("unsupported token type %q", res.TokenType)
+	}
+
+	t.token, t.expiry = res.AccessToken, time.Time{}
+	if res.ExpiresIn > 0 {
+		lifetime := time.Duration(res.ExpiresIn) * time.Second
+		// refresh short-lived tokens halfway through their lifetime
+		t.expiry = t.now().Add(lifetime - min(tokenExpiryMargin, lifetime/2))
+	}
+	return t.token, nil
+}
+
+// invalidate drops the cached token if it is the one of the rejected authorization,
+// so that a token refreshed by a concurrent request is kept.
+func (t *Transport) invalidate(authorization string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if authorization == "Bearer "+t.token {
+		t.token = ""
+	}
+}
+
+// sign adds the HMAC-SHA256 signature of the request and the time it was signed at. The signed string is
+// the method, the path and query, the Unix time and the hex SHA-256 of the body, separated by newlines.
+func (t *Transport) sign(req *http.Request) error {
+	body := []byte{}
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	timestamp := strconv.FormatInt(t.now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(headerOrDefault(t.opts.Header, DefaultSignatureHeader), Signature(t.opts.Secret, req.Method, req.URL.RequestURI(), timestamp, body))
+	return nil
+}
+
+// Signature returns the hex HMAC-SHA256 signature of a request, as sent by the HMAC scheme.
+// Suppliers and test servers can use it to verify the requests.
+func Signature(key Secret, method, requestURI, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(key.Reveal()))
+	mac.Write([]byte(method + "\n" + requestURI + "\n" + timestamp + "\n" + hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature of a request signed with the HMAC scheme at the Unix time timestamp,
+// and that it was signed within MaxSignatureAge of now.
+func VerifySignature(key Secret, method, requestURI, timestamp string, body []byte, signature string, now time.Time) error {
+	if signature == "" || timestamp == "" {
+		return errors.New("missing signature or timestamp")
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > MaxSignatureAge || age < -MaxSignatureAge {
+		return fmt.Errorf("timestamp %s is more than %s away from the current time", timestamp, MaxSignatureAge)
+	}
+	expected := Signature(key, method, requestURI, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// headerOrDefault returns header, or def if it is empty.
+func headerOrDefault(header, def string) string {
+	if header == "" {
+		return def
+	}
+	return header
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestParseScheme(t *testing.T) {
+	scheme, err := ParseScheme("")
+	testutil.Ok(t, err)
+	testutil.Equals(t, None, scheme)
+	scheme, err = ParseScheme("oauth2")
+	testutil.Ok(t, err)
+	testutil.Equals(t, OAuth2, scheme)
+	_, err = ParseScheme("digest")
+	testutil.NotOk(t, err)
+}
+
+func TestSecretIsRedacted(t *testing.T) {
+	secret := Secret("s3cret")
+	data, err := json.Marshal(struct{ Key Secret }{secret})
+	testutil.Ok(t, err)
+	for _, printed := range []string{secret.String(), fmt.Sprint(secret), fmt.Sprintf("%#v", secret), fmt.Sprintf("%+v", struct{ Key Secret }{secret}), string(data)} {
+		testutil.Assert(t, !strings.Contains(printed, "s3cret"), "secret leaked in %q", printed)
+	}
+	testutil.Equals(t, "s3cret", secret.Reveal())
+	testutil.Equals(t, "", Secret("").String())
+}
+
+func TestLoadSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	testutil.Ok(t, os.WriteFile(path, []byte("from-file\n"), 0o600))
+	t.Setenv("AUTH_TEST_SECRET", "from-env")
+
+	secret, err := LoadSecret("AUTH_TEST_SECRET", "")
+	testutil.Ok(t, err)
+	testutil.Equals(t, Secret("from-env"), secret)
+	secret, err = LoadSecret("", path)
+	testutil.Ok(t, err)
+	testutil.Equals(t, Secret("from-file"), secret)
+
+	_, err = LoadSecret("AUTH_TEST_UNSET", "")
+	testutil.NotOk(t, err)
+	_, err = LoadSecret("", filepath.Join(t.TempDir(), "missing"))
+	testutil.NotOk(t, err)
+}
+
+func TestTransportAuthenticates(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		opts   Options
+		verify func(t *testing.T, r *http.Request)
+	}{
+		{
+			name: "api key header",
+			opts: Options{Scheme: APIKey, Secret: "key"},
+			verify: func(t *testing.T, r *http.Request) {
+				testutil.Equals(t, "key", r.Header.Get(DefaultAPIKeyHeader))
+			},
+		},
+		{
+			name: "api key query",
+			opts: Options{Scheme: APIKey, Param: "api_key", Secret: "key"},
+			verify: func(t *testing.T, r *http.Request) {
+				testutil.Equals(t, "key", r.URL.Query().Get("api_key"))
+				testutil.Equals(t, "1", r.URL.Query().Get("page"))
+			},
+		},
+		{
+			name: "basic",
+			opts: Options{Scheme: Basic, Username: "user", Secret: "password"},
+			verify: func(t *testing.T, r *http.Request) {
+				username, password, ok := r.BasicAuth()
+				testutil.Assert(t, ok, "expected basic auth")
+				testutil.Equals(t, "user", username)
+				testutil.Equals(t, "password", password)
+			},
+		},
+		{
+			name: "bearer",
+			opts: Options{Scheme: Bearer, Secret: "token"},
+			verify: func(t *testing.T, r *http.Request) {
+				testutil.Equals(t, "Bearer token", r.Header.Get("Authorization"))
+			},
+		},
+		{
+			name: "hmac",
+			opts: Options{Scheme: HMAC, Header: "X-Sig", Secret: "key"},
+			verify: func(t *testing.T, r *http.Request) {
+				timestamp := r.Header.Get(TimestampHeader)
+				testutil.Assert(t, timestamp != "", "expected a timestamp")
+				testutil.Equals(t, Signature("key", http.MethodGet, "/hotels?page=1", timestamp, []byte{}), r.Header.Get("X-Sig"))
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tc.verify(t, r)
+			}))
+			defer srv.Close()
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL+"/hotels?page=1", nil)
+			testutil.Ok(t, err)
+			res, err := (&http.Client{Transport: NewTransport(tc.opts, nil)}).Do(req)
+			testutil.Ok(t, err)
+			res.Body.Close()
+			testutil.Equals(t, http.StatusOK, res.StatusCode)
+			// the request of the caller is left untouched
+			testutil.Equals(t, "page=1", req.URL.RawQuery)
+			testutil.Equals(t, 0, len(req.Header))
+		})
+	}
+}
+
+func TestTransportOAuth2(t *testing.T) {
+	var mu sync.Mutex
+	issued, valid := 0, ""
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, _ := r.BasicAuth()
+		testutil.Equals(t, "client", clientID)
+		testutil.Equals(t, "secret", secret)
+		testutil.Ok(t, r.ParseForm())
+		testutil.Equals(t, "client_credentials", r.PostForm.Get("grant_type"))
+		testutil.Equals(t, "hotels:read", r.PostForm.Get("scope"))
+
+		mu.Lock()
+		defer mu.Unlock()
+		issued++
+		valid = fmt.Sprintf("token-%d", issued)
+		_ = json.NewEncoder(w).Encode(tokenResponse{AccessToken: valid, TokenType: "Bearer", ExpiresIn: 3600})
+	}))
+	defer tokenSrv.Close()
+	apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.WriteString(w, "[]")
+	}))
+	defer apiSrv.Close()
+
+	now := time.Now()
+	transport := NewTransport(Options{
+		Scheme: OAuth2, TokenURL: tokenSrv.URL, ClientID: "client", Secret: "secret", Scopes: []string{"hotels:read"},
+	}, nil).(*Transport)
+	transport.now = func() time.Time { return now }
+	client := &http.Client{Transport: transport}
+	get := func() {
+		t.Helper()
+		res, err := client.Get(apiSrv.URL)
+		testutil.Ok(t, err)
+		res.Body.Close()
+		testutil.Equals(t, http.StatusOK, res.StatusCode)
+	}
+
+	// the token is cached
+	get()
+	get()
+	testutil.Equals(t, 1, issued)
+
+	// the token is refreshed before it expires
+	now = now.Add(time.Hour - tokenExpiryMargin)
+	get()
+	testutil.Equals(t, 2, issued)
+
+	// a revoked token is refreshed and the request retried
+	mu.Lock()
+	valid = "revoked"
+	mu.Unlock()
+	get()
+	testutil.Equals(t, 3, issued)
+}
+
+func TestTransportNone(t *testing.T) {
+	testutil.Equals(t, http.DefaultTransport, NewTransport(Options{Scheme: None}, http.DefaultTransport))
+}
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`[{"hotel_id": "iJhz"}]`)
+	timestamp := "1700000000"
+	signature := Signature("key", http.MethodPost, "/ingest/Paperflies", timestamp, body)
+	testutil.Ok(t, VerifySignature("key", http.MethodPost, "/ingest/Paperflies", timestamp, body, signature, now))
+	testutil.Ok(t, VerifySignature("key", http.MethodPost, "/ingest/Paperflies", timestamp, body, strings.ToUpper(signature), now.Add(MaxSignatureAge)))
+
+	for _, tc := range []struct {
+		name       string
+		key        Secret
+		requestURI string
+		timestamp  string
+		body       []byte
+		signature  string
+		now        time.Time
+	}{
+		{name: "wrong key", key: "other", requestURI: "/ingest/Paperflies", timestamp: timestamp, body: body, signature: signature, now: now},
+		{name: "other supplier", key: "key", requestURI: "/ingest/Acme", timestamp: timestamp, body: body, signature: signature, now: now},
+		{name: "tampered body", key: "key", requestURI: "/ingest/Paperflies", timestamp: timestamp, body: []byte(`[]`), signature: signature, now: now},
+		{name: "replayed", key: "key", requestURI: "/ingest/Paperflies", timestamp: timestamp, body: body, signature: signature, now: now.Add(MaxSignatureAge + time.Second)},
+		{name: "invalid timestamp", key: "key", requestURI: "/ingest/Paperflies", timestamp: "yesterday", body: body, signature: signature, now: now},
+		{name: "no signature", key: "key", requestURI: "/ingest/Paperflies", timestamp: timestamp, body: body, now: now},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.NotOk(t, VerifySignature(tc.key, http.MethodPost, tc.requestURI, tc.timestamp, tc.body, tc.signature, tc.now))
+		})
+	}
+}
@@ -1,13 +1,269 @@
 package cache
 
 import (
+	"container/list"
+	"sync"
 	"time"
-
-	"github.com/patrickmn/go-cache"
 )
 
-func NewInMemoryCache() *cache.Cache {
-	c := cache.New(1*time.Minute, 2*time.Minute)
+// Options configures the bounds of a Cache.
+type Options[K comparable, V any] struct {
+	// MaxEntries is the maximum number of entries kept in the cache. Zero means no limit on the entry count.
+	MaxEntries int
+	// MaxBytes is the maximum total size of the entries kept in the cache, as reported by SizeOf.
+	// Zero means no limit on the byte budget. It is ignored if SizeOf is nil.
+	MaxBytes int64
+	// SizeOf returns the approximate size of an entry in bytes.
+	SizeOf func(key K, value V) int64
+}
+
+// Stats holds the hit/miss statistics and the current usage of a Cache.
+type Stats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	Entries     int    `json:"entries"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// Cache is a typed, size-bounded in-memory cache with per-entry TTL.
+// When the cache is full, the least recently used entries are evicted first.
+// It is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	mu    sync.Mutex
+	opts  Options[K, V]
+	lru   *list.List // front is the most recently used entry
+	items map[K]*list.Element
+	bytes int64
+	stats Stats
+	now   func() time.Time
+}
+
+// Item is a snapshot of a cache entry, used to inspect the contents of the cache.
+type Item[K comparable, V any] struct {
+	Key       K
+	Value     V
+	CreatedAt time.Time
+	ExpiresAt time.Time // zero means the entry never expires
+}
+
+// entry is the value stored in each element of the LRU list.
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	size      int64
+	createdAt time.Time
+	expiresAt time.Time // zero means the entry never expires
+}
+
+// New creates a new Cache bounded by the given options.
+func New[K comparable, V any](opts Options[K, V]) *Cache[K, V] {
+	return &Cache[K, V]{
+		opts:  opts,
+		lru:   list.New(),
+		items: make(map[K]*list.Element),
+		now:   time.Now,
+	}
+}
+
+// Get returns the value stored for the key, if it exists and has not expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.get(key)
+}
+
+// GetMany looks up several keys at once. It returns the values that were found
+// and the keys that were missing or expired, in the order they were requested.
+func (c *Cache[K, V]) GetMany(keys []K) (map[K]V, []K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	found := make(map[K]V, len(keys))
+	var missing []K
+	for _, key := range keys {
+		value, ok := c.get(key)
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		found[key] = value
+	}
+
+	return found, missing
+}
+
+// Set stores the value for the key. A ttl of zero or less means the entry never expires.
+func (c *Cache[K, V]) Set(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(key, value, ttl)
+	c.evict()
+}
+
+// SetMany stores all the given entries with the same ttl.
+func (c *Cache[K, V]) SetMany(entries map[K]V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, value := range entries {
+		c.set(key, value, ttl)
+	}
+	c.evict()
+}
+
+// Delete removes the key from the cache. It reports whether the key was present.
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	c.remove(elem)
+	return true
+}
+
+// DeleteFunc removes all the entries for which del returns true. It returns the number of entries removed.
+func (c *Cache[K, V]) DeleteFunc(del func(key K, value V) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		e := elem.Value.(*entry[K, V])
+		if del(e.key, e.value) {
+			c.remove(elem)
+			removed++
+		}
+		elem = next
+	}
+	return removed
+}
+
+// Flush removes all the entries from the cache.
+func (c *Cache[K, V]) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.items = make(map[K]*list.Element)
+	c.bytes = 0
+}
+
+// Items returns a snapshot of the entries that have not expired, from the most to the least recently used.
+// Looking at the items does not count as using them.
+func (c *Cache[K, V]) Items() []Item[K, V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	items := make([]Item[K, V], 0, c.lru.Len())
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		e := elem.Value.(*entry[K, V])
+		if !e.expiresAt.IsZero() && now.After(e.expiresAt) {
+			continue
+		}
+		items = append(items, Item[K, V]{Key: e.key, Value: e.value, CreatedAt: e.createdAt, ExpiresAt: e.expiresAt})
+	}
+	return items
+}
+
+// Len returns the number of entries in the cache, including expired entries that have not been removed yet.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// Stats returns a snapshot of the cache statistics.
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// get returns the value for the key and marks it as recently used. The caller must hold the lock.
+func (c *Cache[K, V]) get(key K) (V, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+
+	e := elem.Value.(*entry[K, V])
+	if !e.expiresAt.IsZero() && c.now().After(e.expiresAt) {
+		// expired entries are removed lazily when they are looked up
+		c.remove(elem)
+		c.stats.Expirations++
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+
+	c.lru.MoveToFront(elem)
+	c.stats.Hits++
+	return e.value, true
+}
+
+// set inserts or replaces the entry for the key. The caller must hold the lock.
+func (c *Cache[K, V]) set(key K, value V, ttl time.Duration) {
+	now := c.now()
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = now.Add(ttl)
+	}
+	var size int64
+	if c.opts.SizeOf != nil {
+		size = c.opts.SizeOf(key, value)
+	}
+
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry[K, V])
+		c.bytes += size - e.size
+		e.value, e.size, e.createdAt, e.expiresAt = value, size, now, expiresAt
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.lru.PushFront(&entry[K, V]{key: key, value: value, size: size, createdAt: now, expiresAt: expiresAt})
+	c.bytes += size
+}
+
+// evict removes the least recently used entries until the cache is within its bounds. The caller must hold the lock.
+func (c *Cache[K, V]) evict() {
+	for c.overCapacity() {
+		elem := c.lru.Back()
+		if elem == nil {
+			return
+		}
+		c.remove(elem)
+		c.stats.Evictions++
+	}
+}
+
+// overCapacity reports whether the cache exceeds its entry count or byte budget. The caller must hold the lock.
+func (c *Cache[K, V]) overCapacity() bool {
+	if c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries {
+		return true
+	}
+	return c.opts.MaxBytes > 0 && c.opts.SizeOf != nil && c.bytes > c.opts.MaxBytes
+}
 
-	return c
+// remove deletes the element from the cache. The caller must hold the lock.
+func (c *Cache[K, V]) remove(elem *list.Element) {
+	e := c.lru.Remove(elem).(*entry[K, V])
+	delete(c.items, e.key)
+	c.bytes -= e.size
 }
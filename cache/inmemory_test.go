@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](Options[string, int]{MaxEntries: 2})
+	c.Set("a", 1, 0)
+	c.Set("b", 2, 0)
+
+	// touch "a" so that "b" becomes the least recently used entry
+	_, ok := c.Get("a")
+	testutil.Assert(t, ok, "expected a to be cached")
+	c.Set("c", 3, 0)
+
+	_, ok = c.Get("b")
+	testutil.Assert(t, !ok, "expected b to be evicted")
+	value, ok := c.Get("a")
+	testutil.Assert(t, ok, "expected a to be cached")
+	testutil.Equals(t, 1, value)
+	testutil.Equals(t, uint64(1), c.Stats().Evictions)
+}
+
+func TestCacheByteBudget(t *testing.T) {
+	c := New[string, string](Options[string, string]{
+		MaxBytes: 10,
+		SizeOf:   func(_ string, value string) int64 { return int64(len(value)) },
+	})
+	c.Set("a", "12345", 0)
+	c.Set("b", "12345", 0)
+	testutil.Equals(t, int64(10), c.Stats().Bytes)
+
+	c.Set("c", "1", 0)
+	testutil.Equals(t, 2, c.Len())
+	testutil.Equals(t, int64(6), c.Stats().Bytes)
+	_, ok := c.Get("a")
+	testutil.Assert(t, !ok, "expected a to be evicted")
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New[string, int](Options[string, int]{})
+	c.now = func() time.Time { return now }
+
+	c.Set("short", 1, time.Second)
+	c.Set("forever", 2, 0)
+	now = now.Add(2 * time.Second)
+
+	_, ok := c.Get("short")
+	testutil.Assert(t, !ok, "expected short to be expired")
+	_, ok = c.Get("forever")
+	testutil.Assert(t, ok, "expected forever to be cached")
+
+	stats := c.Stats()
+	testutil.Equals(t, uint64(1), stats.Expirations)
+	testutil.Equals(t, uint64(1), stats.Hits)
+	testutil.Equals(t, uint64(1), stats.Misses)
+	testutil.Equals(t, 1, stats.Entries)
+}
+
+func TestCacheGetManySetMany(t *testing.T) {
+	c := New[string, int](Options[string, int]{})
+	c.SetMany(map[string]int{"a": 1, "c": 3}, time.Minute)
+
+	found, missing := c.GetMany([]string{"a", "b", "c", "d"})
+	testutil.Equals(t, map[string]int{"a": 1, "c": 3}, found)
+	testutil.Equals(t, []string{"b", "d"}, missing)
+}
+
+func TestCacheDelete(t *testing.T) {
+	c := New[string, int](Options[string, int]{})
+	c.Set("a", 1, 0)
+
+	testutil.Assert(t, c.Delete("a"), "expected a to be deleted")
+	testutil.Assert(t, !c.Delete("a"), "expected a to be gone")
+	testutil.Equals(t, 0, c.Len())
+}
+
+func TestCacheItemsDeleteFuncFlush(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New[string, int](Options[string, int]{})
+	c.now = func() time.Time { return now }
+
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, time.Second)
+	c.Set("c", 3, 0)
+	now = now.Add(2 * time.Second)
+
+	testutil.Equals(t, []Item[string, int]{
+		{Key: "c", Value: 3, CreatedAt: now.Add(-2 * time.Second)},
+		{Key: "a", Value: 1, CreatedAt: now.Add(-2 * time.Second), ExpiresAt: now.Add(58 * time.Second)},
+	}, c.Items())
+
+	removed := c.DeleteFunc(func(_ string, value int) bool { return value%2 == 1 })
+	testutil.Equals(t, 2, removed)
+	testutil.Equals(t, 1, c.Len())
+
+	c.Flush()
+	testutil.Equals(t, 0, c.Len())
+	testutil.Equals(t, int64(0), c.Stats().Bytes)
+}
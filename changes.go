@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"merge-hotel/changes"
+)
+
+// ErrInvalidCursor is returned when the cursor to resume the changes from is not a non-negative integer.
+const ErrInvalidCursor = "Invalid cursor. The cursor must be the ID of the last event received."
+
+// EventReset is sent instead of the events that are no longer kept, after which the client must fetch the hotels
+// again, before following the changes from the cursor of the reset event.
+const EventReset = "reset"
+
+// changesHeartbeat is how often a comment is sent on an idle stream, so that proxies keep the connection open.
+const changesHeartbeat = 15 * time.Second
+
+type ChangesUsecase interface {
+	// Changes returns the log of the changes of the merged hotels.
+	Changes() *changes.Log
+}
+
+type ChangesHandler struct {
+	hotelService ChangesUsecase
+	heartbeat    time.Duration
+}
+
+// NewChangesHandler creates a new ChangesHandler.
+func NewChangesHandler(hotels ChangesUsecase) *ChangesHandler {
+	return &ChangesHandler{
+		hotelService: hotels,
+		heartbeat:    changesHeartbeat,
+	}
+}
+
+// StreamChanges streams the changes of the merged hotels as server-sent events, whose ID is the cursor of the change
+// and whose type is created, updated or removed. The stream resumes after the cursor of the Last-Event-ID header,
+// or of the cursor query parameter, and starts from the current changes otherwise.
+func (h *ChangesHandler) StreamChanges(c *gin.Context) {
+	changeLog := h.hotelService.Changes()
+	cursor := changeLog.Cursor()
+	resume := c.GetHeader("Last-Event-ID")
+	if resume == "" {
+		resume = c.Query("cursor")
+	}
+	if resume != "" {
+		var err error
+		cursor, err = strconv.ParseUint(resume, 10, 64)
+		if err != nil {
+			name := "cursor"
+			if c.GetHeader("Last-Event-ID") != "" {
+				name = "Last-Event-ID"
+			}
+			abortWithInvalidParam(c, name, ErrInvalidCursor)
+			return
+		}
+	}
+
+	// the stream outlives the write timeout of the server
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Warn().Err(err).Msg("Failed to clear the write deadline of the changes stream")
+	}
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		changed := changeLog.Changed()
+		events, ok := changeLog.Since(cursor)
+		if !ok {
+			cursor = changeLog.Cursor()
+			writeEvent(c.Writer, strconv.FormatUint(cursor, 10), EventReset, gin.H{"cursor": cursor})
+			c.Writer.Flush()
+			continue
+		}
+		for _, event := range events {
+			writeEvent(c.Writer, strconv.FormatUint(event.Cursor, 10), string(event.Type), event)
+			cursor = event.Cursor
+		}
+		if len(events) > 0 {
+			c.Writer.Flush()
+			continue
+		}
+		if changeLog.Closed() {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes a server-sent event with the JSON of data.
+func writeEvent(w io.Writer, id, event string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode change event")
+		return
+	}
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, event, payload)
+}
@@ -0,0 +1,208 @@
+// Package changes records the creations, updates and removals of the merged hotels, by diffing successive merge
+// results, so that downstream services can follow the changes instead of polling for them.
+package changes
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"merge-hotel/entity"
+)
+
+// Type is the kind of change of a hotel.
+type Type string
+
+const (
+	// Created is a hotel merged for the first time.
+	Created Type = "created"
+	// Updated is a hotel whose merged data changed.
+	Updated Type = "updated"
+	// Removed is a hotel that is no longer returned by the suppliers.
+	Removed Type = "removed"
+)
+
+// Event is a change of a merged hotel.
+type Event struct {
+	// Cursor identifies the event. The cursors increase, so that a client can resume after the last event it received.
+	Cursor  uint64 `json:"cursor"`
+	Type    Type   `json:"type"`
+	HotelID string `json:"hotel_id"`
+	// Fields are the paths of the fields that changed in the hotel response, e.g. location.address, for an update.
+	Fields []string  `json:"fields,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Log keeps the latest merged data of every hotel and the most recent events. It is safe for concurrent use.
+type Log struct {
+	size int
+
+	mu      sync.Mutex // guards the fields below
+	hotels  map[string]entity.Hotel
+	events  []Event // the most recent events, oldest first
+	cursor  uint64  // the cursor of the last event
+	changed chan struct{}
+	closed  bool
+}
+
+// NewLog creates a log that keeps the size most recent events.
+func NewLog(size int) *Log {
+	return &Log{size: max(size, 1), hotels: make(map[string]entity.Hotel), changed: make(chan struct{})}
+}
+
+// Record diffs the hotels of a merge result with the hotels recorded before, and records the changes.
+// The result is the answer to a search for the hotel IDs and destination, see Usecase.GetHotels. If it is complete,
+// the hotels recorded before that match the search but are not part of the result are recorded as removed.
+// It returns the recorded events.
+func (l *Log) Record(hotels []entity.Hotel, hotelIDs []string, destinationID int, complete bool) []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now().UTC()
+	var events []Event
+	returned := make(map[string]bool, len(hotels))
+	for _, hotel := range hotels {
+		returned[hotel.ID] = true
+		if previous, known := l.hotels[hotel.ID]; !known {
+			events = append(events, Event{Type: Created, HotelID: hotel.ID, Time: now})
+		} else if fields := Fields(previous, hotel); len(fields) > 0 {
+			events = append(events, Event{Type: Updated, HotelID: hotel.ID, Fields: fields, Time: now})
+		} else {
+			continue
+		}
+		// a copy is kept, so that the recorded hotel does not change with the slices of the result
+		l.hotels[hotel.ID] = hotel.Clone()
+	}
+
+	if complete {
+		for id, hotel := range l.hotels {
+			matched := (len(hotelIDs) == 0 || slices.Contains(hotelIDs, id)) && (destinationID < 0 || hotel.DestinationID == destinationID)
+			if matched && !returned[id] {
+				events = append(events, Event{Type: Removed, HotelID: id, Time: now})
+				delete(l.hotels, id)
+			}
+		}
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].HotelID < events[j].HotelID
+	})
+	for i := range events {
+		l.cursor++
+		events[i].Cursor = l.cursor
+	}
+	l.events = append(l.events, events...)
+	if excess := len(l.events) - l.size; excess > 0 {
+		l.events = slices.Delete(l.events, 0, excess)
+	}
+	if !l.closed {
+		close(l.changed)
+		l.changed = make(chan struct{})
+	}
+	return events
+}
+
+// Cursor returns the cursor of the last event, zero if there is none.
+func (l *Log) Cursor() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cursor
+}
+
+// Since returns the events after the cursor. It returns false if some of them are no longer kept, or if the
+// cursor is ahead of the log, e.g. because the service restarted, in which case the client must resynchronise.
+func (l *Log) Since(cursor uint64) ([]Event, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if cursor > l.cursor {
+		return nil, false
+	}
+	// the events are kept in order of cursor, so the first one kept is the oldest
+	if len(l.events) > 0 && cursor+1 < l.events[0].Cursor {
+		return nil, false
+	}
+	i, _ := slices.BinarySearchFunc(l.events, cursor+1, func(e Event, target uint64) int {
+		return cmp.Compare(e.Cursor, target)
+	})
+	return slices.Clone(l.events[i:]), true
+}
+
+// Changed returns a channel that is closed when events are recorded, or when the log is closed.
+// It must be called before Since, so that no event is missed between them.
+func (l *Log) Changed() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.changed
+}
+
+// Close wakes up the waiting clients, which stop following the log, e.g. when the server shuts down.
+func (l *Log) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.changed)
+	}
+}
+
+// Closed reports whether the log is closed.
+func (l *Log) Closed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+// Fields returns the sorted paths of the fields that differ between two versions of a hotel. The lists are
+// compared regardless of their order, as the order of the merged lists depends on the order the suppliers answered in.
+func Fields(before, after entity.Hotel) []string {
+	var fields []string
+	diff := func(path string, changed bool) {
+		if changed {
+			fields = append(fields, path)
+		}
+	}
+	diff("amenities.general", !sameElements(before.Amenities.General, after.Amenities.General))
+	diff("amenities.room", !sameElements(before.Amenities.Room, after.Amenities.Room))
+	diff("booking_conditions", !sameElements(before.BookingConditions, after.BookingConditions))
+	diff("description", before.Description != after.Description)
+	diff("destination_id", before.DestinationID != after.DestinationID)
+	diff("images.amenities", !sameImages(before.Images.Amenities, after.Images.Amenities))
+	diff("images.rooms", !sameImages(before.Images.Rooms, after.Images.Rooms))
+	diff("images.site", !sameImages(before.Images.Site, after.Images.Site))
+	diff("location.address", before.Location.Address != after.Location.Address)
+	diff("location.city", before.Location.City != after.Location.City)
+	diff("location.country", before.Location.Country != after.Location.Country)
+	diff("location.lat", before.Location.Latitude != after.Location.Latitude)
+	diff("location.lng", before.Location.Longitude != after.Location.Longitude)
+	diff("name", before.Name != after.Name)
+	return fields
+}
+
+// sameElements reports whether two lists hold the same elements, in any order. A nil list is the same as an empty one.
+func sameElements[T cmp.Ordered](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// sameImages reports whether two lists hold the same images, in any order.
+func sameImages(a, b []entity.Image) bool {
+	keys := func(images []entity.Image) []string {
+		k := make([]string, len(images))
+		for i, image := range images {
+			k[i] = image.Link + "\n" + image.Description
+		}
+		return k
+	}
+	return sameElements(keys(a), keys(b))
+}
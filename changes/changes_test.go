@@ -0,0 +1,115 @@
+package changes
+
+import (
+	"testing"
+	"time"
+
+	"merge-hotel/entity"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+// summary is an event without its time, which is not deterministic.
+type summary struct {
+	Cursor  uint64
+	Type    Type
+	HotelID string
+	Fields  []string
+}
+
+func summarize(events []Event) []summary {
+	var s []summary
+	for _, e := range events {
+		s = append(s, summary{Cursor: e.Cursor, Type: e.Type, HotelID: e.HotelID, Fields: e.Fields})
+	}
+	return s
+}
+
+func TestRecord(t *testing.T) {
+	l := NewLog(100)
+	a := entity.Hotel{ID: "a", DestinationID: 1, Name: "A", Amenities: entity.Amenities{General: []string{"pool", "wifi"}}}
+	b := entity.Hotel{ID: "b", DestinationID: 1, Name: "B"}
+	c := entity.Hotel{ID: "c", DestinationID: 2, Name: "C"}
+
+	testutil.Equals(t, []summary{
+		{Cursor: 1, Type: Created, HotelID: "a"},
+		{Cursor: 2, Type: Created, HotelID: "b"},
+		{Cursor: 3, Type: Created, HotelID: "c"},
+	}, summarize(l.Record([]entity.Hotel{c, b, a}, nil, -1, true)))
+
+	// the same data in another order is not a change
+	a.Amenities.General = []string{"wifi", "pool"}
+	testutil.Equals(t, 0, len(l.Record([]entity.Hotel{a, b, c}, nil, -1, true)))
+
+	updated := a.Clone()
+	updated.Name = "A Resort"
+	updated.Location.City = "Singapore"
+	updated.Amenities.General = append(updated.Amenities.General, "spa")
+	testutil.Equals(t, []summary{
+		{Cursor: 4, Type: Updated, HotelID: "a", Fields: []string{"amenities.general", "location.city", "name"}},
+	}, summarize(l.Record([]entity.Hotel{updated}, []string{"a"}, -1, true)))
+
+	// the hotels missing from a partial result are not removed
+	testutil.Equals(t, 0, len(l.Record(nil, nil, 1, false)))
+	// only the hotels of the search are removed
+	testutil.Equals(t, []summary{
+		{Cursor: 5, Type: Removed, HotelID: "b"},
+	}, summarize(l.Record([]entity.Hotel{updated}, nil, 1, true)))
+	testutil.Equals(t, uint64(5), l.Cursor())
+
+	// a removed hotel is created again
+	testutil.Equals(t, []summary{
+		{Cursor: 6, Type: Created, HotelID: "b"},
+	}, summarize(l.Record([]entity.Hotel{b}, []string{"b"}, -1, true)))
+}
+
+func TestSince(t *testing.T) {
+	l := NewLog(3)
+	events, ok := l.Since(0)
+	testutil.Assert(t, ok, "expected an empty log to be followed from the start")
+	testutil.Equals(t, 0, len(events))
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		l.Record([]entity.Hotel{{ID: id}}, []string{id}, -1, true)
+	}
+	events, ok = l.Since(2)
+	testutil.Assert(t, ok, "expected the events after 2 to be kept")
+	testutil.Equals(t, []summary{{Cursor: 3, Type: Created, HotelID: "c"}, {Cursor: 4, Type: Created, HotelID: "d"}}, summarize(events))
+	events, ok = l.Since(1)
+	testutil.Assert(t, ok, "expected the events after 1 to be kept")
+	testutil.Equals(t, 3, len(events))
+	events, ok = l.Since(4)
+	testutil.Assert(t, ok, "expected the cursor of the last event to be followed")
+	testutil.Equals(t, 0, len(events))
+
+	_, ok = l.Since(0)
+	testutil.Assert(t, !ok, "expected the first event to be discarded")
+	_, ok = l.Since(5)
+	testutil.Assert(t, !ok, "expected a cursor ahead of the log to be reset")
+}
+
+func TestChangedAndClose(t *testing.T) {
+	l := NewLog(10)
+	changed := l.Changed()
+	select {
+	case <-changed:
+		t.Fatal("expected no change yet")
+	default:
+	}
+	l.Record([]entity.Hotel{{ID: "a"}}, nil, -1, true)
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("expected the change to be notified")
+	}
+
+	changed = l.Changed()
+	l.Close()
+	<-changed
+	testutil.Assert(t, l.Closed(), "expected the log to be closed")
+	// the changes are still recorded after the log is closed
+	l.Record([]entity.Hotel{{ID: "a"}, {ID: "b"}}, nil, -1, true)
+	events, ok := l.Since(1)
+	testutil.Assert(t, ok, "expected the events after 1 to be kept")
+	testutil.Equals(t, 1, len(events))
+}
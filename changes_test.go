@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"merge-hotel/changes"
+	"merge-hotel/entity"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/gin-gonic/gin"
+)
+
+// logUsecase serves the changes of a log.
+type logUsecase struct {
+	log *changes.Log
+}
+
+func (u logUsecase) Changes() *changes.Log {
+	return u.log
+}
+
+// serveChanges serves the changes of the log, with the given heartbeat.
+func serveChanges(t *testing.T, changeLog *changes.Log, heartbeat time.Duration) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	handler := NewChangesHandler(logUsecase{log: changeLog})
+	handler.heartbeat = heartbeat
+	router := gin.New()
+	router.GET("/hotels/changes", handler.StreamChanges)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// followChanges opens the stream of changes, with the Last-Event-ID header if it is not empty.
+func followChanges(t *testing.T, srv *httptest.Server, target, lastEventID string) *bufio.Reader {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, srv.URL+target, nil)
+	testutil.Ok(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	res, err := srv.Client().Do(req)
+	testutil.Ok(t, err)
+	t.Cleanup(func() { _ = res.Body.Close() })
+	testutil.Equals(t, http.StatusOK, res.StatusCode)
+	testutil.Equals(t, "text/event-stream", res.Header.Get("Content-Type"))
+	return bufio.NewReader(res.Body)
+}
+
+// sseEvent is an event of the stream, or a comment if it has no type.
+type sseEvent struct {
+	id, event, data, comment string
+}
+
+// nextEvent reads the next event or comment of the stream.
+func nextEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	var e sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		testutil.Ok(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return e
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "":
+			e.comment = value
+		case "id":
+			e.id = value
+		case "event":
+			e.event = value
+		case "data":
+			e.data = value
+		}
+	}
+}
+
+// expectChange reads the next event, and checks that it is the change of a hotel.
+func expectChange(t *testing.T, r *bufio.Reader, cursor string, kind changes.Type, hotelID string) {
+	t.Helper()
+	e := nextEvent(t, r)
+	testutil.Equals(t, cursor, e.id)
+	testutil.Equals(t, string(kind), e.event)
+	var event changes.Event
+	testutil.Ok(t, json.Unmarshal([]byte(e.data), &event))
+	testutil.Equals(t, hotelID, event.HotelID)
+}
+
+// recordHotels records the creation of hotels with the given IDs.
+func recordHotels(changeLog *changes.Log, hotelIDs ...string) {
+	hotels := make([]entity.Hotel, len(hotelIDs))
+	for i, id := range hotelIDs {
+		hotels[i] = entity.Hotel{ID: id}
+	}
+	changeLog.Record(hotels, hotelIDs, -1, false)
+}
+
+func TestStreamChangesResumes(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		target      string
+		lastEventID string
+	}{
+		{name: "Last-Event-ID", target: "/hotels/changes?cursor=2", lastEventID: "1"},
+		{name: "cursor", target: "/hotels/changes?cursor=1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			changeLog := changes.NewLog(10)
+			recordHotels(changeLog, "a", "b", "c")
+			srv := serveChanges(t, changeLog, time.Minute)
+
+			// the header takes precedence over the query parameter, as browsers send it when they reconnect
+			stream := followChanges(t, srv, tc.target, tc.lastEventID)
+			expectChange(t, stream, "2", changes.Created, "b")
+			expectChange(t, stream, "3", changes.Created, "c")
+
+			// the changes recorded while following are streamed as they happen
+			recordHotels(changeLog, "d")
+			expectChange(t, stream, "4", changes.Created, "d")
+
+			// the stream ends when the log is closed, e.g. on shutdown
+			changeLog.Close()
+			_, err := stream.ReadByte()
+			testutil.Equals(t, io.EOF, err)
+		})
+	}
+}
+
+func TestStreamChangesStartsFromCurrentChanges(t *testing.T) {
+	changeLog := changes.NewLog(10)
+	recordHotels(changeLog, "a")
+	srv := serveChanges(t, changeLog, time.Minute)
+
+	stream := followChanges(t, srv, "/hotels/changes", "")
+	recordHotels(changeLog, "b")
+	expectChange(t, stream, "2", changes.Created, "b")
+}
+
+func TestStreamChangesResets(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		cursor string
+	}{
+		{name: "cursor no longer kept", cursor: "0"},
+		{name: "cursor ahead of the log", cursor: "99"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			changeLog := changes.NewLog(2)
+			recordHotels(changeLog, "a", "b", "c")
+			srv := serveChanges(t, changeLog, time.Minute)
+
+			stream := followChanges(t, srv, "/hotels/changes", tc.cursor)
+			reset := nextEvent(t, stream)
+			testutil.Equals(t, sseEvent{id: "3", event: EventReset, data: `{"cursor":3}`}, reset)
+
+			// the stream follows the changes after the reset
+			recordHotels(changeLog, "d")
+			expectChange(t, stream, "4", changes.Created, "d")
+		})
+	}
+}
+
+func TestStreamChangesHeartbeat(t *testing.T) {
+	srv := serveChanges(t, changes.NewLog(10), 10*time.Millisecond)
+	stream := followChanges(t, srv, "/hotels/changes", "")
+	testutil.Equals(t, sseEvent{comment: "heartbeat"}, nextEvent(t, stream))
+	testutil.Equals(t, sseEvent{comment: "heartbeat"}, nextEvent(t, stream))
+}
+
+func TestStreamChangesInvalidCursor(t *testing.T) {
+	srv := serveChanges(t, changes.NewLog(10), time.Minute)
+	for _, tc := range []struct {
+		header, query, param string
+	}{
+		{header: "-1", param: "Last-Event-ID"},
+		{query: "abc", param: "cursor"},
+	} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/hotels/changes?cursor="+tc.query, nil)
+		testutil.Ok(t, err)
+		if tc.header != "" {
+			req.Header.Set("Last-Event-ID", tc.header)
+		}
+		res, err := srv.Client().Do(req)
+		testutil.Ok(t, err)
+		var problem Problem
+		testutil.Ok(t, json.NewDecoder(res.Body).Decode(&problem))
+		_ = res.Body.Close()
+		testutil.Equals(t, http.StatusBadRequest, res.StatusCode)
+		testutil.Equals(t, []InvalidParam{{Name: tc.param, Reason: ErrInvalidCursor}}, problem.InvalidParams)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigProblem is a problem found in a configuration file.
+type ConfigProblem struct {
+	// Line is the line of the setting in the file, or 0 if the setting is not in the file.
+	Line    int
+	Message string
+}
+
+// runConfigCommand runs `merge-hotel config validate [--env] [files...]`, which validates configPath if no file is given.
+// Each file is validated and the problems are printed as file:line: message, suitable for pre-commit checks.
+func runConfigCommand(args []string, configPath string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "Usage: merge-hotel config validate [--env] [config.yaml ...]")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	withEnv := flags.Bool("env", false, "apply the MERGEHOTEL_* environment overrides before validating")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{configPath}
+	}
+
+	exitCode := 0
+	for _, file := range files {
+		problems, err := ValidateConfigFile(file, *withEnv)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			exitCode = 1
+			continue
+		}
+		for _, problem := range problems {
+			if problem.Line > 0 {
+				fmt.Fprintf(os.Stderr, "%s:%d: %s\n", file, problem.Line, problem.Message)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", file, problem.Message)
+			}
+		}
+		if len(problems) > 0 {
+			exitCode = 1
+			continue
+		}
+		fmt.Printf("%s: OK\n", file)
+	}
+	return exitCode
+}
+
+// yamlLinePattern matches the line number in the errors of the YAML parser, e.g. "line 3: field foo not found".
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// ValidateConfigFile checks a configuration file and returns all the problems found, sorted by line.
+// Syntax errors, unknown keys, invalid values and semantic errors are all reported.
+// If withEnv is true, the MERGEHOTEL_* environment overrides are applied and the supplier secrets are loaded before validating.
+// It only returns an error if the file cannot be read.
+func ValidateConfigFile(filename string, withEnv bool) ([]ConfigProblem, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		// the file is not valid YAML, so nothing else can be checked
+		return []ConfigProblem{parseYAMLProblem(err.Error())}, nil
+	}
+
+	var problems []ConfigProblem
+	cfg, err := parseConfig(data)
+	var typeErr *yaml.TypeError
+	switch {
+	case errors.As(err, &typeErr):
+		for _, msg := range typeErr.Errors {
+			problems = append(problems, parseYAMLProblem(msg))
+		}
+	case err != nil:
+		return []ConfigProblem{parseYAMLProblem(err.Error())}, nil
+	}
+
+	if withEnv {
+		if err := applyEnvOverrides(cfg, os.Environ()); err != nil {
+			for _, msg := range strings.Split(err.Error(), "\n") {
+				problems = append(problems, ConfigProblem{Message: msg})
+			}
+		}
+		applySupplierDefaults(cfg)
+	}
+
+	// the secrets are only read with the environment, as they are usually not available where the file is edited
+	var errs []error
+	if withEnv {
+		if err := loadSecrets(cfg); err != nil {
+			errs = append(errs, unwrapErrors(err)...)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, unwrapErrors(err)...)
+	}
+	for _, err := range errs {
+		var fieldErr *FieldError
+		if errors.As(err, &fieldErr) {
+			problems = append(problems, ConfigProblem{Line: nodeLine(&root, fieldErr.Path), Message: fieldErr.Error()})
+			continue
+		}
+		problems = append(problems, ConfigProblem{Message: err.Error()})
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	return problems, nil
+}
+
+// parseYAMLProblem extracts the line number from an error message of the YAML parser.
+func parseYAMLProblem(msg string) ConfigProblem {
+	match := yamlLinePattern.FindStringSubmatch(msg)
+	if match == nil {
+		return ConfigProblem{Message: msg}
+	}
+	line, _ := strconv.Atoi(match[1])
+	return ConfigProblem{Line: line, Message: match[2]}
+}
+
+// nodeLine returns the line of the key at the dotted path in the YAML document.
+// If the key is not in the document, the line of its closest parent is returned, or 0 if there is none.
+func nodeLine(root *yaml.Node, path string) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	line := 0
+	for _, key := range strings.Split(path, ".") {
+		if node.Kind != yaml.MappingNode {
+			return line
+		}
+		found := false
+		// the content of a mapping node alternates between keys and values
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				line = node.Content[i].Line
+				node = node.Content[i+1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return line
+		}
+	}
+	return line
+}
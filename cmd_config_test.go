@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestValidateConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	testutil.Ok(t, os.WriteFile(path, []byte(`server:
+  address: "localhost"
+  read_timeout: 5x
+  colour: blue
+suppliers:
+  Acme:
+    url: "ftp://acme"
+  Other:
+    kind: Acmee
+    url: "https://example.com"
+`), 0o600))
+
+	problems, err := ValidateConfigFile(path, false)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ConfigProblem{
+		{Line: 2, Message: `server.address: "localhost" is not a valid host:port`},
+		{Line: 3, Message: "cannot unmarshal !!str `5x` into time.Duration"},
+		{Line: 4, Message: "field colour not found in type main.ServerConfig"},
+		{Line: 7, Message: `suppliers.Acme.url: "ftp://acme" is not a valid http(s) URL`},
+		{Line: 9, Message: `suppliers.Other.kind: unknown supplier kind "Acmee", must be one of Acme, Feed, Paperflies, Patagonia`},
+	}, problems)
+}
+
+func TestValidateConfigFileSyntaxError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	testutil.Ok(t, os.WriteFile(path, []byte("suppliers:\n  Acme: [\n"), 0o600))
+
+	problems, err := ValidateConfigFile(path, false)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(problems))
+	testutil.Equals(t, 2, problems[0].Line)
+}
+
+func TestValidateConfigFileRepoConfig(t *testing.T) {
+	problems, err := ValidateConfigFile("config.yaml", false)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(problems))
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"merge-hotel/entity"
+	"merge-hotel/export"
+)
+
+// pathList is a flag that can be repeated, or given a comma-separated list of paths.
+type pathList []string
+
+func (p *pathList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *pathList) Set(value string) error {
+	*p = append(*p, strings.Split(value, ",")...)
+	return nil
+}
+
+// runMergeCommand runs `merge-hotel merge`, which merges supplier responses captured to files without any network,
+// using the same conversion, cleaning and merging as the server.
+func runMergeCommand(args []string) int {
+	flags := flag.NewFlagSet("merge", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: merge-hotel merge --acme FILE --patagonia FILE --paperflies FILE [flags]")
+		fmt.Fprintln(flags.Output(), "Each supplier flag takes a JSON file or a directory of JSON files, and can be repeated.")
+		flags.PrintDefaults()
+	}
+
+	// one input flag per supplier kind, e.g. --acme, except the feeds whose format is in the configuration
+	inputs := make(map[string]*pathList)
+	for _, kind := range knownSupplierKinds() {
+		if supplierKinds[kind].decode == nil {
+			continue
+		}
+		inputs[kind] = &pathList{}
+		flags.Var(inputs[kind], strings.ToLower(kind), fmt.Sprintf("%s response file or directory", kind))
+	}
+	formatName := flags.String("format", string(export.JSON), "output format: json, ndjson or csv")
+	columns := flags.String("columns", "", "comma-separated CSV columns, defaults to all the columns")
+	output := flags.String("output", "", "output file, defaults to stdout")
+	hotels := flags.String("hotels", "", "comma-separated hotel IDs to keep, like the hotels query parameter")
+	destination := flags.Int("destination", -1, "destination ID to keep, like the destination query parameter")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	var hotelIDs, csvColumns []string
+	if *hotels != "" {
+		hotelIDs = strings.Split(*hotels, ",")
+	}
+	if *columns != "" {
+		csvColumns = strings.Split(*columns, ",")
+	}
+
+	inputCount := 0
+	for _, paths := range inputs {
+		inputCount += len(*paths)
+	}
+	if inputCount == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	// read the supplier files in a stable order so that the merge result is reproducible
+	var allHotels []entity.Hotel
+	for _, kind := range knownSupplierKinds() {
+		if inputs[kind] == nil {
+			continue
+		}
+		for _, path := range *inputs[kind] {
+			supplierHotels, err := readSupplierHotels(kind, path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			supplierHotels = filterHotels(supplierHotels, hotelIDs, *destination)
+			allHotels = append(allHotels, prepareSupplierHotels(kind, supplierHotels)...)
+		}
+	}
+
+	mergedHotels := mergeHotelData(allHotels)
+	sort.Slice(mergedHotels, func(i, j int) bool {
+		return mergedHotels[i].ID < mergedHotels[j].ID
+	})
+
+	if *output == "" {
+		err = writeHotels(os.Stdout, format, csvColumns, mergedHotels)
+	} else {
+		err = writeHotelsToFile(*output, format, csvColumns, mergedHotels)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// readSupplierHotels decodes the hotels of a supplier from a file, or from all the .json files in a directory.
+func readSupplierHotels(kind, path string) ([]entity.Hotel, error) {
+	var files []string
+	err := filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// the path itself is always read, files in a directory only if they are JSON
+		if file == path && !d.IsDir() || !d.IsDir() && strings.EqualFold(filepath.Ext(file), ".json") {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no JSON files found", path)
+	}
+
+	var hotels []entity.Hotel
+	for _, file := range files {
+		fileHotels, err := decodeSupplierFile(kind, file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		hotels = append(hotels, fileHotels...)
+	}
+	return hotels, nil
+}
+
+// decodeSupplierFile decodes a single file in the response format of the supplier kind.
+func decodeSupplierFile(kind, file string) ([]entity.Hotel, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hotels, err := supplierKinds[kind].decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s response: %w", kind, err)
+	}
+	return hotels, nil
+}
+
+// writeHotels writes the hotels in the given format.
+func writeHotels(w io.Writer, format export.Format, columns []string, hotels []entity.Hotel) error {
+	writer, err := export.NewWriter(w, format, columns)
+	if err != nil {
+		return err
+	}
+	for _, hotel := range hotels {
+		if err := writer.Write(hotel); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// writeHotelsToFile writes the hotels in the given format to a new file.
+func writeHotelsToFile(path string, format export.Format, columns []string, hotels []entity.Hotel) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeHotels(file, format, columns, hotels); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
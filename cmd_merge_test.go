@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"merge-hotel/entity"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestRunMergeCommand(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "merged.json")
+	exitCode := runMergeCommand([]string{
+		"--acme", "testdata/suppliers/acme.json",
+		"--patagonia", "testdata/suppliers/patagonia.json",
+		"--paperflies", "testdata/suppliers/paperflies.json",
+		"--destination", "5432",
+		"--output", output,
+	})
+	testutil.Equals(t, 0, exitCode)
+
+	data, err := os.ReadFile(output)
+	testutil.Ok(t, err)
+	var hotels []entity.Hotel
+	testutil.Ok(t, json.Unmarshal(data, &hotels))
+
+	// hotels are sorted by ID
+	testutil.Equals(t, 2, len(hotels))
+	testutil.Equals(t, "SjyX", hotels[0].ID)
+	beachVillas := hotels[1]
+	testutil.Equals(t, "iJhz", beachVillas.ID)
+	testutil.Equals(t, "Beach Villas Singapore", beachVillas.Name)
+	testutil.Equals(t, "8 Sentosa Gateway, Beach Villas, 098269", beachVillas.Location.Address)
+	testutil.Equals(t, "Singapore", beachVillas.Location.Country)
+	testutil.Equals(t, 3, len(beachVillas.Images.Rooms))
+	testutil.Equals(t, 3, len(beachVillas.BookingConditions))
+}
+
+func TestRunMergeCommandErrors(t *testing.T) {
+	testutil.Equals(t, 2, runMergeCommand(nil))
+	testutil.Equals(t, 2, runMergeCommand([]string{"--acme", "testdata/suppliers/acme.json", "--format", "xml"}))
+	testutil.Equals(t, 1, runMergeCommand([]string{"--acme", "go.mod"}))
+}
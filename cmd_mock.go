@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"merge-hotel/mock"
+)
+
+// runMockSuppliersCommand runs `merge-hotel mock-suppliers`, which serves Acme, Patagonia and Paperflies shaped
+// endpoints from files or generated data, so that the service can be run offline.
+func runMockSuppliersCommand(args []string) int {
+	flags := flag.NewFlagSet("mock-suppliers", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: merge-hotel mock-suppliers [flags]")
+		fmt.Fprintln(flags.Output(), "Serves the suppliers at http://ADDRESS/suppliers/{acme,patagonia,paperflies}.")
+		flags.PrintDefaults()
+	}
+	address := flags.String("address", "localhost:9090", "address to listen on")
+	dataDir := flags.String("data", "testdata/suppliers", "directory of <kind>.json supplier responses or fixtures to serve")
+	generate := flags.Int("generate", 0, "serve this many generated hotels instead of the files in --data")
+	var opts mock.Options
+	flags.DurationVar(&opts.Latency, "latency", 0, "latency added to every response")
+	flags.DurationVar(&opts.Jitter, "jitter", 0, "random latency added to every response, up to this duration")
+	flags.Float64Var(&opts.ErrorRate, "error-rate", 0, "rate of responses failing with 500, between 0 and 1")
+	flags.Float64Var(&opts.MalformedRate, "malformed-rate", 0, "rate of records with a malformed hotel ID, between 0 and 1")
+	flags.Float64Var(&opts.NullRate, "null-rate", 0, "rate of record fields set to null, between 0 and 1")
+	flags.Uint64Var(&opts.Seed, "seed", uint64(time.Now().UnixNano()), "seed of the generated data and the injected faults")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	for name, rate := range map[string]float64{"error-rate": opts.ErrorRate, "malformed-rate": opts.MalformedRate, "null-rate": opts.NullRate} {
+		if rate < 0 || rate > 1 {
+			fmt.Fprintf(os.Stderr, "--%s must be between 0 and 1, got %v\n", name, rate)
+			return 2
+		}
+	}
+
+	records, err := mockRecords(*dataDir, *generate, opts.Seed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	srv := &http.Server{
+		Addr:              *address,
+		Handler:           mock.NewServer(records, opts),
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving mock suppliers, point the supplier URLs of the configuration to:\n")
+	for _, kind := range mock.Kinds {
+		fmt.Fprintf(os.Stderr, "  http://%s/suppliers/%s (%d hotels)\n", *address, kind, len(records[kind]))
+	}
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// mockRecords returns the records to serve, generated if n is positive, or read from the <kind>.json files of dir.
+func mockRecords(dir string, n int, seed uint64) (map[string][]mock.Record, error) {
+	if n > 0 {
+		return mock.Generate(n, seed), nil
+	}
+	records := make(map[string][]mock.Record, len(mock.Kinds))
+	for _, kind := range mock.Kinds {
+		kindRecords, err := mock.LoadRecords(filepath.Join(dir, kind+".json"))
+		if err != nil {
+			return nil, err
+		}
+		records[kind] = kindRecords
+	}
+	return records, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// commands maps each subcommand to the function that runs it with the remaining arguments and returns the exit code.
+// The commands that read the configuration file get the path of the --config flag. Running the binary without
+// a subcommand starts the web server.
+func commands(configPath string) map[string]func(args []string) int {
+	return map[string]func(args []string) int{
+		"config":         func(args []string) int { return runConfigCommand(args, configPath) },
+		"merge":          runMergeCommand,
+		"mock-suppliers": runMockSuppliersCommand,
+	}
+}
+
+// parseFlags parses the global flags that precede the subcommand, and returns the path of the configuration file
+// and the subcommand with its arguments, which are empty to start the web server.
+func parseFlags(args []string) (string, []string, error) {
+	flags := flag.NewFlagSet("merge-hotel", flag.ContinueOnError)
+	configPath := flags.String("config", envOrDefault(EnvPrefix+"CONFIG", "config.yaml"), "path to the YAML configuration file")
+	flags.Usage = func() {
+		printCommands()
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return "", nil, err
+	}
+	return *configPath, flags.Args(), nil
+}
+
+// runCommand runs the subcommand named by the first argument with the configuration file at configPath,
+// and returns its exit code. An unknown subcommand is a usage error.
+func runCommand(args []string, configPath string) int {
+	run, ok := commands(configPath)[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", args[0])
+		printCommands()
+		return 2
+	}
+	return run(args[1:])
+}
+
+// printCommands prints the list of subcommands.
+func printCommands() {
+	cmds := commands("")
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "Usage: merge-hotel [--config config.yaml] [command]")
+	fmt.Fprintln(os.Stderr, "Without a command, the web server is started. Commands:")
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  "+name)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestParseFlags(t *testing.T) {
+	configPath, command, err := parseFlags([]string{"--config", "prod.yaml", "config", "validate", "--env"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, "prod.yaml", configPath)
+	testutil.Equals(t, []string{"config", "validate", "--env"}, command)
+
+	configPath, command, err = parseFlags([]string{"--config", "prod.yaml"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, "prod.yaml", configPath)
+	testutil.Equals(t, 0, len(command), "expected the web server to be started")
+
+	_, _, err = parseFlags([]string{"--colour", "blue"})
+	testutil.NotOk(t, err)
+}
+
+func TestRunCommand(t *testing.T) {
+	invalid := filepath.Join(t.TempDir(), "invalid.yaml")
+	testutil.Ok(t, os.WriteFile(invalid, []byte("server:\n  colour: blue\n"), 0o600))
+
+	// the configuration file of the --config flag is validated
+	testutil.Equals(t, 0, runCommand([]string{"config", "validate"}, "config.yaml"))
+	testutil.Equals(t, 1, runCommand([]string{"config", "validate"}, invalid))
+	testutil.Equals(t, 2, runCommand([]string{"serve"}, "config.yaml"))
+}
@@ -1,29 +1,773 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"merge-hotel/auth"
+	"merge-hotel/fault"
+	"merge-hotel/fixture"
+	"merge-hotel/latency"
+	"merge-hotel/ratelimit"
+	"merge-hotel/supplier"
+	"merge-hotel/suppress"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
 )
 
+// EnvPrefix is the prefix of the environment variables that override the configuration file.
+const EnvPrefix = "MERGEHOTEL_"
+
 type Config struct {
-	Suppliers map[string]SupplierConfig `yaml:"suppliers"`
+	Server    ServerConfig    `yaml:"server"`
+	Cache     CacheConfig     `yaml:"cache"`
+	Logging   LoggingConfig   `yaml:"logging"`
+	Admin     AdminConfig     `yaml:"admin"`
+	Reload    ReloadConfig    `yaml:"reload"`
+	Fixtures  FixturesConfig  `yaml:"fixtures"`
+	Overrides OverridesConfig `yaml:"overrides"`
+	// Suppression hides hotels, images and amenities from the results. Nothing is suppressed by default.
+	Suppression SuppressionConfig         `yaml:"suppression"`
+	Suppliers   map[string]SupplierConfig `yaml:"suppliers"`
+}
+
+type ServerConfig struct {
+	// Address is the host:port the web server listens on.
+	Address           string        `yaml:"address"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	// ShutdownTimeout is how long in-flight requests are given to complete on shutdown.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// LatencyBudget bounds how long a search waits for the suppliers. The suppliers that have not answered
+	// by then are abandoned and the result is reported as partial. Zero waits for all the suppliers.
+	LatencyBudget time.Duration `yaml:"latency_budget"`
+}
+
+type CacheConfig struct {
+	// TTL is how long merged hotels are kept in the in memory cache, zero means the default of one minute.
+	TTL time.Duration `yaml:"ttl"`
+	// MaxEntries is the maximum number of hotels in the in memory cache, zero means no limit.
+	MaxEntries int `yaml:"max_entries"`
+	// MaxBytes is the approximate maximum size of the in memory cache, zero means no limit.
+	MaxBytes int64 `yaml:"max_bytes"`
+	// HTTPMaxAge is the max-age sent to clients in the Cache-Control header.
+	HTTPMaxAge time.Duration `yaml:"http_max_age"`
+}
+
+type LoggingConfig struct {
+	// Level is one of trace, debug, info, warn, error, fatal, panic or disabled.
+	Level string `yaml:"level"`
+	// Format is either json or console.
+	Format string `yaml:"format"`
+}
+
+type AdminConfig struct {
+	// Token is the bearer token required by the admin endpoints. The admin endpoints are disabled if it is empty.
+	Token string `yaml:"token"`
+}
+
+type OverridesConfig struct {
+	// File persists the manual overrides of the hotel data, so that they survive restarts.
+	// They are kept in memory only if it is empty.
+	File string `yaml:"file"`
+}
+
+type SuppressionConfig struct {
+	// Rules are applied in order to every result, see suppress.Rule.
+	Rules []SuppressionRuleConfig `yaml:"rules"`
+}
+
+// SuppressionRuleConfig selects the hotels matching all the conditions that are set. The hotels are hidden,
+// unless images or amenities is set, in which case only the matching images or amenities are dropped.
+type SuppressionRuleConfig struct {
+	// Reason is recorded with every suppression of the rule, e.g. closed or contract.
+	Reason       string   `yaml:"reason"`
+	HotelIDs     []string `yaml:"hotel_ids"`
+	Destinations []int    `yaml:"destinations"`
+	Suppliers    []string `yaml:"suppliers"`
+	// Name, Images and Amenities are regular expressions matched against the hotel name, the image links
+	// and the amenities.
+	Name      string `yaml:"name"`
+	Images    string `yaml:"images"`
+	Amenities string `yaml:"amenities"`
+}
+
+// SuppressionRules returns the suppression rules of the configuration.
+func (s SuppressionConfig) SuppressionRules() []suppress.Rule {
+	rules := make([]suppress.Rule, 0, len(s.Rules))
+	for _, r := range s.Rules {
+		rules = append(rules, r.Rule())
+	}
+	return rules
+}
+
+// Rule returns the suppression rule of the configuration.
+func (r SuppressionRuleConfig) Rule() suppress.Rule {
+	return suppress.Rule{
+		Reason:       r.Reason,
+		HotelIDs:     r.HotelIDs,
+		Destinations: r.Destinations,
+		Suppliers:    r.Suppliers,
+		Name:         r.Name,
+		Images:       r.Images,
+		Amenities:    r.Amenities,
+	}
+}
+
+type ReloadConfig struct {
+	// WatchInterval is how often the configuration file is checked for changes, zero disables watching.
+	// The supplier configuration is also reloaded when the process receives SIGHUP.
+	WatchInterval time.Duration `yaml:"watch_interval"`
+}
+
+type FixturesConfig struct {
+	// Mode is off, record or replay. In record mode the supplier responses are saved to Dir,
+	// in replay mode they are served from Dir without any network.
+	Mode string `yaml:"mode"`
+	Dir  string `yaml:"dir"`
 }
 
 type SupplierConfig struct {
-	URL string `yaml:"url"`
+	// Kind is the supplier implementation used to fetch and parse the hotel data, see supplierKinds.
+	// It defaults to the name of the supplier.
+	Kind string `yaml:"kind"`
+	URL  string `yaml:"url"`
+	// Path is a local file or directory of files that the hotels are read from instead of URL, in the format of Kind.
+	Path string `yaml:"path"`
+	// Watch is the interval at which the files of Path are checked for changes. They are read once by default.
+	Watch time.Duration `yaml:"watch"`
+	// Timeout is the timeout of a single request to the supplier.
+	Timeout time.Duration `yaml:"timeout"`
+	// Disabled suppliers are not fetched from, but are kept in the configuration.
+	Disabled bool `yaml:"disabled"`
+	// Query holds the filters that the supplier API applies server-side. By default the full catalogue
+	// is fetched and filtered client-side.
+	Query QueryConfig `yaml:"query"`
+	// Faults are injected into the supplier for chaos testing. No fault is injected by default.
+	Faults FaultsConfig `yaml:"faults"`
+	// Auth authenticates the requests to the supplier. The requests are not authenticated by default.
+	Auth AuthConfig `yaml:"auth"`
+	// RateLimit limits the requests to the supplier. The requests are not limited by default.
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	// Budget bounds the duration of a fetch from the supplier, including its hedges. Zero means no budget
+	// besides the latency budget of the server.
+	Budget time.Duration `yaml:"budget"`
+	// Hedge starts duplicate fetches when a fetch is slower than usual. The fetches are not hedged by default.
+	Hedge HedgeConfig `yaml:"hedge"`
+	// Feed describes the records of a supplier of the Feed kind, whose data is XML or delimited text.
+	Feed FeedConfig `yaml:"feed"`
+	// Ingest lets the partner push its hotels to POST /ingest/<name> instead of being polled, in the format of Kind.
+	Ingest IngestConfig `yaml:"ingest"`
+}
+
+// QueryConfig holds the query-parameter templates of the filters that a supplier API applies server-side,
+// see supplier.Query for the placeholders.
+type QueryConfig struct {
+	HotelIDs    string `yaml:"hotel_ids"`
+	Destination string `yaml:"destination"`
+	// Page, Cursor and FollowLinks select the pagination style of the supplier, at most one can be set.
+	Page        string `yaml:"page"`
+	PageSize    int    `yaml:"page_size"`
+	Concurrency int    `yaml:"concurrency"`
+	Cursor      string `yaml:"cursor"`
+	NextCursor  string `yaml:"next_cursor"`
+	FollowLinks bool   `yaml:"follow_links"`
+	Records     string `yaml:"records"`
+}
+
+// Query returns the supplier query of the configuration.
+func (q QueryConfig) Query() supplier.Query {
+	return supplier.Query{
+		HotelIDs:    q.HotelIDs,
+		Destination: q.Destination,
+		Page:        q.Page,
+		PageSize:    q.PageSize,
+		Concurrency: q.Concurrency,
+		Cursor:      q.Cursor,
+		NextCursor:  q.NextCursor,
+		FollowLinks: q.FollowLinks,
+		Records:     q.Records,
+	}
+}
+
+// FaultsConfig configures the faults injected into a supplier, see the fault package.
+// The rates are probabilities between 0 and 1.
+type FaultsConfig struct {
+	// Seed makes the injected faults reproducible.
+	Seed         uint64        `yaml:"seed"`
+	Latency      time.Duration `yaml:"latency"`
+	Jitter       time.Duration `yaml:"jitter"`
+	ErrorRate    float64       `yaml:"error_rate"`
+	TimeoutRate  float64       `yaml:"timeout_rate"`
+	TruncateRate float64       `yaml:"truncate_rate"`
+	GarbleRate   float64       `yaml:"garble_rate"`
+	DropRate     float64       `yaml:"drop_rate"`
+}
+
+// Options returns the fault injection options of the configuration.
+func (f FaultsConfig) Options() fault.Options {
+	return fault.Options{
+		Seed:         f.Seed,
+		Latency:      f.Latency,
+		Jitter:       f.Jitter,
+		ErrorRate:    f.ErrorRate,
+		TimeoutRate:  f.TimeoutRate,
+		TruncateRate: f.TruncateRate,
+		GarbleRate:   f.GarbleRate,
+		DropRate:     f.DropRate,
+	}
+}
+
+// AuthConfig configures how the requests to a supplier are authenticated, see the auth package.
+// The secret is never in the configuration file, it is read from SecretEnv or SecretFile when the configuration is loaded.
+type AuthConfig struct {
+	// Type is none, api_key, basic, bearer, oauth2 or hmac.
+	Type string `yaml:"type"`
+	// Header is the header of the API key or of the HMAC signature, Param the query parameter of the API key.
+	Header   string `yaml:"header"`
+	Param    string `yaml:"param"`
+	Username string `yaml:"username"`
+	// TokenURL, ClientID and Scopes configure the OAuth2 client-credentials grant.
+	TokenURL   string   `yaml:"token_url"`
+	ClientID   string   `yaml:"client_id"`
+	Scopes     []string `yaml:"scopes"`
+	SecretEnv  string   `yaml:"secret_env"`
+	SecretFile string   `yaml:"secret_file"`
+	// Secret is loaded by LoadConfig. It is redacted when the configuration is logged.
+	Secret auth.Secret `yaml:"-"`
+}
+
+// Options returns the authentication options of the configuration.
+func (a AuthConfig) Options() auth.Options {
+	scheme, _ := auth.ParseScheme(a.Type)
+	return auth.Options{
+		Scheme:   scheme,
+		Header:   a.Header,
+		Param:    a.Param,
+		Username: a.Username,
+		Secret:   a.Secret,
+		TokenURL: a.TokenURL,
+		ClientID: a.ClientID,
+		Scopes:   a.Scopes,
+	}
+}
+
+// RateLimitConfig limits the requests to a supplier, see the ratelimit package. Zero values mean no limit.
+type RateLimitConfig struct {
+	// Rate is the number of requests per second. It is throttled down when the supplier answers 429.
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+	// MaxInFlight is the maximum number of concurrent requests to the supplier, across all the fetches.
+	MaxInFlight int `yaml:"max_in_flight"`
+}
+
+// Options returns the rate limiting options of the configuration.
+func (r RateLimitConfig) Options() ratelimit.Options {
+	return ratelimit.Options{
+		Rate:        r.Rate,
+		Burst:       r.Burst,
+		MaxInFlight: r.MaxInFlight,
+	}
+}
+
+// HedgeConfig configures the hedging of the fetches from a supplier, see the latency package.
+type HedgeConfig struct {
+	// Max is the maximum number of duplicate fetches, zero disables hedging.
+	Max int `yaml:"max"`
+	// Percentile of the recent latencies of the supplier after which a fetch is hedged, 0.95 by default.
+	Percentile float64       `yaml:"percentile"`
+	MinDelay   time.Duration `yaml:"min_delay"`
 }
 
-// LoadConfig reads and parses the YAML configuration from a file.
+// IngestConfig holds the key that the pushes of a partner are signed with, like the requests of the hmac auth type.
+// The supplier is fed by pushes if one of SecretEnv and SecretFile is set.
+type IngestConfig struct {
+	SecretEnv  string `yaml:"secret_env"`
+	SecretFile string `yaml:"secret_file"`
+	// Secret is loaded by LoadConfig. It is redacted when the configuration is logged.
+	Secret auth.Secret `yaml:"-"`
+}
+
+// Enabled reports whether the supplier is fed by pushes.
+func (i IngestConfig) Enabled() bool {
+	return i.SecretEnv != "" || i.SecretFile != ""
+}
+
+// FeedConfig describes how the records of an XML or delimited text feed map to hotels, see supplier.Feed.
+type FeedConfig struct {
+	// Format is xml, csv or tsv.
+	Format string `yaml:"format"`
+	// Record is the path of the element of each hotel in an XML feed, e.g. Hotels/Hotel.
+	Record        string `yaml:"record"`
+	Delimiter     string `yaml:"delimiter"`
+	ListSeparator string `yaml:"list_separator"`
+	// Fields maps the fields of the hotel, e.g. location.city, to the columns or XML paths of the feed.
+	Fields map[string]string `yaml:"fields"`
+}
+
+// Feed returns the feed description of the configuration.
+func (f FeedConfig) Feed() supplier.Feed {
+	return supplier.Feed{
+		Format:        supplier.FeedFormat(f.Format),
+		Record:        f.Record,
+		Delimiter:     f.Delimiter,
+		ListSeparator: f.ListSeparator,
+		Fields:        f.Fields,
+	}
+}
+
+// LatencyOptions returns the latency budget and hedging options of the supplier.
+func (s SupplierConfig) LatencyOptions() latency.Options {
+	return latency.Options{
+		Budget:     s.Budget,
+		MaxHedges:  s.Hedge.Max,
+		Percentile: s.Hedge.Percentile,
+		MinDelay:   s.Hedge.MinDelay,
+	}
+}
+
+// DefaultConfig returns the configuration used for any setting that is not in the configuration file.
+func DefaultConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Address:           "localhost:8080",
+			ReadHeaderTimeout: 2 * time.Second,
+			ReadTimeout:       5 * time.Second,
+			WriteTimeout:      5 * time.Second,
+			ShutdownTimeout:   2 * time.Second,
+		},
+		Cache: CacheConfig{
+			TTL:        defaultCacheTTL,
+			MaxEntries: 10000,
+			MaxBytes:   64 << 20, // 64 MiB
+			HTTPMaxAge: time.Minute,
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Reload: ReloadConfig{
+			WatchInterval: 5 * time.Second,
+		},
+		Fixtures: FixturesConfig{
+			Mode: string(fixture.Off),
+			Dir:  "testdata/fixtures",
+		},
+	}
+}
+
+// defaultSupplierTimeout is used for the suppliers that do not configure a timeout.
+const defaultSupplierTimeout = 2 * time.Second
+
+// LoadConfig reads and parses the YAML configuration from a file, applies the environment overrides and validates the result.
+// Unknown keys in the file are rejected. All the problems found are reported together.
 func LoadConfig(filename string) (*Config, error) {
-	var cfg Config
-	bytes, err := os.ReadFile(filename)
+	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	err = yaml.Unmarshal(bytes, &cfg)
-	if err != nil {
+	// the settings that cannot be decoded are reported with the other problems of the configuration
+	var parseErr error
+	cfg, err := parseConfig(data)
+	var typeErr *yaml.TypeError
+	switch {
+	case errors.As(err, &typeErr):
+		parseErr = fmt.Errorf("parse %s: %w", filename, err)
+	case err != nil:
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+
+	envErr := applyEnvOverrides(cfg, os.Environ())
+	applySupplierDefaults(cfg)
+	secretErr := loadSecrets(cfg)
+
+	if err := errors.Join(parseErr, envErr, secretErr, cfg.Validate()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// unwrapErrors returns the errors joined in err, or err itself if it does not join several errors.
+func unwrapErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// parseConfig parses the YAML configuration on top of the defaults, rejecting unknown keys.
+// If some settings cannot be decoded, a *yaml.TypeError is returned along with the rest of the configuration.
+func parseConfig(data []byte) (*Config, error) {
+	cfg := DefaultConfig()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(cfg)
+	var typeErr *yaml.TypeError
+	if err != nil && !errors.Is(err, io.EOF) && !errors.As(err, &typeErr) {
 		return nil, err
 	}
-	return &cfg, nil
+	applySupplierDefaults(cfg)
+	if typeErr != nil {
+		return cfg, typeErr
+	}
+	return cfg, nil
+}
+
+// applySupplierDefaults fills in the supplier settings that are not configured.
+func applySupplierDefaults(cfg *Config) {
+	for name, sCfg := range cfg.Suppliers {
+		if sCfg.Kind == "" {
+			sCfg.Kind = name
+		}
+		if sCfg.Timeout == 0 {
+			sCfg.Timeout = defaultSupplierTimeout
+		}
+		cfg.Suppliers[name] = sCfg
+	}
+}
+
+// loadSecrets reads the secrets of the suppliers from their environment variables or files.
+// The problems are reported as *FieldError, so that they are located like the validation errors.
+func loadSecrets(cfg *Config) error {
+	var errs []error
+	for _, name := range supplierNames(cfg) {
+		sCfg := cfg.Suppliers[name]
+		for _, secret := range []struct {
+			key       string
+			env, file string
+			target    *auth.Secret
+		}{
+			{"auth", sCfg.Auth.SecretEnv, sCfg.Auth.SecretFile, &sCfg.Auth.Secret},
+			{"ingest", sCfg.Ingest.SecretEnv, sCfg.Ingest.SecretFile, &sCfg.Ingest.Secret},
+		} {
+			if secret.env == "" && secret.file == "" {
+				continue
+			}
+			value, err := auth.LoadSecret(secret.env, secret.file)
+			if err != nil {
+				errs = append(errs, &FieldError{Path: "suppliers." + name + "." + secret.key, Message: "cannot load the secret: " + err.Error()})
+				continue
+			}
+			*secret.target = value
+		}
+		cfg.Suppliers[name] = sCfg
+	}
+	return errors.Join(errs...)
+}
+
+// applyEnvOverrides overrides the configuration with the MERGEHOTEL_* variables in environ.
+// Supplier settings use MERGEHOTEL_SUPPLIERS_<NAME>_<SETTING>, for example MERGEHOTEL_SUPPLIERS_ACME_URL,
+// where NAME is matched case-insensitively against the configured suppliers.
+// Like the unknown keys of the configuration file, the variables that are not settings are rejected, so that
+// a typo is not silently ignored. MERGEHOTEL_CONFIG and the variables named by secret_env are not settings.
+func applyEnvOverrides(cfg *Config, environ []string) error {
+	overrides := map[string]any{
+		"SERVER_ADDRESS":             &cfg.Server.Address,
+		"SERVER_READ_HEADER_TIMEOUT": &cfg.Server.ReadHeaderTimeout,
+		"SERVER_READ_TIMEOUT":        &cfg.Server.ReadTimeout,
+		"SERVER_WRITE_TIMEOUT":       &cfg.Server.WriteTimeout,
+		"SERVER_SHUTDOWN_TIMEOUT":    &cfg.Server.ShutdownTimeout,
+		"SERVER_LATENCY_BUDGET":      &cfg.Server.LatencyBudget,
+		"CACHE_TTL":                  &cfg.Cache.TTL,
+		"CACHE_MAX_ENTRIES":          &cfg.Cache.MaxEntries,
+		"CACHE_MAX_BYTES":            &cfg.Cache.MaxBytes,
+		"CACHE_HTTP_MAX_AGE":         &cfg.Cache.HTTPMaxAge,
+		"LOGGING_LEVEL":              &cfg.Logging.Level,
+		"LOGGING_FORMAT":             &cfg.Logging.Format,
+		"ADMIN_TOKEN":                &cfg.Admin.Token,
+		"RELOAD_WATCH_INTERVAL":      &cfg.Reload.WatchInterval,
+		"FIXTURES_MODE":              &cfg.Fixtures.Mode,
+		"FIXTURES_DIR":               &cfg.Fixtures.Dir,
+		"OVERRIDES_FILE":             &cfg.Overrides.File,
+	}
+
+	notSettings := map[string]bool{EnvPrefix + "CONFIG": true}
+	for _, sCfg := range cfg.Suppliers {
+		notSettings[sCfg.Auth.SecretEnv] = true
+		notSettings[sCfg.Ingest.SecretEnv] = true
+	}
+
+	var errs []error
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		name, ok := strings.CutPrefix(key, EnvPrefix)
+		if !ok || notSettings[key] {
+			continue
+		}
+
+		if supplierSetting, ok := strings.CutPrefix(name, "SUPPLIERS_"); ok {
+			if err := applySupplierEnvOverride(cfg, supplierSetting, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+			continue
+		}
+
+		target, ok := overrides[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown setting", key))
+			continue
+		}
+		if err := setFromEnv(target, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// applySupplierEnvOverride applies a supplier override such as ACME_URL, adding the supplier if it is not configured yet.
+func applySupplierEnvOverride(cfg *Config, setting, value string) error {
+	i := strings.LastIndex(setting, "_")
+	if i <= 0 {
+		return errors.New("expected SUPPLIERS_<NAME>_<SETTING>")
+	}
+	envName, field := setting[:i], setting[i+1:]
+
+	name := envName
+	for configured := range cfg.Suppliers {
+		if strings.EqualFold(configured, envName) {
+			name = configured
+			break
+		}
+	}
+	if cfg.Suppliers == nil {
+		cfg.Suppliers = make(map[string]SupplierConfig)
+	}
+
+	sCfg := cfg.Suppliers[name]
+	var err error
+	switch field {
+	case "KIND":
+		err = setFromEnv(&sCfg.Kind, value)
+	case "URL":
+		err = setFromEnv(&sCfg.URL, value)
+	case "PATH":
+		err = setFromEnv(&sCfg.Path, value)
+	case "WATCH":
+		err = setFromEnv(&sCfg.Watch, value)
+	case "TIMEOUT":
+		err = setFromEnv(&sCfg.Timeout, value)
+	case "DISABLED":
+		err = setFromEnv(&sCfg.Disabled, value)
+	default:
+		return fmt.Errorf("unknown supplier setting %q", field)
+	}
+	if err != nil {
+		return err
+	}
+	cfg.Suppliers[name] = sCfg
+	return nil
+}
+
+// setFromEnv parses the value of an environment variable into the target.
+func setFromEnv(target any, value string) error {
+	switch t := target.(type) {
+	case *string:
+		*t = value
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*t = d
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*t = n
+	case *int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*t = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*t = b
+	default:
+		return fmt.Errorf("unsupported setting type %T", target)
+	}
+	return nil
+}
+
+// FieldError is a validation error for a single setting of the configuration.
+type FieldError struct {
+	// Path is the dotted path of the setting in the configuration file, e.g. suppliers.Acme.url.
+	Path    string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks the configuration and returns all the problems found, joined into a single error.
+// Each problem is a *FieldError.
+func (cfg *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, path string, format string, args ...any) {
+		if !ok {
+			errs = append(errs, &FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	_, _, err := net.SplitHostPort(cfg.Server.Address)
+	check(err == nil, "server.address", "%q is not a valid host:port", cfg.Server.Address)
+	check(cfg.Server.ReadHeaderTimeout > 0, "server.read_header_timeout", "must be positive")
+	check(cfg.Server.ReadTimeout > 0, "server.read_timeout", "must be positive")
+	check(cfg.Server.WriteTimeout > 0, "server.write_timeout", "must be positive")
+	check(cfg.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+	check(cfg.Server.LatencyBudget >= 0, "server.latency_budget", "must not be negative")
+
+	check(cfg.Cache.TTL >= 0, "cache.ttl", "must not be negative")
+	check(cfg.Cache.MaxEntries >= 0, "cache.max_entries", "must not be negative")
+	check(cfg.Cache.MaxBytes >= 0, "cache.max_bytes", "must not be negative")
+	check(cfg.Cache.HTTPMaxAge >= 0, "cache.http_max_age", "must not be negative")
+	check(cfg.Reload.WatchInterval >= 0, "reload.watch_interval", "must not be negative")
+
+	_, err = zerolog.ParseLevel(cfg.Logging.Level)
+	check(err == nil && cfg.Logging.Level != "", "logging.level", "unknown level %q", cfg.Logging.Level)
+	check(cfg.Logging.Format == "json" || cfg.Logging.Format == "console",
+		"logging.format", "must be json or console, got %q", cfg.Logging.Format)
+
+	mode, err := fixture.ParseMode(cfg.Fixtures.Mode)
+	check(err == nil, "fixtures.mode", "must be off, record or replay, got %q", cfg.Fixtures.Mode)
+	check(mode == fixture.Off || cfg.Fixtures.Dir != "", "fixtures.dir", "must be set when fixtures are recorded or replayed")
+
+	for i, r := range cfg.Suppression.Rules {
+		// the problems of a rule are prefixed with their key in the rule configuration
+		if err := r.Rule().Validate(); err != nil {
+			for _, err := range unwrapErrors(err) {
+				key, message, _ := strings.Cut(err.Error(), ": ")
+				check(false, fmt.Sprintf("suppression.rules[%d].%s", i, key), "%s", message)
+			}
+		}
+	}
+
+	check(len(cfg.Suppliers) > 0, "suppliers", "at least one supplier must be configured")
+	for _, name := range supplierNames(cfg) {
+		sCfg := cfg.Suppliers[name]
+		path := "suppliers." + name
+		_, known := supplierKinds[sCfg.Kind]
+		check(known, path+".kind", "unknown supplier kind %q, must be one of %s", sCfg.Kind, strings.Join(knownSupplierKinds(), ", "))
+		switch {
+		case sCfg.Ingest.Enabled():
+			check(sCfg.URL == "" && sCfg.Path == "", path, "only one of url, path and ingest can be set")
+			check(sCfg.Ingest.SecretEnv == "" || sCfg.Ingest.SecretFile == "", path+".ingest", "only one of secret_env and secret_file can be set")
+		case sCfg.Path == "":
+			u, err := url.Parse(sCfg.URL)
+			check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+				path+".url", "%q is not a valid http(s) URL", sCfg.URL)
+		default:
+			check(sCfg.URL == "", path, "only one of url and path can be set")
+			_, err := os.Stat(sCfg.Path)
+			check(err == nil, path+".path", "cannot be read: %v", err)
+		}
+		check(sCfg.Watch >= 0, path+".watch", "must not be negative")
+		check(sCfg.Watch == 0 || sCfg.Path != "", path+".watch", "requires path")
+		check(sCfg.Timeout > 0, path+".timeout", "must be positive")
+		check(sCfg.Query.HotelIDs == "" || strings.Contains(sCfg.Query.HotelIDs, "{ids}"),
+			path+".query.hotel_ids", "must contain the {ids} placeholder")
+		check(sCfg.Query.Destination == "" || strings.Contains(sCfg.Query.Destination, "{destination}"),
+			path+".query.destination", "must contain the {destination} placeholder")
+		check(sCfg.Query.Page == "" || strings.Contains(sCfg.Query.Page, "{page}") || strings.Contains(sCfg.Query.Page, "{offset}"),
+			path+".query.page", "must contain the {page} or {offset} placeholder")
+		check(sCfg.Query.Page == "" || sCfg.Query.PageSize > 0, path+".query.page_size", "must be positive when page is set")
+		check(sCfg.Query.Concurrency >= 0, path+".query.concurrency", "must not be negative")
+		check(sCfg.Query.Cursor == "" || strings.Contains(sCfg.Query.Cursor, "{cursor}"),
+			path+".query.cursor", "must contain the {cursor} placeholder")
+		check(sCfg.Query.Cursor == "" || sCfg.Query.NextCursor != "" && sCfg.Query.Records != "",
+			path+".query.cursor", "requires next_cursor and records, the fields of the response holding the cursor and the records")
+		styles := 0
+		for _, set := range []bool{sCfg.Query.Page != "", sCfg.Query.Cursor != "", sCfg.Query.FollowLinks} {
+			if set {
+				styles++
+			}
+		}
+		check(styles <= 1, path+".query", "only one of page, cursor and follow_links can be set")
+		check(sCfg.Faults.Latency >= 0, path+".faults.latency", "must not be negative")
+		check(sCfg.Faults.Jitter >= 0, path+".faults.jitter", "must not be negative")
+		for _, rate := range []struct {
+			key   string
+			value float64
+		}{
+			{"error_rate", sCfg.Faults.ErrorRate},
+			{"timeout_rate", sCfg.Faults.TimeoutRate},
+			{"truncate_rate", sCfg.Faults.TruncateRate},
+			{"garble_rate", sCfg.Faults.GarbleRate},
+			{"drop_rate", sCfg.Faults.DropRate},
+		} {
+			check(rate.value >= 0 && rate.value <= 1, path+".faults."+rate.key, "must be between 0 and 1, got %v", rate.value)
+		}
+		scheme, err := auth.ParseScheme(sCfg.Auth.Type)
+		check(err == nil, path+".auth.type", "must be one of none, api_key, basic, bearer, oauth2 or hmac, got %q", sCfg.Auth.Type)
+		hasSecret := sCfg.Auth.SecretEnv != "" || sCfg.Auth.SecretFile != ""
+		check(sCfg.Auth.SecretEnv == "" || sCfg.Auth.SecretFile == "", path+".auth", "only one of secret_env and secret_file can be set")
+		check(err != nil || scheme == auth.None || hasSecret, path+".auth", "%s requires secret_env or secret_file", scheme)
+		check(scheme != auth.Basic || sCfg.Auth.Username != "", path+".auth.username", "must be set for basic auth")
+		if scheme == auth.OAuth2 {
+			u, err := url.Parse(sCfg.Auth.TokenURL)
+			check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+				path+".auth.token_url", "%q is not a valid http(s) URL", sCfg.Auth.TokenURL)
+			check(sCfg.Auth.ClientID != "", path+".auth.client_id", "must be set for oauth2")
+		}
+		check(sCfg.Auth.Param == "" || scheme == auth.APIKey, path+".auth.param", "only applies to api_key")
+		check(sCfg.RateLimit.Rate >= 0, path+".rate_limit.rate", "must not be negative")
+		check(sCfg.RateLimit.Burst >= 0, path+".rate_limit.burst", "must not be negative")
+		check(sCfg.RateLimit.Burst == 0 || sCfg.RateLimit.Rate > 0, path+".rate_limit.burst", "requires rate")
+		check(sCfg.RateLimit.MaxInFlight >= 0, path+".rate_limit.max_in_flight", "must not be negative")
+		check(sCfg.Budget >= 0, path+".budget", "must not be negative")
+		check(sCfg.Hedge.Max >= 0, path+".hedge.max", "must not be negative")
+		check(sCfg.Hedge.Percentile >= 0 && sCfg.Hedge.Percentile < 1, path+".hedge.percentile", "must be between 0 and 1, got %v", sCfg.Hedge.Percentile)
+		check(sCfg.Hedge.MinDelay >= 0, path+".hedge.min_delay", "must not be negative")
+		if sCfg.Kind == feedKind {
+			// the problems of the feed are prefixed with their key in the feed configuration
+			if err := sCfg.Feed.Feed().Validate(); err != nil {
+				for _, err := range unwrapErrors(err) {
+					key, message, _ := strings.Cut(err.Error(), ": ")
+					check(false, path+".feed."+key, "%s", message)
+				}
+			}
+			check(sCfg.Query.Cursor == "" && sCfg.Query.Records == "", path+".query", "cursor and records are not supported by feeds")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// supplierNames returns the sorted names of the configured suppliers, so that they are processed in a stable order.
+func supplierNames(cfg *Config) []string {
+	names := make([]string, 0, len(cfg.Suppliers))
+	for name := range cfg.Suppliers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setupLogging configures the global logger.
+func setupLogging(cfg LoggingConfig) {
+	level, err := zerolog.ParseLevel(cfg.Level)
+	if err == nil {
+		zerolog.SetGlobalLevel(level)
+	}
+	if cfg.Format == "console" {
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	}
 }
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"merge-hotel/supplier"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestApplyEnvOverrides(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Suppliers = map[string]SupplierConfig{"Acme": {URL: "http://acme.example"}}
+
+	err := applyEnvOverrides(cfg, []string{
+		"HOME=/root",
+		"MERGEHOTEL_SERVER_ADDRESS=:9090",
+		"MERGEHOTEL_CACHE_TTL=5m",
+		"MERGEHOTEL_CACHE_MAX_ENTRIES=10",
+		"MERGEHOTEL_SUPPLIERS_ACME_TIMEOUT=3s",
+		"MERGEHOTEL_SUPPLIERS_ACME_URL=http://acme.internal",
+	})
+	testutil.Ok(t, err)
+
+	testutil.Equals(t, ":9090", cfg.Server.Address)
+	testutil.Equals(t, 5*time.Minute, cfg.Cache.TTL)
+	testutil.Equals(t, 10, cfg.Cache.MaxEntries)
+	testutil.Equals(t, SupplierConfig{URL: "http://acme.internal", Timeout: 3 * time.Second}, cfg.Suppliers["Acme"])
+}
+
+func TestApplyEnvOverridesReportsAllErrors(t *testing.T) {
+	err := applyEnvOverrides(DefaultConfig(), []string{
+		"MERGEHOTEL_CACHE_TTL=soon",
+		"MERGEHOTEL_CACHE_MAX_ENTRIES=many",
+	})
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), "MERGEHOTEL_CACHE_TTL"), "missing TTL error: %v", err)
+	testutil.Assert(t, strings.Contains(err.Error(), "MERGEHOTEL_CACHE_MAX_ENTRIES"), "missing max entries error: %v", err)
+}
+
+func TestApplyEnvOverridesRejectsUnknownSettings(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Suppliers = map[string]SupplierConfig{"Direct": {Ingest: IngestConfig{SecretEnv: "MERGEHOTEL_DIRECT_KEY"}}}
+
+	err := applyEnvOverrides(cfg, []string{
+		"MERGEHOTEL_CONFIG=prod.yaml",
+		"MERGEHOTEL_DIRECT_KEY=secret",
+		"MERGEHOTEL_SERVER_ADRESS=:9090",
+		"MERGEHOTEL_SUPPLIERS_DIRECT_SECRET=secret",
+	})
+	testutil.NotOk(t, err)
+	testutil.Equals(t, "MERGEHOTEL_SERVER_ADRESS: unknown setting\n"+
+		`MERGEHOTEL_SUPPLIERS_DIRECT_SECRET: unknown supplier setting "SECRET"`, err.Error())
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Server.Address = "localhost"
+	cfg.Logging.Format = "xml"
+	cfg.Suppression.Rules = []SuppressionRuleConfig{{Reason: "closed", HotelIDs: []string{"SjyX"}}, {Images: "(broken"}}
+	cfg.Suppliers = map[string]SupplierConfig{"Acmee": {
+		Kind: "Acmee", URL: "not a url", Timeout: time.Second, Faults: FaultsConfig{DropRate: 1.5},
+		Query:     QueryConfig{Page: "page={page}", PageSize: 10, FollowLinks: true},
+		Auth:      AuthConfig{Type: "oauth2", TokenURL: "https://auth.example/token"},
+		RateLimit: RateLimitConfig{Burst: 5},
+	}, "Curated": {
+		Kind: "Acme", URL: "http://curated.example", Path: "testdata/missing", Timeout: time.Second, Watch: -time.Second,
+	}, "Direct": {
+		Kind: "Paperflies", URL: "http://direct.example", Timeout: time.Second,
+		Ingest: IngestConfig{SecretEnv: "DIRECT_KEY", SecretFile: "direct.key"},
+	}, "Hotelbeds": {
+		Kind: "Feed", URL: "http://hotelbeds.example", Timeout: time.Second,
+		Feed: FeedConfig{Format: "xml", Fields: map[string]string{"name": "Name", "stars": "@Rating"}},
+	}}
+
+	err := cfg.Validate()
+	testutil.NotOk(t, err)
+	testutil.Equals(t, []string{
+		`server.address: "localhost" is not a valid host:port`,
+		`logging.format: must be json or console, got "xml"`,
+		`suppression.rules[1].reason: must be set`,
+		"suppression.rules[1].images: error parsing regexp: missing closing ): `(broken`",
+		`suppliers.Acmee.kind: unknown supplier kind "Acmee", must be one of Acme, Feed, Paperflies, Patagonia`,
+		`suppliers.Acmee.url: "not a url" is not a valid http(s) URL`,
+		`suppliers.Acmee.query: only one of page, cursor and follow_links can be set`,
+		`suppliers.Acmee.faults.drop_rate: must be between 0 and 1, got 1.5`,
+		`suppliers.Acmee.auth: oauth2 requires secret_env or secret_file`,
+		`suppliers.Acmee.auth.client_id: must be set for oauth2`,
+		`suppliers.Acmee.rate_limit.burst: requires rate`,
+		`suppliers.Curated: only one of url and path can be set`,
+		`suppliers.Curated.path: cannot be read: stat testdata/missing: no such file or directory`,
+		`suppliers.Curated.watch: must not be negative`,
+		`suppliers.Direct: only one of url, path and ingest can be set`,
+		`suppliers.Direct.ingest: only one of secret_env and secret_file can be set`,
+		`suppliers.Hotelbeds.feed.fields: the id field must be mapped`,
+		`suppliers.Hotelbeds.feed.fields: unknown field "stars", must be one of ` + strings.Join(supplier.FeedFields, ", "),
+		`suppliers.Hotelbeds.feed.record: the path of the hotel elements must be set for xml`,
+	}, strings.Split(err.Error(), "\n"))
+}
+
+func TestLoadConfigRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	testutil.Ok(t, os.WriteFile(path, []byte("server:\n  adress: \":8080\"\n"), 0o600))
+
+	_, err := LoadConfig(path)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), "field adress not found"), "unexpected error: %v", err)
+}
+
+func TestLoadConfigReportsTypeErrorsWithOtherErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	testutil.Ok(t, os.WriteFile(path, []byte(`server:
+  read_timeout: soon
+cache:
+  max_entries: -1
+suppliers:
+  Acme:
+    url: "http://acme.example"
+`), 0o600))
+
+	_, err := LoadConfig(path)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), "cannot unmarshal !!str `soon`"), "expected the type error, got: %v", err)
+	testutil.Assert(t, strings.Contains(err.Error(), "cache.max_entries: must not be negative"), "expected the validation error, got: %v", err)
+}
+
+func TestUnwrapErrors(t *testing.T) {
+	first, second := errors.New("first"), errors.New("second")
+	testutil.Equals(t, []error{first, second}, unwrapErrors(errors.Join(first, second)))
+	testutil.Equals(t, []error{first}, unwrapErrors(first))
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	testutil.Ok(t, os.WriteFile(path, []byte("suppliers:\n  Acme:\n    url: \"http://acme.example\"\n"), 0o600))
+
+	cfg, err := LoadConfig(path)
+	testutil.Ok(t, err)
+	testutil.Equals(t, DefaultConfig().Server, cfg.Server)
+	testutil.Equals(t, defaultSupplierTimeout, cfg.Suppliers["Acme"].Timeout)
+}
+
+func TestLoadConfigLoadsSecrets(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	testutil.Ok(t, os.WriteFile(filepath.Join(dir, "password"), []byte("from-file\n"), 0o600))
+	t.Setenv("MERGEHOTEL_TEST_ACME_KEY", "from-env")
+	testutil.Ok(t, os.WriteFile(path, []byte(`suppliers:
+  Acme:
+    url: "http://acme.example"
+    auth:
+      type: api_key
+      secret_env: MERGEHOTEL_TEST_ACME_KEY
+  Patagonia:
+    url: "http://patagonia.example"
+    auth:
+      type: basic
+      username: merge-hotel
+      secret_file: `+filepath.Join(dir, "password")+`
+`), 0o600))
+
+	cfg, err := LoadConfig(path)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "from-env", cfg.Suppliers["Acme"].Auth.Secret.Reveal())
+	testutil.Equals(t, "from-file", cfg.Suppliers["Patagonia"].Auth.Secret.Reveal())
+
+	// the secrets are redacted when the configuration is logged
+	data, err := json.Marshal(cfg.Suppliers)
+	testutil.Ok(t, err)
+	testutil.Assert(t, !strings.Contains(string(data), "from-"), "secret leaked in %s", data)
+
+	testutil.Ok(t, os.Remove(filepath.Join(dir, "password")))
+	_, err = LoadConfig(path)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), "suppliers.Patagonia.auth: cannot load the secret"), "unexpected error: %v", err)
+}
+
+// TestConfigSchemaInSync checks that the published JSON Schema describes every setting of Config and every supplier kind.
+func TestConfigSchemaInSync(t *testing.T) {
+	data, err := os.ReadFile("config.schema.json")
+	testutil.Ok(t, err)
+	var schema map[string]any
+	testutil.Ok(t, json.Unmarshal(data, &schema))
+
+	defs := schema["$defs"].(map[string]any)
+	var checkProperties func(path string, typ reflect.Type, node map[string]any)
+	checkProperties = func(path string, typ reflect.Type, node map[string]any) {
+		properties, ok := node["properties"].(map[string]any)
+		testutil.Assert(t, ok, "%s: schema has no properties", path)
+		testutil.Equals(t, false, node["additionalProperties"], "%s: schema must reject unknown keys", path)
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if key == "-" {
+				// not read from the configuration file
+				continue
+			}
+			property, ok := properties[key].(map[string]any)
+			testutil.Assert(t, ok, "%s.%s: missing from the schema", path, key)
+			if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+				checkProperties(path+"."+key, field.Type, property)
+			}
+			if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct {
+				items := property["items"].(map[string]any)
+				if ref, ok := items["$ref"].(string); ok {
+					items = defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+				}
+				checkProperties(path+"."+key+"[]", field.Type.Elem(), items)
+			}
+		}
+	}
+	for i := 0; i < reflect.TypeOf(Config{}).NumField(); i++ {
+		field := reflect.TypeOf(Config{}).Field(i)
+		key := field.Tag.Get("yaml")
+		property, ok := schema["properties"].(map[string]any)[key].(map[string]any)
+		testutil.Assert(t, ok, "%s: missing from the schema", key)
+		if field.Type.Kind() == reflect.Struct {
+			checkProperties(key, field.Type, property)
+		}
+	}
+
+	supplierSchema := defs["supplier"].(map[string]any)
+	checkProperties("suppliers.*", reflect.TypeOf(SupplierConfig{}), supplierSchema)
+	var kinds []string
+	for _, kind := range supplierSchema["properties"].(map[string]any)["kind"].(map[string]any)["enum"].([]any) {
+		kinds = append(kinds, kind.(string))
+	}
+	sort.Strings(kinds)
+	testutil.Equals(t, knownSupplierKinds(), kinds)
+}
@@ -1,5 +1,10 @@
 package entity
 
+import (
+	"slices"
+	"time"
+)
+
 // Hotel represents the data model for a hotel.
 // This data model is based on the response format for our API.
 type Hotel struct {
@@ -11,6 +16,19 @@ type Hotel struct {
 	Amenities         Amenities `json:"amenities"`
 	Images            Images    `json:"images"`
 	BookingConditions []string  `json:"booking_conditions"`
+
+	// Provenance is internal bookkeeping and is not part of the API response.
+	Provenance Provenance `json:"-"`
+}
+
+// Provenance records where the data of a hotel came from.
+type Provenance struct {
+	// Suppliers are the names of the suppliers that contributed to the hotel data.
+	Suppliers []string
+	// Overrides are the IDs of the manual overrides applied to the hotel data, see the override package.
+	Overrides []string
+	// ModifiedAt is when the newest data of the suppliers or overrides contributing to the hotel was modified.
+	ModifiedAt time.Time
 }
 
 // Location represents the location details of a hotel.
@@ -41,3 +59,34 @@ type Image struct {
 	Link        string `json:"link"`
 	Description string `json:"description"`
 }
+
+// ApproximateSize returns an estimate of the memory used by the hotel data in bytes.
+// It counts the length of the string fields and ignores the overhead of the struct itself.
+func (h Hotel) ApproximateSize() int64 {
+	size := len(h.ID) + len(h.Name) + len(h.Description) +
+		len(h.Location.Address) + len(h.Location.City) + len(h.Location.Country)
+	for _, values := range [][]string{h.Amenities.General, h.Amenities.Room, h.BookingConditions} {
+		for _, value := range values {
+			size += len(value)
+		}
+	}
+	for _, images := range [][]Image{h.Images.Rooms, h.Images.Site, h.Images.Amenities} {
+		for _, image := range images {
+			size += len(image.Link) + len(image.Description)
+		}
+	}
+	return int64(size)
+}
+
+// Clone returns a deep copy of the hotel, which can be modified without affecting the original.
+func (h Hotel) Clone() Hotel {
+	h.Amenities.General = slices.Clone(h.Amenities.General)
+	h.Amenities.Room = slices.Clone(h.Amenities.Room)
+	h.Images.Rooms = slices.Clone(h.Images.Rooms)
+	h.Images.Site = slices.Clone(h.Images.Site)
+	h.Images.Amenities = slices.Clone(h.Images.Amenities)
+	h.BookingConditions = slices.Clone(h.BookingConditions)
+	h.Provenance.Suppliers = slices.Clone(h.Provenance.Suppliers)
+	h.Provenance.Overrides = slices.Clone(h.Provenance.Overrides)
+	return h
+}
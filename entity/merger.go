@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -58,6 +59,12 @@ func MergeHotelData(existingHotel Hotel, newHotel Hotel) Hotel {
 	// concatenate booking conditions
 	existingHotel.BookingConditions = append(existingHotel.BookingConditions, newHotel.BookingConditions...)
 
+	// keep track of every supplier that contributed to the hotel
+	existingHotel.Provenance.Suppliers = mergeSuppliers(existingHotel.Provenance.Suppliers, newHotel.Provenance.Suppliers)
+	if newHotel.Provenance.ModifiedAt.After(existingHotel.Provenance.ModifiedAt) {
+		existingHotel.Provenance.ModifiedAt = newHotel.Provenance.ModifiedAt
+	}
+
 	return existingHotel
 }
 
@@ -151,3 +158,14 @@ func mergeImages(existing, incoming []Image) []Image {
 
 	return mergedImages
 }
+
+// mergeSuppliers appends the incoming supplier names that are not in the existing list yet.
+func mergeSuppliers(existing, incoming []string) []string {
+	merged := append([]string{}, existing...)
+	for _, name := range incoming {
+		if !slices.Contains(merged, name) {
+			merged = append(merged, name)
+		}
+	}
+	return merged
+}
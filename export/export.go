@@ -0,0 +1,260 @@
+// Package export writes merged hotels in the formats used by bulk consumers: JSON, NDJSON and CSV.
+// Hotels are written one at a time, so that a large result never has to be buffered.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+
+	"merge-hotel/entity"
+)
+
+// Format is an output format for hotels.
+type Format string
+
+const (
+	// JSON writes the hotels as a single JSON array, like the /hotels endpoint.
+	JSON Format = "json"
+	// NDJSON writes one JSON hotel per line.
+	NDJSON Format = "ndjson"
+	// CSV writes one hotel per row, flattened into the selected columns.
+	CSV Format = "csv"
+)
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case JSON, NDJSON, CSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown format %q, must be one of json, ndjson or csv", name)
+	}
+}
+
+// ContentType returns the media type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case NDJSON:
+		return "application/x-ndjson"
+	case CSV:
+		return "text/csv; charset=utf-8"
+	default:
+		return "application/json; charset=utf-8"
+	}
+}
+
+// mediaTypes are the media types of an Accept header that select a format. The wildcards select the format
+// that the /hotels endpoint returns by default.
+var mediaTypes = map[string]Format{
+	"application/json":     JSON,
+	"application/x-ndjson": NDJSON,
+	"application/ndjson":   NDJSON,
+	"text/csv":             CSV,
+	"application/*":        JSON,
+	"text/*":               CSV,
+	"*/*":                  JSON,
+}
+
+// Negotiate returns the format preferred by an Accept header, the one of the media type with the highest quality,
+// a media type being preferred to a wildcard of the same quality. It returns JSON if the header is empty, and false
+// if none of the formats is acceptable.
+func Negotiate(accept string) (Format, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return JSON, true
+	}
+	var best Format
+	bestQuality, bestWildcard := 0.0, true
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		format, ok := mediaTypes[mediaType]
+		if !ok {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		wildcard := strings.Contains(mediaType, "*")
+		if quality > bestQuality || quality == bestQuality && quality > 0 && bestWildcard && !wildcard {
+			best, bestQuality, bestWildcard = format, quality, wildcard
+		}
+	}
+	return best, bestQuality > 0
+}
+
+// Writer writes hotels one at a time. Close must be called once all the hotels are written.
+type Writer interface {
+	Write(hotel entity.Hotel) error
+	Close() error
+}
+
+// NewWriter creates a Writer for the format. The columns are only used by CSV; if there are none, DefaultColumns are used.
+func NewWriter(w io.Writer, format Format, columns []string) (Writer, error) {
+	switch format {
+	case JSON:
+		return &jsonWriter{w: w}, nil
+	case NDJSON:
+		return &ndjsonWriter{encoder: json.NewEncoder(w)}, nil
+	case CSV:
+		return newCSVWriter(w, columns)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// jsonWriter writes a JSON array, element by element.
+type jsonWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (j *jsonWriter) Write(hotel entity.Hotel) error {
+	data, err := json.Marshal(hotel)
+	if err != nil {
+		return err
+	}
+	separator := ","
+	if !j.started {
+		separator = "["
+		j.started = true
+	}
+	if _, err := io.WriteString(j.w, separator); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	closing := "]\n"
+	if !j.started {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(j.w, closing)
+	return err
+}
+
+// ndjsonWriter writes one JSON document per line.
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(hotel entity.Hotel) error {
+	return n.encoder.Encode(hotel)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+// ListSeparator joins the values of list columns, such as amenities, in CSV.
+const ListSeparator = "|"
+
+// columnValues maps each CSV column to the function that extracts its value from a hotel.
+// Image columns contain the image links.
+var columnValues = map[string]func(hotel entity.Hotel) string{
+	"id":                 func(h entity.Hotel) string { return h.ID },
+	"destination_id":     func(h entity.Hotel) string { return strconv.Itoa(h.DestinationID) },
+	"name":               func(h entity.Hotel) string { return h.Name },
+	"location.lat":       func(h entity.Hotel) string { return strconv.FormatFloat(h.Location.Latitude, 'f', -1, 64) },
+	"location.lng":       func(h entity.Hotel) string { return strconv.FormatFloat(h.Location.Longitude, 'f', -1, 64) },
+	"location.address":   func(h entity.Hotel) string { return h.Location.Address },
+	"location.city":      func(h entity.Hotel) string { return h.Location.City },
+	"location.country":   func(h entity.Hotel) string { return h.Location.Country },
+	"description":        func(h entity.Hotel) string { return h.Description },
+	"amenities.general":  func(h entity.Hotel) string { return strings.Join(h.Amenities.General, ListSeparator) },
+	"amenities.room":     func(h entity.Hotel) string { return strings.Join(h.Amenities.Room, ListSeparator) },
+	"images.rooms":       func(h entity.Hotel) string { return joinImageLinks(h.Images.Rooms) },
+	"images.site":        func(h entity.Hotel) string { return joinImageLinks(h.Images.Site) },
+	"images.amenities":   func(h entity.Hotel) string { return joinImageLinks(h.Images.Amenities) },
+	"booking_conditions": func(h entity.Hotel) string { return strings.Join(h.BookingConditions, ListSeparator) },
+}
+
+// numericColumns are the CSV columns whose values are numbers, which are written as they are.
+var numericColumns = map[string]bool{"destination_id": true, "location.lat": true, "location.lng": true}
+
+// DefaultColumns are all the CSV columns, in the order of the JSON fields.
+var DefaultColumns = []string{
+	"id", "destination_id", "name",
+	"location.lat", "location.lng", "location.address", "location.city", "location.country",
+	"description", "amenities.general", "amenities.room",
+	"images.rooms", "images.site", "images.amenities", "booking_conditions",
+}
+
+// csvWriter writes a header row followed by one row per hotel.
+type csvWriter struct {
+	w             *csv.Writer
+	columns       []string
+	headerWritten bool
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	if len(columns) == 0 {
+		columns = DefaultColumns
+	}
+	for _, column := range columns {
+		if _, ok := columnValues[column]; !ok {
+			return nil, fmt.Errorf("unknown column %q, must be one of %s", column, strings.Join(DefaultColumns, ", "))
+		}
+	}
+	return &csvWriter{w: csv.NewWriter(w), columns: columns}, nil
+}
+
+func (c *csvWriter) Write(hotel entity.Hotel) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	row := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		row[i] = columnValues[column](hotel)
+		if !numericColumns[column] {
+			row[i] = neutraliseFormula(row[i])
+		}
+	}
+	return c.w.Write(row)
+}
+
+func (c *csvWriter) Close() error {
+	// the header is written even if there are no hotels
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.headerWritten {
+		return nil
+	}
+	c.headerWritten = true
+	return c.w.Write(c.columns)
+}
+
+// neutraliseFormula prefixes a text value that a spreadsheet would evaluate as a formula with a quote, so that
+// the values of the suppliers cannot run formulas when the export is opened in a spreadsheet.
+func neutraliseFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// joinImageLinks joins the links of the images into a single CSV value.
+func joinImageLinks(images []entity.Image) string {
+	links := make([]string, len(images))
+	for i, image := range images {
+		links[i] = image.Link
+	}
+	return strings.Join(links, ListSeparator)
+}
@@ -0,0 +1,112 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"merge-hotel/entity"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+var testHotels = []entity.Hotel{
+	{
+		ID:            "iJhz",
+		DestinationID: 5432,
+		Name:          "Beach Villas Singapore",
+		Location:      entity.Location{Latitude: 1.264751, Longitude: 103.824006, City: "Singapore"},
+		Amenities:     entity.Amenities{General: []string{"outdoor pool", "indoor pool"}, Room: []string{"tv"}},
+		Images: entity.Images{
+			Rooms: []entity.Image{{Link: "https://example.com/room.jpg", Description: "Double room"}},
+		},
+	},
+	{
+		ID:            "SjyX",
+		DestinationID: 5432,
+		Name:          "InterContinental, Singapore",
+	},
+}
+
+func writeAll(t *testing.T, format Format, columns []string, hotels []entity.Hotel) string {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format, columns)
+	testutil.Ok(t, err)
+	for _, hotel := range hotels {
+		testutil.Ok(t, w.Write(hotel))
+	}
+	testutil.Ok(t, w.Close())
+	return buf.String()
+}
+
+func TestJSONWriter(t *testing.T) {
+	testutil.Equals(t, "[]\n", writeAll(t, JSON, nil, nil))
+
+	out := writeAll(t, JSON, nil, testHotels[1:])
+	testutil.Equals(t, `[{"id":"SjyX","destination_id":5432,"name":"InterContinental, Singapore",`+
+		`"location":{"lat":0,"lng":0,"address":"","city":"","country":""},"description":"",`+
+		`"amenities":{"general":null,"room":null},"images":{"rooms":null,"site":null,"amenities":null},`+
+		`"booking_conditions":null}]`+"\n", out)
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	out := writeAll(t, NDJSON, nil, testHotels)
+	testutil.Equals(t, 2, bytes.Count([]byte(out), []byte("\n")))
+}
+
+func TestCSVWriter(t *testing.T) {
+	out := writeAll(t, CSV, []string{"id", "name", "location.lat", "amenities.general", "images.rooms"}, testHotels)
+	testutil.Equals(t, "id,name,location.lat,amenities.general,images.rooms\n"+
+		"iJhz,Beach Villas Singapore,1.264751,outdoor pool|indoor pool,https://example.com/room.jpg\n"+
+		"SjyX,\"InterContinental, Singapore\",0,,\n", out)
+
+	testutil.Equals(t, "id\n", writeAll(t, CSV, []string{"id"}, nil))
+
+	_, err := NewWriter(&bytes.Buffer{}, CSV, []string{"stars"})
+	testutil.NotOk(t, err)
+}
+
+func TestCSVWriterNeutralisesFormulas(t *testing.T) {
+	hotels := []entity.Hotel{{
+		ID:        "a",
+		Name:      `=HYPERLINK("https://evil.example","Beach Villas")`,
+		Location:  entity.Location{Latitude: -1.5, Address: "+65 Sentosa", City: "@Singapore"},
+		Amenities: entity.Amenities{General: []string{"-pool", "wifi"}},
+	}}
+	out := writeAll(t, CSV, []string{"name", "location.lat", "location.address", "location.city", "amenities.general"}, hotels)
+	testutil.Equals(t, "name,location.lat,location.address,location.city,amenities.general\n"+
+		`"'=HYPERLINK(""https://evil.example"",""Beach Villas"")",-1.5,'+65 Sentosa,'@Singapore,'-pool|wifi`+"\n", out)
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("NDJSON")
+	testutil.Ok(t, err)
+	testutil.Equals(t, NDJSON, format)
+
+	_, err = ParseFormat("xml")
+	testutil.NotOk(t, err)
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, tc := range []struct {
+		accept   string
+		expected Format
+		ok       bool
+	}{
+		{accept: "", expected: JSON, ok: true},
+		{accept: "*/*", expected: JSON, ok: true},
+		{accept: "text/csv", expected: CSV, ok: true},
+		{accept: "application/x-ndjson", expected: NDJSON, ok: true},
+		{accept: "application/json;q=0.5, text/csv;q=0.9", expected: CSV, ok: true},
+		{accept: "*/*, application/x-ndjson", expected: NDJSON, ok: true},
+		{accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", expected: JSON, ok: true},
+		{accept: "text/*", expected: CSV, ok: true},
+		{accept: "image/png", ok: false},
+		{accept: "text/csv;q=0", ok: false},
+	} {
+		t.Run(tc.accept, func(t *testing.T) {
+			format, ok := Negotiate(tc.accept)
+			testutil.Equals(t, tc.ok, ok)
+			testutil.Equals(t, tc.expected, format)
+		})
+	}
+}
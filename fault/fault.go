@@ -0,0 +1,220 @@
+// Package fault injects faults into the suppliers, to verify how the service behaves when suppliers misbehave.
+// The faults are drawn from seeded random sources, so that a chaos scenario can be replayed. Every fetch and request
+// has its own source, so that the faults do not depend on the order that concurrent fetches are scheduled in.
+package fault
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"merge-hotel/entity"
+	"merge-hotel/supplier"
+)
+
+// ErrInjected is returned by the fetches that fail because of an injected error.
+var ErrInjected = errors.New("injected supplier fault")
+
+// Options are the faults to inject. The rates are probabilities between 0 and 1.
+type Options struct {
+	// Seed makes the injected faults reproducible.
+	Seed uint64
+	// Latency is added to every fetch, plus a random duration up to Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+	// ErrorRate is the rate of fetches that fail with ErrInjected.
+	ErrorRate float64
+	// TimeoutRate is the rate of requests that hang until they time out.
+	TimeoutRate float64
+	// TruncateRate is the rate of responses whose body is cut short.
+	TruncateRate float64
+	// GarbleRate is the rate of responses whose body has random bytes overwritten.
+	GarbleRate float64
+	// DropRate is the rate of records dropped from the responses.
+	DropRate float64
+}
+
+// Enabled reports whether any fault is injected.
+func (o Options) Enabled() bool {
+	return o.Latency > 0 || o.Jitter > 0 || o.ErrorRate > 0 || o.TimeoutRate > 0 ||
+		o.TruncateRate > 0 || o.GarbleRate > 0 || o.DropRate > 0
+}
+
+// maxOperations bounds the number of operations whose runs are counted, as a search or URL may not come back.
+// When it is reached, the counts start again, so that the faults of a long-running scenario stay reproducible
+// but the memory used does not grow with every new search.
+const maxOperations = 10000
+
+// Injector draws the faults of a supplier. The faults that affect the fetch are injected by Supplier,
+// the faults that affect the HTTP exchange are injected by the RoundTripper returned by Transport.
+type Injector struct {
+	opts Options
+
+	mu   sync.Mutex        // guards runs
+	runs map[string]uint64 // how many times each operation ran, keyed by operation
+}
+
+// NewInjector creates an Injector for the options.
+func NewInjector(opts Options) *Injector {
+	return &Injector{opts: opts, runs: make(map[string]uint64)}
+}
+
+// source returns the random source of an operation, such as the fetch of a search or the request of a page.
+// It is derived from the seed, the operation and how many times the operation ran before, so that the faults
+// of an operation are the same whatever the operations run concurrently with it.
+func (i *Injector) source(operation string) draws {
+	i.mu.Lock()
+	run, ok := i.runs[operation]
+	if !ok && len(i.runs) >= maxOperations {
+		i.runs = make(map[string]uint64)
+	}
+	i.runs[operation] = run + 1
+	i.mu.Unlock()
+
+	h := fnv.New64a()
+	h.Write([]byte(operation))
+	h.Write(binary.BigEndian.AppendUint64(nil, run))
+	return draws{rand.New(rand.NewPCG(i.opts.Seed, h.Sum64()))}
+}
+
+// draws draws the faults of a single operation. It is not safe for concurrent use.
+type draws struct {
+	rand *rand.Rand
+}
+
+// chance returns true with the given probability.
+func (d draws) chance(rate float64) bool {
+	return rate > 0 && d.rand.Float64() < rate
+}
+
+// intN returns a random number in [0, n).
+func (d draws) intN(n int64) int64 {
+	return d.rand.Int64N(n)
+}
+
+// HotelSupplier is the supplier interface of the service.
+type HotelSupplier interface {
+	FetchHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error)
+	GetName() string
+}
+
+// Supplier wraps a HotelSupplier to add latency, fail fetches and drop records.
+type Supplier struct {
+	HotelSupplier
+	injector *Injector
+}
+
+// NewSupplier wraps the supplier with the faults of the injector.
+func NewSupplier(s HotelSupplier, injector *Injector) *Supplier {
+	return &Supplier{HotelSupplier: s, injector: injector}
+}
+
+// FetchHotels implements HotelSupplier.
+func (s *Supplier) FetchHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error) {
+	d := s.injector.source(fmt.Sprintf("fetch %q %d", hotelIDs, destinationID))
+	latency := s.injector.opts.Latency
+	if s.injector.opts.Jitter > 0 {
+		latency += time.Duration(d.intN(int64(s.injector.opts.Jitter)))
+	}
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if d.chance(s.injector.opts.ErrorRate) {
+		return nil, ErrInjected
+	}
+
+	hotels, err := s.HotelSupplier.FetchHotels(ctx, hotelIDs, destinationID)
+	if err != nil || s.injector.opts.DropRate <= 0 {
+		return hotels, err
+	}
+	kept := hotels[:0:0]
+	for _, hotel := range hotels {
+		if !d.chance(s.injector.opts.DropRate) {
+			kept = append(kept, hotel)
+		}
+	}
+	return kept, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped supplier, if it supports it.
+func (s *Supplier) CloseIdleConnections() {
+	if closer, ok := s.HotelSupplier.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// Capabilities returns the filters that the wrapped supplier applies server-side, if it declares them.
+func (s *Supplier) Capabilities() supplier.Capabilities {
+	if capable, ok := s.HotelSupplier.(interface{ Capabilities() supplier.Capabilities }); ok {
+		return capable.Capabilities()
+	}
+	return supplier.Capabilities{}
+}
+
+// Transport returns a RoundTripper that makes requests hang until they time out, and truncates or garbles
+// the response bodies of next.
+func (i *Injector) Transport(next http.RoundTripper) http.RoundTripper {
+	return &transport{injector: i, next: next}
+}
+
+type transport struct {
+	injector *Injector
+	next     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	opts := t.injector.opts
+	d := t.injector.source(req.Method + " " + req.URL.String())
+	if d.chance(opts.TimeoutRate) {
+		// the request is cancelled by the timeout of the client, or by the caller
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil || opts.TruncateRate <= 0 && opts.GarbleRate <= 0 {
+		return res, err
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) > 0 && d.chance(opts.TruncateRate) {
+		body = body[:d.intN(int64(len(body)))]
+	}
+	if len(body) > 0 && d.chance(opts.GarbleRate) {
+		body = d.garble(body)
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.Header.Del("Content-Length")
+	return res, nil
+}
+
+// garble overwrites a few random bytes of the body with JSON delimiters, so that it is no longer valid JSON.
+func (d draws) garble(body []byte) []byte {
+	garbled := bytes.Clone(body)
+	for n := 1 + len(garbled)/100; n > 0; n-- {
+		garbled[d.intN(int64(len(garbled)))] = "{}[],:\""[d.intN(7)]
+	}
+	if json.Valid(garbled) {
+		// the overwritten bytes happened to keep the body valid, cut it instead
+		garbled = garbled[:len(garbled)-1]
+	}
+	return garbled
+}
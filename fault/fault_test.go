@@ -0,0 +1,117 @@
+package fault_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"merge-hotel/entity"
+	"merge-hotel/fault"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+type staticSupplier []entity.Hotel
+
+func (s staticSupplier) FetchHotels(context.Context, []string, int) ([]entity.Hotel, error) {
+	return s, nil
+}
+
+func (s staticSupplier) GetName() string {
+	return "static"
+}
+
+func hotels(n int) staticSupplier {
+	var s staticSupplier
+	for i := 0; i < n; i++ {
+		s = append(s, entity.Hotel{ID: string(rune('a' + i))})
+	}
+	return s
+}
+
+func TestSupplierInjectsErrors(t *testing.T) {
+	s := fault.NewSupplier(hotels(3), fault.NewInjector(fault.Options{ErrorRate: 1}))
+	_, err := s.FetchHotels(context.Background(), nil, -1)
+	testutil.Assert(t, errors.Is(err, fault.ErrInjected), "expected injected error, got %v", err)
+}
+
+func TestSupplierDropsRecordsDeterministically(t *testing.T) {
+	fetch := func(seed uint64) []entity.Hotel {
+		s := fault.NewSupplier(hotels(20), fault.NewInjector(fault.Options{Seed: seed, DropRate: 0.5}))
+		var all []entity.Hotel
+		for i := 0; i < 3; i++ {
+			got, err := s.FetchHotels(context.Background(), nil, -1)
+			testutil.Ok(t, err)
+			all = append(all, got...)
+		}
+		return all
+	}
+
+	first := fetch(7)
+	testutil.Assert(t, len(first) > 0 && len(first) < 60, "expected some records to be dropped, got %d", len(first))
+	testutil.Equals(t, first, fetch(7))
+}
+
+func TestSupplierFaultsDoNotDependOnOrder(t *testing.T) {
+	fetch := func(s *fault.Supplier, hotelIDs []string) []entity.Hotel {
+		got, err := s.FetchHotels(context.Background(), hotelIDs, -1)
+		testutil.Ok(t, err)
+		return got
+	}
+	newSupplier := func() *fault.Supplier {
+		return fault.NewSupplier(hotels(20), fault.NewInjector(fault.Options{Seed: 7, DropRate: 0.5}))
+	}
+
+	// the faults of a search are the same whichever search runs first
+	s := newSupplier()
+	all, some := fetch(s, nil), fetch(s, []string{"a"})
+	s = newSupplier()
+	testutil.Equals(t, some, fetch(s, []string{"a"}))
+	testutil.Equals(t, all, fetch(s, nil))
+}
+
+func TestSupplierLatencyRespectsContext(t *testing.T) {
+	s := fault.NewSupplier(hotels(1), fault.NewInjector(fault.Options{Latency: time.Hour}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := s.FetchHotels(ctx, nil, -1)
+	testutil.Assert(t, errors.Is(err, context.DeadlineExceeded), "expected deadline exceeded, got %v", err)
+}
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `[{"id":"a","name":"Beach Villas"},{"id":"b","name":"Grand Hotel"}]`)
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name string
+		opts fault.Options
+	}{
+		{name: "truncate", opts: fault.Options{TruncateRate: 1}},
+		{name: "garble", opts: fault.Options{GarbleRate: 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &http.Client{Transport: fault.NewInjector(tc.opts).Transport(http.DefaultTransport)}
+			res, err := client.Get(srv.URL)
+			testutil.Ok(t, err)
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			testutil.Ok(t, err)
+			testutil.Assert(t, !json.Valid(body), "expected an invalid body, got %s", body)
+		})
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		injector := fault.NewInjector(fault.Options{TimeoutRate: 1})
+		client := &http.Client{Transport: injector.Transport(http.DefaultTransport), Timeout: 10 * time.Millisecond}
+		_, err := client.Get(srv.URL)
+		testutil.NotOk(t, err)
+	})
+}
@@ -0,0 +1,213 @@
+// Package fixture records the responses of the supplier APIs to files and replays them,
+// so that the whole service can be tested deterministically without the live supplier APIs.
+package fixture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mode selects what the Transport does with the requests.
+type Mode string
+
+const (
+	// Off sends the requests to the network as usual.
+	Off Mode = "off"
+	// Record sends the requests to the network and saves the responses to fixture files.
+	Record Mode = "record"
+	// Replay serves the responses from the fixture files, without any network.
+	Replay Mode = "replay"
+)
+
+// ParseMode returns the mode with the given name. An empty name means Off.
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(name); mode {
+	case "":
+		return Off, nil
+	case Off, Record, Replay:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown fixture mode %q, must be one of off, record or replay", name)
+	}
+}
+
+// Fixture is a recorded response, as saved in a fixture file.
+type Fixture struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	// Body is the response body if it is JSON, which keeps the fixture files readable and diffable.
+	Body json.RawMessage `json:"body,omitempty"`
+	// BodyText is the response body if it is text but not JSON.
+	BodyText string `json:"body_text,omitempty"`
+	// BodyBinary is the response body if it is neither, e.g. a compressed body. It is saved in base64.
+	BodyBinary []byte `json:"body_binary,omitempty"`
+}
+
+// Transport is an http.RoundTripper that records or replays the responses, depending on its mode.
+// There is one fixture file per method and URL in Dir. The 304 Not Modified responses are not recorded.
+type Transport struct {
+	Mode Mode
+	Dir  string
+	// Next is used to send the requests in Off and Record modes. It defaults to http.DefaultTransport.
+	Next http.RoundTripper
+}
+
+// NewTransport creates a Transport that wraps next.
+func NewTransport(mode Mode, dir string, next http.RoundTripper) *Transport {
+	return &Transport{Mode: mode, Dir: dir, Next: next}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch t.Mode {
+	case Replay:
+		return t.replay(req)
+	case Record:
+		return t.record(req)
+	default:
+		return t.next().RoundTrip(req)
+	}
+}
+
+// Path returns the path of the fixture file for the request.
+func (t *Transport) Path(req *http.Request) string {
+	return filepath.Join(t.Dir, Name(req.Method, req.URL.String()))
+}
+
+func (t *Transport) next() http.RoundTripper {
+	if t.Next != nil {
+		return t.Next
+	}
+	return http.DefaultTransport
+}
+
+// replay serves the response from the fixture file of the request.
+func (t *Transport) replay(req *http.Request) (*http.Response, error) {
+	path := t.Path(req)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no fixture for %s %s: %w", req.Method, req.URL, err)
+	}
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+
+	var body []byte
+	switch {
+	case len(f.Body) > 0:
+		body = f.Body
+	case len(f.BodyBinary) > 0:
+		body = f.BodyBinary
+	default:
+		body = []byte(f.BodyText)
+	}
+	// the header keys are canonicalised in case the fixture file was edited by hand
+	header := make(http.Header)
+	for key, values := range f.Header {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// record sends the request and saves the response to the fixture file of the request.
+func (t *Transport) record(req *http.Request) (*http.Response, error) {
+	res, err := t.next().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	// a 304 Not Modified answers a conditional request, which replay cannot tell apart from the first request
+	// of the page, so it would replace the recorded page with an empty response
+	if res.StatusCode == http.StatusNotModified {
+		return res, nil
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	// the body has been consumed, so the caller gets a copy
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	f := Fixture{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: res.StatusCode,
+		Header: recordedHeader(res.Header),
+	}
+	switch {
+	case json.Valid(body):
+		f.Body = body
+	case utf8.Valid(body):
+		f.BodyText = string(body)
+	default:
+		f.BodyBinary = body
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(t.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(t.Path(req), append(data, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("record fixture for %s %s: %w", req.Method, req.URL, err)
+	}
+	return res, nil
+}
+
+// recordedHeaders are the response headers worth keeping in the fixtures. Headers that change on every request,
+// such as Date, are left out so that re-recording an unchanged response does not change the fixture file.
+var recordedHeaders = []string{"Content-Type", "Content-Encoding", "ETag", "Last-Modified", "Cache-Control", "Link"}
+
+// recordedHeader returns the recorded subset of the response header.
+func recordedHeader(header http.Header) http.Header {
+	recorded := make(http.Header)
+	for _, key := range recordedHeaders {
+		if values := header.Values(key); len(values) > 0 {
+			recorded[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	return recorded
+}
+
+// unsafeChars matches the characters that are replaced in fixture file names.
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Name returns the fixture file name for a method and URL, e.g. GET_example.com_suppliers_acme.json.
+// URLs with a query string get a hash of the query as a suffix, so that every query has its own fixture.
+func Name(method, rawURL string) string {
+	base, query, _ := strings.Cut(rawURL, "?")
+	base = strings.TrimPrefix(strings.TrimPrefix(base, "https://"), "http://")
+	name := method + "_" + strings.Trim(unsafeChars.ReplaceAllString(base, "_"), "_")
+	if query != "" {
+		sum := sha256.Sum256([]byte(query))
+		name += "_" + hex.EncodeToString(sum[:4])
+	}
+	return name + ".json"
+}
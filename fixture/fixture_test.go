@@ -0,0 +1,108 @@
+package fixture
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	res, err := client.Get(url)
+	testutil.Ok(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	testutil.Ok(t, err)
+	return res.StatusCode, string(body)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, `[ {"id": "`+r.URL.Query().Get("id")+`"} ]`)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	recorder := &http.Client{Transport: NewTransport(Record, dir, nil)}
+	status, body := get(t, recorder, server.URL+"/hotels?id=a")
+	testutil.Equals(t, http.StatusOK, status)
+	testutil.Equals(t, `[ {"id": "a"} ]`, body)
+	testutil.Equals(t, 1, requests)
+
+	// the server is no longer needed to replay the recorded response
+	server.Close()
+	replayer := &http.Client{Transport: NewTransport(Replay, dir, nil)}
+	res, err := replayer.Get(server.URL + "/hotels?id=a")
+	testutil.Ok(t, err)
+	// JSON bodies are indented in the fixture files, so they are compared by value
+	var replayed []map[string]string
+	testutil.Ok(t, json.NewDecoder(res.Body).Decode(&replayed))
+	testutil.Equals(t, []map[string]string{{"id": "a"}}, replayed)
+	testutil.Equals(t, `"v1"`, res.Header.Get("ETag"))
+
+	// a request that was never recorded fails
+	_, err = replayer.Get(server.URL + "/hotels?id=b")
+	testutil.NotOk(t, err)
+}
+
+func TestRecordKeepsRevalidatedResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, "page 1")
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	recorder := &http.Client{Transport: NewTransport(Record, dir, nil)}
+	status, _ := get(t, recorder, server.URL+"/hotels")
+	testutil.Equals(t, http.StatusOK, status)
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/hotels", nil)
+	testutil.Ok(t, err)
+	req.Header.Set("If-None-Match", `"v1"`)
+	res, err := recorder.Do(req)
+	testutil.Ok(t, err)
+	res.Body.Close()
+	testutil.Equals(t, http.StatusNotModified, res.StatusCode)
+
+	// the revalidation does not replace the recorded page
+	status, body := get(t, &http.Client{Transport: NewTransport(Replay, dir, nil)}, server.URL+"/hotels")
+	testutil.Equals(t, http.StatusOK, status)
+	testutil.Equals(t, "page 1", body)
+}
+
+func TestReplayBinaryBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte{0x1f, 0x8b, 0xff})
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	_, body := get(t, &http.Client{Transport: NewTransport(Record, dir, nil)}, server.URL)
+	_, replayed := get(t, &http.Client{Transport: NewTransport(Replay, dir, nil)}, server.URL)
+	testutil.Equals(t, body, replayed)
+}
+
+func TestName(t *testing.T) {
+	testutil.Equals(t, "GET_example.com_suppliers_acme.json", Name(http.MethodGet, "https://example.com/suppliers/acme"))
+	testutil.Equals(t, "GET_127.0.0.1_8080_hotels_59ed5f1a.json", Name(http.MethodGet, "http://127.0.0.1:8080/hotels?id=a"))
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode("")
+	testutil.Ok(t, err)
+	testutil.Equals(t, Off, mode)
+
+	_, err = ParseMode("rewind")
+	testutil.NotOk(t, err)
+}
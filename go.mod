@@ -3,12 +3,13 @@ module merge-hotel
 go 1.22.0
 
 require (
+	github.com/andybalholm/brotli v1.2.0
 	github.com/carlmjohnson/requests v0.23.5
 	github.com/efficientgo/core v1.0.0-rc.2
 	github.com/gin-gonic/gin v1.9.1
-	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/rs/zerolog v1.32.0
 	github.com/sourcegraph/conc v0.3.0
+	golang.org/x/time v0.5.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -2,13 +2,22 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
 
 	"merge-hotel/entity"
+	"merge-hotel/export"
 )
 
 const (
@@ -16,30 +25,242 @@ const (
 	ErrInvalidDestinationID = "Invalid destination ID. Destination ID must be a non-negative integer."
 	// ErrInternalServerError is returned when an internal server error occurs.
 	ErrInternalServerError = "Internal server error. Please try again later or contact support."
-	// ErrNoHotelsFound is returned when no hotels are found.
-	ErrNoHotelsFound = "No hotels found."
+	// ErrRouteNotFound is returned when no endpoint matches the path of the request.
+	ErrRouteNotFound = "Not found. See the API documentation for the endpoints."
+	// ErrSuppliersUnavailable is returned when a search has no hotels because suppliers failed.
+	ErrSuppliersUnavailable = "The suppliers are unavailable. Please try again later."
+	// ErrSuppliersTimeout is returned when a search has no hotels because suppliers did not answer in time.
+	ErrSuppliersTimeout = "The suppliers did not answer in time. Please try again later."
+	// ErrNotAcceptable is returned when the Accept header does not accept any of the formats of the hotels.
+	ErrNotAcceptable = "Not acceptable. The hotels are available as application/json, application/x-ndjson or text/csv."
 )
 
+// HeaderMissingSuppliers lists the suppliers missing from a partial result, separated by commas.
+const HeaderMissingSuppliers = "X-Missing-Suppliers"
+
 type Usecase interface {
 	// GetHotels returns a slice of Hotels for the given hotelIDs and destinationID.
 	// If you do not want to filter by destinationID, set it to -1.
 	// If both are provided, only hotels for the destinationID are returned.
 	// If neither are provided, all hotels are returned.
-	// If there is no matching hotel, it returns an empty slice.
-	GetHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error)
+	// If there is no matching hotel, the result has no hotels.
+	// The result is partial if some suppliers failed or did not answer within the latency budget.
+	GetHotels(ctx context.Context, hotelIDs []string, destinationID int) (SearchResult, error)
 }
 
 type Handler struct {
 	hotelService Usecase
+	maxAge       time.Duration
 }
 
-func NewHandler(hotels Usecase) *Handler {
+// NewHandler creates a new Handler. Clients are allowed to cache the responses for the duration of maxAge.
+func NewHandler(hotels Usecase, maxAge time.Duration) *Handler {
 	return &Handler{
 		hotelService: hotels,
+		maxAge:       maxAge,
 	}
 }
 
 func (h *Handler) GetHotels(c *gin.Context) {
+	// the hotels are returned as a JSON array by default, or streamed as NDJSON or CSV
+	c.Header("Vary", "Accept")
+	format, columns, ok := parseFormat(c, "")
+	if !ok {
+		return
+	}
+	hotelIDs, destinationID, ok := parseSearch(c)
+	if !ok {
+		return
+	}
+
+	result, ok := h.search(c, hotelIDs, destinationID)
+	if !ok {
+		return
+	}
+	if notModified(c, format, columns, result) {
+		return
+	}
+
+	if format == export.JSON {
+		hotels := result.Hotels
+		if hotels == nil {
+			// a search without hotels is an empty array
+			hotels = []entity.Hotel{}
+		}
+		c.JSON(http.StatusOK, hotels)
+		return
+	}
+	streamHotels(c, format, columns, result.Hotels)
+}
+
+// Export streams the hotels of a search to bulk consumers, as NDJSON by default, or as CSV or a JSON array.
+func (h *Handler) Export(c *gin.Context) {
+	c.Header("Vary", "Accept")
+	format, columns, ok := parseFormat(c, export.NDJSON)
+	if !ok {
+		return
+	}
+	hotelIDs, destinationID, ok := parseSearch(c)
+	if !ok {
+		return
+	}
+
+	result, ok := h.search(c, hotelIDs, destinationID)
+	if !ok {
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=hotels.%s", format))
+	if notModified(c, format, columns, result) {
+		return
+	}
+	streamHotels(c, format, columns, result.Hotels)
+}
+
+// search runs the search and sets the headers of its result. It aborts the request and returns false if the search
+// failed, or if it has no hotels because suppliers are missing, as the hotels may exist then.
+func (h *Handler) search(c *gin.Context, hotelIDs []string, destinationID int) (SearchResult, bool) {
+	result, err := h.hotelService.GetHotels(c, hotelIDs, destinationID)
+	if err != nil {
+		log.Error().Err(err).Str("request_id", c.GetString(requestIDKey)).Msg("Failed to search hotels")
+		abortWithProblem(c, http.StatusInternalServerError, CodeInternalError, ErrInternalServerError)
+		return SearchResult{}, false
+	}
+	h.setResultHeaders(c, result)
+
+	if len(result.Hotels) == 0 && result.Partial() {
+		timedOut := !slices.ContainsFunc(result.Missing, func(m MissingSupplier) bool { return !m.TimedOut() })
+		if timedOut {
+			abortWithProblem(c, http.StatusGatewayTimeout, CodeSuppliersTimeout, ErrSuppliersTimeout)
+		} else {
+			abortWithProblem(c, http.StatusBadGateway, CodeSuppliersUnavailable, ErrSuppliersUnavailable)
+		}
+		return SearchResult{}, false
+	}
+	return result, true
+}
+
+// setResultHeaders reports the suppliers missing from a partial result, and sets how long clients can cache the result.
+func (h *Handler) setResultHeaders(c *gin.Context, result SearchResult) {
+	// report the suppliers missing from a partial result, which must not be cached as it may be incomplete
+	if result.Partial() {
+		names := make([]string, len(result.Missing))
+		for i, missing := range result.Missing {
+			names[i] = missing.Name
+		}
+		c.Header(HeaderMissingSuppliers, strings.Join(names, ", "))
+	}
+
+	// Set Cache-Control headers
+	if result.Partial() {
+		c.Header("Cache-Control", "no-store")
+	} else {
+		c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(h.maxAge.Seconds())))
+	}
+}
+
+// notModified sets the validators of the hotels of the result, and answers 304 Not Modified if the client has them
+// already, per If-None-Match or, if it is not sent, If-Modified-Since. The hotels are sorted by ID, so that the same
+// hotels are always written the same way. A partial result has no validators, as it must not be reused.
+func notModified(c *gin.Context, format export.Format, columns []string, result SearchResult) bool {
+	slices.SortFunc(result.Hotels, func(a, b entity.Hotel) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	if result.Partial() {
+		return false
+	}
+
+	etag, lastModified := validators(format, columns, result.Hotels)
+	c.Header("ETag", etag)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+
+	var match bool
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		match = etagMatches(ifNoneMatch, etag)
+	} else if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil && !lastModified.IsZero() {
+		match = !lastModified.After(since)
+	}
+	if match {
+		c.AbortWithStatus(http.StatusNotModified)
+	}
+	return match
+}
+
+// validators returns the strong ETag of the hotels written in the format, a hash of their canonical JSON and of the
+// format and columns, and the time the newest of them was modified at, in the precision of HTTP dates.
+func validators(format export.Format, columns []string, hotels []entity.Hotel) (string, time.Time) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n", format, strings.Join(columns, ","))
+	encoder := json.NewEncoder(hash)
+	var lastModified time.Time
+	for _, hotel := range hotels {
+		// the JSON of a hotel always encodes, as it only holds strings and numbers
+		_ = encoder.Encode(hotel)
+		if hotel.Provenance.ModifiedAt.After(lastModified) {
+			lastModified = hotel.Provenance.ModifiedAt
+		}
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`, lastModified.UTC().Truncate(time.Second)
+}
+
+// etagMatches reports whether an If-None-Match header matches the ETag, using the weak comparison.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFormat returns the format of the response, selected by the format query parameter or negotiated with the
+// Accept header, and the CSV columns of the columns query parameter. The format is def if it is set and the Accept
+// header does not name a format. It aborts the request and returns false if the format or columns are invalid.
+func parseFormat(c *gin.Context, def export.Format) (export.Format, []string, bool) {
+	format, accept := def, c.GetHeader("Accept")
+	switch name := c.Query("format"); {
+	case name != "":
+		var err error
+		if format, err = export.ParseFormat(name); err != nil {
+			abortWithInvalidParam(c, "format", err.Error())
+			return "", nil, false
+		}
+	case def != "" && (accept == "" || accept == "*/*"):
+		// the Accept header does not name a format, so the default format of the endpoint is used
+	default:
+		var ok bool
+		if format, ok = export.Negotiate(accept); !ok {
+			abortWithProblem(c, http.StatusNotAcceptable, CodeNotAcceptable, ErrNotAcceptable)
+			return "", nil, false
+		}
+	}
+
+	var columns []string
+	if value := c.Query("columns"); value != "" {
+		columns = strings.Split(value, ",")
+	}
+	// the columns are checked before searching, as the response cannot be changed to an error once it is streamed
+	if _, err := export.NewWriter(io.Discard, format, columns); err != nil {
+		abortWithInvalidParam(c, "columns", err.Error())
+		return "", nil, false
+	}
+	return format, columns, true
+}
+
+// streamHotels writes the hotels in the format, one at a time, so that the response is not buffered as a whole.
+func streamHotels(c *gin.Context, format export.Format, columns []string, hotels []entity.Hotel) {
+	c.Header("Content-Type", format.ContentType())
+	c.Status(http.StatusOK)
+	if err := writeHotels(c.Writer, format, columns, hotels); err != nil {
+		// the status is sent already, so the client sees a truncated response
+		log.Error().Err(err).Str("format", string(format)).Msg("Failed to stream hotels")
+	}
+}
+
+// parseSearch parses the query parameters of a search. It aborts the request and returns false if they are invalid.
+func parseSearch(c *gin.Context) ([]string, int, bool) {
 	// there are two optional query parameters: ids and destination_id
 	// hotels is a comma-separated list of hotel IDs to retrieve
 	// destination is the ID of the destination to retrieve hotels for
@@ -57,31 +278,15 @@ func (h *Handler) GetHotels(c *gin.Context) {
 	}
 
 	// parse the destination ID
-	var destinationID int
-	var err error
+	destinationID := -1
 	if destination != "" {
+		var err error
 		destinationID, err = strconv.Atoi(destination)
-		if err != nil {
-			c.AbortWithStatusJSON(400, gin.H{"error": ErrInvalidDestinationID})
-			return
+		// a negative destination would mean no destination filter, so it is rejected like any other invalid value
+		if err != nil || destinationID < 0 {
+			abortWithInvalidParam(c, "destination", ErrInvalidDestinationID)
+			return nil, 0, false
 		}
-	} else {
-		destinationID = -1
 	}
-
-	results, err := h.hotelService.GetHotels(c, hotelIDs, destinationID)
-	if err != nil {
-		c.AbortWithStatusJSON(500, gin.H{"error": ErrInternalServerError})
-		return
-	}
-
-	if len(results) == 0 {
-		c.AbortWithStatusJSON(404, gin.H{"error": ErrNoHotelsFound})
-		return
-	}
-
-	// Set Cache-Control headers
-	c.Header("Cache-Control", "public, max-age=60")
-
-	c.JSON(http.StatusOK, results)
+	return hotelIDs, destinationID, true
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"merge-hotel/entity"
+	"merge-hotel/export"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestValidators(t *testing.T) {
+	older := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	newer := older.Add(90*time.Minute + 500*time.Millisecond)
+	hotels := []entity.Hotel{
+		{ID: "SjyX", Name: "InterContinental", Provenance: entity.Provenance{ModifiedAt: older}},
+		{ID: "iJhz", Name: "Beach Villas", Provenance: entity.Provenance{ModifiedAt: newer}},
+	}
+
+	etag, lastModified := validators(export.JSON, nil, hotels)
+	testutil.Equals(t, newer.Truncate(time.Second), lastModified)
+	testutil.Equals(t, 34, len(etag), "expected a quoted strong ETag, got %s", etag)
+	testutil.Equals(t, byte('"'), etag[0])
+
+	unmodified := []entity.Hotel{
+		{ID: "SjyX", Name: "InterContinental"},
+		{ID: "iJhz", Name: "Beach Villas"},
+	}
+	same, lastModified := validators(export.JSON, nil, unmodified)
+	testutil.Assert(t, lastModified.IsZero(), "expected no Last-Modified, got %v", lastModified)
+	testutil.Equals(t, etag, same, "the provenance is not part of the representation")
+
+	changed := []entity.Hotel{hotels[0], hotels[1]}
+	changed[1].Name = "Beach Villas Singapore"
+	for _, other := range []string{
+		func() string { e, _ := validators(export.JSON, nil, changed); return e }(),
+		func() string { e, _ := validators(export.NDJSON, nil, hotels); return e }(),
+		func() string { e, _ := validators(export.CSV, []string{"id"}, hotels); return e }(),
+		func() string { e, _ := validators(export.CSV, []string{"id", "name"}, hotels); return e }(),
+	} {
+		testutil.Assert(t, other != etag, "expected a different ETag")
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	const etag = `"abc"`
+	for _, tc := range []struct {
+		ifNoneMatch string
+		expected    bool
+	}{
+		{ifNoneMatch: `"abc"`, expected: true},
+		{ifNoneMatch: `W/"abc"`, expected: true},
+		{ifNoneMatch: `"xyz", "abc"`, expected: true},
+		{ifNoneMatch: `*`, expected: true},
+		{ifNoneMatch: `"xyz"`},
+		{ifNoneMatch: `abc`},
+	} {
+		testutil.Equals(t, tc.expected, etagMatches(tc.ifNoneMatch, etag), tc.ifNoneMatch)
+	}
+}
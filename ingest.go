@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"merge-hotel/auth"
+)
+
+const (
+	// ErrUnknownPusher is returned when hotels are pushed to a supplier that is not fed by pushes.
+	ErrUnknownPusher = "Unknown supplier. The supplier does not accept pushed hotels."
+	// ErrInvalidSignature is returned when a push is not signed with the key of the supplier.
+	ErrInvalidSignature = "Invalid signature. Pushes must be signed with the key of the supplier."
+	// ErrPushTooLarge is returned when a push exceeds maxPushBytes.
+	ErrPushTooLarge = "Push too large. Split the records into smaller batches."
+	// ErrInvalidPush is returned when the body of a push cannot be read.
+	ErrInvalidPush = "Invalid push. The body could not be read."
+)
+
+// maxPushBytes bounds the size of a push, as it is held in memory to verify its signature.
+const maxPushBytes = 32 << 20 // 32 MiB
+
+type IngestUsecase interface {
+	// Pusher returns the supplier of the given name if its partner pushes its hotels.
+	Pusher(supplierName string) (HotelPusher, bool)
+	// Ingest stores the hotels pushed to a supplier and updates the cache. It returns the IDs of the pushed hotels.
+	Ingest(pusher HotelPusher, body io.Reader) ([]string, error)
+}
+
+type IngestHandler struct {
+	hotelService IngestUsecase
+}
+
+// NewIngestHandler creates a new IngestHandler.
+func NewIngestHandler(hotels IngestUsecase) *IngestHandler {
+	return &IngestHandler{
+		hotelService: hotels,
+	}
+}
+
+// Ingest receives the hotel records that a partner pushes, a single record or a batch in the response format of
+// the supplier, signed like the requests of the hmac auth type.
+func (h *IngestHandler) Ingest(c *gin.Context) {
+	name := c.Param("supplier")
+	pusher, ok := h.hotelService.Pusher(name)
+	if !ok {
+		abortWithProblem(c, http.StatusNotFound, CodeNotFound, ErrUnknownPusher)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPushBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		abortWithProblem(c, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, ErrPushTooLarge)
+		return
+	}
+	if err != nil {
+		abortWithProblem(c, http.StatusBadRequest, CodeInvalidBody, ErrInvalidPush)
+		return
+	}
+
+	err = pusher.Verify(c.Request.Method, c.Request.URL.RequestURI(), c.GetHeader(auth.TimestampHeader), c.GetHeader(auth.DefaultSignatureHeader), body)
+	if err != nil {
+		log.Warn().Err(err).Str("supplier", name).Msg("Rejected push")
+		abortWithProblem(c, http.StatusUnauthorized, CodeInvalidSignature, ErrInvalidSignature)
+		return
+	}
+
+	hotelIDs, err := h.hotelService.Ingest(pusher, bytes.NewReader(body))
+	if err != nil {
+		// the records are rejected as a whole, so the partner can fix and push them again
+		abortWithProblem(c, http.StatusBadRequest, CodeInvalidBody, err.Error())
+		return
+	}
+	log.Info().Str("supplier", name).Int("hotels", len(hotelIDs)).Msg("Ingested pushed hotels")
+	c.JSON(http.StatusOK, gin.H{"hotels": hotelIDs})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"merge-hotel/auth"
+	"merge-hotel/supplier"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/gin-gonic/gin"
+)
+
+const pushKey auth.Secret = "push-key"
+
+// zeros is an endless reader of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestIngestHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const batch = `[{"hotel_id": "iJhz", "destination_id": 5432, "amenities": {"general": ["Rooftop Bar"]}}]`
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name     string
+		supplier string
+		body     io.Reader
+		key      auth.Secret
+		signedAt time.Time
+		unsigned bool
+		status   int
+		code     Code
+	}{
+		{name: "valid batch", supplier: "Direct", status: http.StatusOK},
+		{name: "unknown supplier", supplier: "Unknown", status: http.StatusNotFound, code: CodeNotFound},
+		{name: "polled supplier", supplier: "Acme", status: http.StatusNotFound, code: CodeNotFound},
+		{name: "wrong key", supplier: "Direct", key: "other-key", status: http.StatusUnauthorized, code: CodeInvalidSignature},
+		{name: "missing signature", supplier: "Direct", unsigned: true, status: http.StatusUnauthorized, code: CodeInvalidSignature},
+		{name: "stale timestamp", supplier: "Direct", signedAt: now.Add(-auth.MaxSignatureAge - time.Minute), status: http.StatusUnauthorized, code: CodeInvalidSignature},
+		{name: "future timestamp", supplier: "Direct", signedAt: now.Add(auth.MaxSignatureAge + time.Minute), status: http.StatusUnauthorized, code: CodeInvalidSignature},
+		{name: "too large", supplier: "Direct", body: io.LimitReader(zeros{}, maxPushBytes+1), status: http.StatusRequestEntityTooLarge, code: CodePayloadTooLarge},
+		{name: "invalid records", supplier: "Direct", body: bytes.NewReader([]byte(`[{"hotel_id": 1}]`)), status: http.StatusBadRequest, code: CodeInvalidBody},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			usecase := newFixtureUsecase(t, fixtureSetup{suppliers: func(suppliers map[string]HotelSupplier) {
+				suppliers["Direct"] = supplier.NewPushed("Direct", pushKey, supplier.JSONFiles(supplier.DecodePaperfliesHotels))
+			}})
+			_, err := usecase.GetHotels(context.Background(), []string{"iJhz"}, -1)
+			testutil.Ok(t, err)
+
+			router := gin.New()
+			router.POST("/ingest/:supplier", NewIngestHandler(usecase).Ingest)
+
+			body := []byte(batch)
+			if tc.body != nil {
+				body, err = io.ReadAll(tc.body)
+				testutil.Ok(t, err)
+			}
+			key, signedAt := pushKey, now
+			if tc.key != "" {
+				key = tc.key
+			}
+			if !tc.signedAt.IsZero() {
+				signedAt = tc.signedAt
+			}
+			target := "/ingest/" + tc.supplier
+			timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+			req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+			req.Header.Set(auth.TimestampHeader, timestamp)
+			if !tc.unsigned {
+				req.Header.Set(auth.DefaultSignatureHeader, auth.Signature(key, http.MethodPost, target, timestamp, body))
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			testutil.Equals(t, tc.status, rec.Code, rec.Body.String())
+
+			items, _ := usecase.CachedHotels()
+			testutil.Equals(t, 1, len(items))
+			pushed := slices.Contains(items[0].Value.Provenance.Suppliers, "Direct")
+			if tc.status != http.StatusOK {
+				testutil.Equals(t, ProblemContentType, rec.Header().Get("Content-Type"))
+				var problem Problem
+				testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+				testutil.Equals(t, tc.code, problem.Code)
+				testutil.Assert(t, !pushed, "expected a rejected push to leave the cache untouched")
+				return
+			}
+
+			var ingested struct {
+				Hotels []string `json:"hotels"`
+			}
+			testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &ingested))
+			testutil.Equals(t, []string{"iJhz"}, ingested.Hotels)
+			testutil.Assert(t, pushed, "expected the pushed hotel to be merged into the cache")
+			testutil.Assert(t, slices.Contains(items[0].Value.Amenities.General, "rooftop bar"), "expected the pushed amenity, got %v", items[0].Value.Amenities.General)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Package latency bounds the time spent waiting for a supplier. A fetch that exceeds the budget of the supplier
+// is abandoned, and a slow fetch can be hedged with duplicate fetches once it exceeds the usual latency of the supplier.
+package latency
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"merge-hotel/entity"
+	"merge-hotel/supplier"
+)
+
+// Options configure the latency of a supplier. Zero values disable the budget and the hedging.
+type Options struct {
+	// Budget is the maximum duration of a fetch, including its hedges.
+	Budget time.Duration
+	// MaxHedges is the maximum number of duplicate fetches started while the first one is still running.
+	MaxHedges int
+	// Percentile is the percentile of the recent latencies after which a fetch is hedged. It defaults to 0.95.
+	Percentile float64
+	// MinDelay is the minimum delay before hedging, so that fast suppliers are not hedged on small variations.
+	MinDelay time.Duration
+}
+
+// Enabled reports whether the fetches are bounded or hedged.
+func (o Options) Enabled() bool {
+	return o.Budget > 0 || o.MaxHedges > 0
+}
+
+// DefaultPercentile is the percentile used if Options.Percentile is not set.
+const DefaultPercentile = 0.95
+
+const (
+	// windowSize is the number of recent latencies that the hedging delay is computed from.
+	windowSize = 100
+	// minSamples is the number of latencies needed before hedging, as the percentile of fewer is meaningless.
+	minSamples = 10
+)
+
+// HotelSupplier is the supplier interface of the service.
+type HotelSupplier interface {
+	FetchHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error)
+	GetName() string
+}
+
+// Supplier wraps a HotelSupplier to bound and hedge its fetches.
+type Supplier struct {
+	HotelSupplier
+	opts Options
+
+	mu        sync.Mutex // guards the latencies
+	latencies []time.Duration
+	next      int // index of the oldest latency once the window is full
+}
+
+// NewSupplier wraps the supplier with the latency options.
+func NewSupplier(s HotelSupplier, opts Options) *Supplier {
+	if opts.Percentile <= 0 {
+		opts.Percentile = DefaultPercentile
+	}
+	return &Supplier{HotelSupplier: s, opts: opts}
+}
+
+// result is the outcome of a fetch.
+type result struct {
+	hotels  []entity.Hotel
+	err     error
+	elapsed time.Duration
+}
+
+// FetchHotels implements HotelSupplier. It returns as soon as a fetch succeeds, cancelling the others,
+// or when the budget is exceeded, even if the wrapped supplier does not return.
+func (s *Supplier) FetchHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error) {
+	var cancel context.CancelFunc
+	if s.opts.Budget > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.opts.Budget)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	// the channel is buffered so that the abandoned fetches do not block
+	results := make(chan result, 1+s.opts.MaxHedges)
+	start := func() {
+		started := time.Now()
+		go func() {
+			hotels, err := s.HotelSupplier.FetchHotels(ctx, hotelIDs, destinationID)
+			results <- result{hotels: hotels, err: err, elapsed: time.Since(started)}
+		}()
+	}
+	start()
+	pending, hedges := 1, 0
+
+	var hedge <-chan time.Time
+	delay, ok := s.hedgeDelay()
+	if ok {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	var lastErr error
+	for {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				s.observe(r.elapsed)
+				return r.hotels, nil
+			}
+			lastErr = r.err
+			if pending == 0 {
+				return nil, lastErr
+			}
+		case <-hedge:
+			start()
+			pending++
+			hedges++
+			hedge = nil
+			if hedges < s.opts.MaxHedges {
+				hedge = time.After(delay)
+			}
+		case <-ctx.Done():
+			return nil, fmt.Errorf("abandoned after %d attempts: %w", hedges+1, ctx.Err())
+		}
+	}
+}
+
+// hedgeDelay returns how long to wait before hedging, the percentile of the recent latencies.
+// It returns false if the fetches are not hedged, or there are not enough latencies yet.
+func (s *Supplier) hedgeDelay() (time.Duration, bool) {
+	if s.opts.MaxHedges <= 0 {
+		return 0, false
+	}
+	s.mu.Lock()
+	latencies := slices.Clone(s.latencies)
+	s.mu.Unlock()
+	if len(latencies) < minSamples {
+		return 0, false
+	}
+	slices.Sort(latencies)
+	i := min(int(float64(len(latencies))*s.opts.Percentile), len(latencies)-1)
+	return max(latencies[i], s.opts.MinDelay), true
+}
+
+// observe records the latency of a successful fetch.
+func (s *Supplier) observe(elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.latencies) < windowSize {
+		s.latencies = append(s.latencies, elapsed)
+		return
+	}
+	s.latencies[s.next] = elapsed
+	s.next = (s.next + 1) % windowSize
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped supplier, if it supports it.
+func (s *Supplier) CloseIdleConnections() {
+	if closer, ok := s.HotelSupplier.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// Capabilities returns the filters that the wrapped supplier applies server-side, if it declares them.
+func (s *Supplier) Capabilities() supplier.Capabilities {
+	if capable, ok := s.HotelSupplier.(interface{ Capabilities() supplier.Capabilities }); ok {
+		return capable.Capabilities()
+	}
+	return supplier.Capabilities{}
+}
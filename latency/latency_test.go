@@ -0,0 +1,92 @@
+package latency_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"merge-hotel/entity"
+	"merge-hotel/latency"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+// slowSupplier takes the duration returned by delay for each fetch, ignoring the cancellation of the context
+// unless respectContext is set.
+type slowSupplier struct {
+	calls          atomic.Int32
+	delay          func(call int32) time.Duration
+	respectContext bool
+}
+
+func (s *slowSupplier) FetchHotels(ctx context.Context, _ []string, _ int) ([]entity.Hotel, error) {
+	call := s.calls.Add(1)
+	timer := time.NewTimer(s.delay(call))
+	defer timer.Stop()
+	if s.respectContext {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	} else {
+		<-timer.C
+	}
+	return []entity.Hotel{{ID: "a"}}, nil
+}
+
+func (s *slowSupplier) GetName() string {
+	return "slow"
+}
+
+func TestSupplierAbandonsAfterBudget(t *testing.T) {
+	s := latency.NewSupplier(&slowSupplier{delay: func(int32) time.Duration { return time.Second }}, latency.Options{Budget: 20 * time.Millisecond})
+	start := time.Now()
+	_, err := s.FetchHotels(context.Background(), nil, -1)
+	testutil.Assert(t, errors.Is(err, context.DeadlineExceeded), "expected a deadline error, got %v", err)
+	testutil.Assert(t, time.Since(start) < 500*time.Millisecond, "expected the fetch to be abandoned, took %v", time.Since(start))
+}
+
+func TestSupplierHedgesSlowFetches(t *testing.T) {
+	slow := &slowSupplier{respectContext: true, delay: func(call int32) time.Duration {
+		// the first fetches set the usual latency, then a fetch hangs and its hedge is fast
+		if call == 11 {
+			return time.Minute
+		}
+		return time.Millisecond
+	}}
+	s := latency.NewSupplier(slow, latency.Options{MaxHedges: 1, MinDelay: 5 * time.Millisecond})
+
+	// no hedging until the usual latency is known
+	for i := 0; i < 10; i++ {
+		_, err := s.FetchHotels(context.Background(), nil, -1)
+		testutil.Ok(t, err)
+	}
+	testutil.Equals(t, int32(10), slow.calls.Load())
+
+	start := time.Now()
+	hotels, err := s.FetchHotels(context.Background(), nil, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(hotels))
+	testutil.Equals(t, int32(12), slow.calls.Load())
+	testutil.Assert(t, time.Since(start) < time.Second, "expected the hedge to answer, took %v", time.Since(start))
+}
+
+func TestSupplierReturnsErrorOfLastAttempt(t *testing.T) {
+	failing := errors.New("failed")
+	s := latency.NewSupplier(failingSupplier{failing}, latency.Options{Budget: time.Second, MaxHedges: 2})
+	_, err := s.FetchHotels(context.Background(), nil, -1)
+	testutil.Assert(t, errors.Is(err, failing), "expected the supplier error, got %v", err)
+}
+
+type failingSupplier struct{ err error }
+
+func (s failingSupplier) FetchHotels(context.Context, []string, int) ([]entity.Hotel, error) {
+	return nil, s.err
+}
+
+func (s failingSupplier) GetName() string {
+	return "failing"
+}
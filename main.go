@@ -2,33 +2,103 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"syscall"
-	"time"
 
+	"merge-hotel/auth"
 	"merge-hotel/cache"
+	"merge-hotel/entity"
+	"merge-hotel/fault"
+	"merge-hotel/fixture"
+	"merge-hotel/latency"
+	"merge-hotel/override"
+	"merge-hotel/ratelimit"
 	"merge-hotel/supplier"
+	"merge-hotel/suppress"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 )
 
 func main() {
+	// parse the flags, the config path can also be set with MERGEHOTEL_CONFIG
+	configPath, command, err := parseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+	// run the subcommand instead of the web server if there is one, e.g. `merge-hotel config validate`
+	if len(command) > 0 {
+		os.Exit(runCommand(command, configPath))
+	}
+
 	// parse the configuration file
-	cfg, err := LoadConfig("config.yaml")
+	cfg, err := LoadConfig(configPath)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load configuration file")
 	}
+	setupLogging(cfg.Logging)
+
+	// load the manual overrides of the hotel data
+	overrides, err := override.NewStore(cfg.Overrides.File)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load overrides")
+	}
+
+	// compile the suppression rules
+	suppression, err := suppress.NewRuleSet(cfg.Suppression.SuppressionRules())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid suppression rules")
+	}
 
-	// set up the service layer with the suppliers registry and in memory cache
-	hotelService := NewUsecaseImpl(setupSupplierRegistry(cfg), cache.NewInMemoryCache())
+	// set up the service layer with the suppliers registry, in memory cache, overrides and suppression rules
+	hotelService := NewUsecaseImpl(setupSupplierRegistry(cfg), newHotelCache(cfg.Cache), UsecaseOptions{
+		CacheTTL:      cfg.Cache.TTL,
+		LatencyBudget: cfg.Server.LatencyBudget,
+		Overrides:     overrides,
+		Suppression:   suppression,
+	})
 	// set up the handler layer
-	handler := NewHandler(hotelService)
+	handler := NewHandler(hotelService, cfg.Cache.HTTPMaxAge)
 	// set up the router
-	router := gin.Default()
+	router := gin.New()
+	// every error, including unknown routes and panics, is answered with a problem carrying the request ID
+	router.Use(RequestID(), gin.Logger(), gin.CustomRecovery(Recover))
+	router.NoRoute(NotFound)
 	router.GET("/hotels", handler.GetHotels)
+	router.GET("/export", handler.Export)
+	// stream the changes of the merged hotels to the downstream services
+	router.GET("/hotels/changes", NewChangesHandler(hotelService).StreamChanges)
+
+	// set up the admin endpoints, only if an admin token is configured
+	if cfg.Admin.Token != "" {
+		adminHandler := NewAdminHandler(hotelService)
+		admin := router.Group("/admin", RequireToken(cfg.Admin.Token))
+		admin.GET("/cache", adminHandler.ListCache)
+		admin.DELETE("/cache", adminHandler.FlushCache)
+		admin.DELETE("/cache/hotels/:id", adminHandler.EvictHotel)
+		admin.DELETE("/cache/destinations/:id", adminHandler.EvictDestination)
+		admin.DELETE("/cache/suppliers/:name", adminHandler.EvictSupplier)
+		admin.POST("/cache/warmup", adminHandler.WarmUp)
+		admin.GET("/overrides", adminHandler.ListOverrides)
+		admin.POST("/overrides", adminHandler.AddOverride)
+		admin.DELETE("/overrides/:id", adminHandler.DeleteOverride)
+		admin.GET("/suppressions", adminHandler.ListSuppressions)
+	} else {
+		log.Warn().Msg("No admin token configured, admin endpoints are disabled")
+	}
+
+	// set up the endpoints of the partners that push their hotels, authenticated by the signature of each push
+	ingestHandler := NewIngestHandler(hotelService)
+	router.POST("/ingest/:supplier", ingestHandler.Ingest)
 
 	// set up health check
 	// health check
@@ -40,11 +110,14 @@ func main() {
 
 	// create the server
 	s := &http.Server{
-		Addr:              "localhost:8080",
+		Addr:              cfg.Server.Address,
 		Handler:           router,
-		ReadHeaderTimeout: 2 * time.Second,
-		WriteTimeout:      5 * time.Second,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
 	}
+	// end the streams of changes on shutdown, so that it does not wait for them until it times out
+	s.RegisterOnShutdown(hotelService.Changes().Close)
 
 	// run the server
 	go func() {
@@ -54,13 +127,19 @@ func main() {
 		}
 	}()
 
+	// reload the supplier configuration when the configuration file changes or on SIGHUP
+	reloadCtx, stopReloading := context.WithCancel(context.Background())
+	defer stopReloading()
+	go NewConfigReloader(configPath, cfg, hotelService).Run(reloadCtx, cfg.Reload.WatchInterval)
+
 	// set up graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Info().Msg("Shutting down server")
+	stopReloading()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := s.Shutdown(ctx); err != nil {
@@ -75,23 +154,151 @@ func main() {
 	log.Info().Msg("Server shutdown complete")
 }
 
+// supplierKind is a supplier implementation that can be selected in the configuration.
+type supplierKind struct {
+	// new creates the named supplier of the configuration, fetching with the given client.
+	new func(name string, sCfg SupplierConfig, client *http.Client) HotelSupplier
+	// decode parses hotel data captured from the supplier, in the supplier's response format.
+	// It is nil for the kinds whose format depends on the configuration.
+	decode func(r io.Reader) ([]entity.Hotel, error)
+}
+
+// feedKind is the supplier kind of the XML and delimited text feeds, described by the feed configuration.
+const feedKind = "Feed"
+
+// supplierKinds maps each supported supplier kind to its implementation.
+var supplierKinds = map[string]supplierKind{
+	"Acme": {
+		new: func(_ string, sCfg SupplierConfig, client *http.Client) HotelSupplier {
+			return supplier.NewAcme(sCfg.URL, client, sCfg.Query.Query())
+		},
+		decode: supplier.DecodeAcmeHotels,
+	},
+	"Patagonia": {
+		new: func(_ string, sCfg SupplierConfig, client *http.Client) HotelSupplier {
+			return supplier.NewPatagonia(sCfg.URL, client, sCfg.Query.Query())
+		},
+		decode: supplier.DecodePatagoniaHotels,
+	},
+	"Paperflies": {
+		new: func(_ string, sCfg SupplierConfig, client *http.Client) HotelSupplier {
+			return supplier.NewPaperflies(sCfg.URL, client, sCfg.Query.Query())
+		},
+		decode: supplier.DecodePaperfliesHotels,
+	},
+	feedKind: {
+		new: func(name string, sCfg SupplierConfig, client *http.Client) HotelSupplier {
+			return supplier.NewFeed(name, sCfg.URL, client, sCfg.Query.Query(), sCfg.Feed.Feed())
+		},
+	},
+}
+
+// knownSupplierKinds returns the sorted names of the supported supplier kinds.
+func knownSupplierKinds() []string {
+	kinds := make([]string, 0, len(supplierKinds))
+	for kind := range supplierKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
 // setupSupplierRegistry sets up the supplier registry based on the configuration.
 func setupSupplierRegistry(cfg *Config) map[string]HotelSupplier {
 	suppliers := make(map[string]HotelSupplier)
 
 	// initialise specific supplier instances based on the configuration
 	for name, sCfg := range cfg.Suppliers {
-		switch name {
-		case "Acme":
-			suppliers[name] = supplier.NewAcme(sCfg.URL)
-		case "Patagonia":
-			suppliers[name] = supplier.NewPatagonia(sCfg.URL)
-		case "Paperflies":
-			suppliers[name] = supplier.NewPaperflies(sCfg.URL)
-		default:
+		if sCfg.Disabled {
+			log.Info().Str("supplier", name).Msg("Supplier is disabled, skipping")
+			continue
+		}
+		s, ok := newSupplierFromConfig(cfg, name)
+		if !ok {
 			log.Warn().Str("supplier", name).Msg("Unknown supplier, skipping")
+			continue
 		}
+		suppliers[name] = s
 	}
 
 	return suppliers
 }
+
+// newSupplierFromConfig creates the instance of the named supplier of the configuration.
+// It returns false if the supplier is unknown.
+func newSupplierFromConfig(cfg *Config, name string) (HotelSupplier, bool) {
+	sCfg := cfg.Suppliers[name]
+	kind, ok := supplierKinds[sCfg.Kind]
+	if !ok {
+		return nil, false
+	}
+	if sCfg.Ingest.Enabled() {
+		// the pushed hotels are in memory, so neither faults nor latency budgets apply
+		return supplier.NewPushed(name, sCfg.Ingest.Secret, supplierFileFormat(sCfg)), true
+	}
+	var injector *fault.Injector
+	if sCfg.Faults.Options().Enabled() {
+		injector = fault.NewInjector(sCfg.Faults.Options())
+		log.Warn().Str("supplier", name).Interface("faults", sCfg.Faults).Msg("Injecting faults into supplier")
+	}
+
+	var s HotelSupplier
+	if sCfg.Path != "" {
+		s = supplier.NewLocal(name, sCfg.Path, supplierFileFormat(sCfg), sCfg.Watch)
+	} else {
+		client := newSupplierClient(cfg, sCfg)
+		if injector != nil {
+			// the faults are injected both around the HTTP exchange and around the fetch
+			client.Transport = injector.Transport(client.Transport)
+		}
+		s = kind.new(name, sCfg, client)
+	}
+	if injector != nil {
+		s = fault.NewSupplier(s, injector)
+	}
+	// the budget and hedges wrap the faults, so that chaos tests show their effect
+	if opts := sCfg.LatencyOptions(); opts.Enabled() {
+		s = latency.NewSupplier(s, opts)
+	}
+	return s, true
+}
+
+// supplierFileFormat returns the format of the local files of a supplier, the response format of its kind.
+func supplierFileFormat(sCfg SupplierConfig) supplier.FileFormat {
+	if sCfg.Kind == feedKind {
+		return supplier.FeedFiles(sCfg.Feed.Feed())
+	}
+	return supplier.JSONFiles(supplierKinds[sCfg.Kind].decode)
+}
+
+// newSupplierClient creates the HTTP client of a supplier, authenticating and rate limiting its requests and
+// recording or replaying its responses if fixtures are enabled. The requests are authenticated after the fixture
+// transport, so that the credentials are never saved in the fixture files, and replayed responses are not rate limited.
+func newSupplierClient(cfg *Config, sCfg SupplierConfig) *http.Client {
+	client := supplier.NewHTTPClient(sCfg.Timeout)
+	client.Transport = auth.NewTransport(sCfg.Auth.Options(), client.Transport)
+	client.Transport = ratelimit.NewTransport(sCfg.RateLimit.Options(), client.Transport)
+	if mode, _ := fixture.ParseMode(cfg.Fixtures.Mode); mode != fixture.Off {
+		client.Transport = fixture.NewTransport(mode, cfg.Fixtures.Dir, client.Transport)
+	}
+	return client
+}
+
+// newHotelCache sets up the in memory cache for merged hotels, bounded by entry count and approximate size.
+func newHotelCache(cfg CacheConfig) *cache.Cache[string, entity.Hotel] {
+	return cache.New(cache.Options[string, entity.Hotel]{
+		MaxEntries: cfg.MaxEntries,
+		MaxBytes:   cfg.MaxBytes,
+		SizeOf: func(hotelID string, hotel entity.Hotel) int64 {
+			return int64(len(hotelID)) + hotel.ApproximateSize()
+		},
+	})
+}
+
+// envOrDefault returns the value of the environment variable, or def if it is not set.
+func envOrDefault(key, def string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return def
+}
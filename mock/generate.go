@@ -0,0 +1,142 @@
+package mock
+
+import (
+	"fmt"
+	"math/rand/v2"
+)
+
+var (
+	cities = []struct {
+		name, country, code string
+		destinationID       int
+		lat, lng            float64
+	}{
+		{"Singapore", "Singapore", "SG", 5432, 1.29, 103.85},
+		{"Tokyo", "Japan", "JP", 1122, 35.68, 139.69},
+		{"Bangkok", "Thailand", "TH", 2233, 13.75, 100.50},
+		{"Sydney", "Australia", "AU", 3344, -33.87, 151.21},
+	}
+	nameWords     = []string{"Grand", "Beach", "Garden", "Harbour", "Royal", "City", "Park", "Boutique"}
+	nameSuffixes  = []string{"Hotel", "Villas", "Resort", "Suites", "Inn"}
+	streets       = []string{"Orchard Road", "Marina Boulevard", "Station Street", "River Walk", "Hill Avenue"}
+	generalAmens  = []string{"outdoor pool", "indoor pool", "business center", "childcare", "wifi", "dry cleaning", "breakfast"}
+	roomAmenities = []string{"aircon", "tv", "coffee machine", "kettle", "hair dryer", "iron", "bathtub"}
+	conditions    = []string{
+		"All children are welcome.",
+		"Pets are not allowed.",
+		"WiFi is available in all areas and is free of charge.",
+		"Free private parking is possible on site.",
+	}
+)
+
+// hotel is a generated hotel, before it is shaped into the format of each supplier.
+type hotel struct {
+	id, name, address, postalCode, description string
+	city                                       int
+	lat, lng                                   float64
+	general, room                              []string
+	images                                     []string
+}
+
+// Generate creates n random hotels and returns their records in the format of each supplier kind.
+// The same seed always generates the same hotels. Every supplier has every hotel, with different details,
+// so that the merge of the suppliers can be observed.
+func Generate(n int, seed uint64) map[string][]Record {
+	r := rand.New(rand.NewPCG(seed, seed))
+	records := make(map[string][]Record, len(Kinds))
+	for i := 0; i < n; i++ {
+		h := generateHotel(r, i)
+		records["acme"] = append(records["acme"], acmeRecord(h))
+		records["patagonia"] = append(records["patagonia"], patagoniaRecord(h))
+		records["paperflies"] = append(records["paperflies"], paperfliesRecord(h))
+	}
+	return records
+}
+
+func generateHotel(r *rand.Rand, i int) hotel {
+	pick := func(values []string) string { return values[r.IntN(len(values))] }
+	subset := func(values []string) []string {
+		var out []string
+		for _, value := range values {
+			if r.IntN(2) == 0 {
+				out = append(out, value)
+			}
+		}
+		return out
+	}
+
+	city := r.IntN(len(cities))
+	h := hotel{
+		id:          fmt.Sprintf("h%03d", i),
+		name:        fmt.Sprintf("%s %s %s", pick(nameWords), cities[city].name, pick(nameSuffixes)),
+		address:     fmt.Sprintf("%d %s", 1+r.IntN(200), pick(streets)),
+		postalCode:  fmt.Sprintf("%06d", r.IntN(1000000)),
+		description: fmt.Sprintf("A hotel in the heart of %s.", cities[city].name),
+		city:        city,
+		lat:         cities[city].lat + (r.Float64()-0.5)/10,
+		lng:         cities[city].lng + (r.Float64()-0.5)/10,
+		general:     subset(generalAmens),
+		room:        subset(roomAmenities),
+	}
+	for j := 0; j < 1+r.IntN(3); j++ {
+		h.images = append(h.images, fmt.Sprintf("https://images.example.com/%s/%d.jpg", h.id, j))
+	}
+	return h
+}
+
+func acmeRecord(h hotel) Record {
+	c := cities[h.city]
+	return Record{
+		"Id":            h.id,
+		"DestinationId": c.destinationID,
+		"Name":          h.name,
+		"Latitude":      h.lat,
+		"Longitude":     h.lng,
+		"Address":       " " + h.address + " ",
+		"City":          c.name,
+		"Country":       c.code,
+		"PostalCode":    h.postalCode,
+		"Description":   "  " + h.description,
+		"Facilities":    h.general,
+	}
+}
+
+func patagoniaRecord(h hotel) Record {
+	c := cities[h.city]
+	rooms := make([]any, len(h.images))
+	for i, link := range h.images {
+		rooms[i] = Record{"url": link, "description": "Room"}
+	}
+	return Record{
+		"id":          h.id,
+		"destination": c.destinationID,
+		"name":        h.name,
+		"lat":         h.lat,
+		"lng":         h.lng,
+		"address":     h.address + ", " + h.postalCode,
+		"info":        h.description + " Guests enjoy spectacular views.",
+		"amenities":   h.room,
+		"images":      Record{"rooms": rooms},
+	}
+}
+
+func paperfliesRecord(h hotel) Record {
+	c := cities[h.city]
+	site := make([]any, len(h.images))
+	for i, link := range h.images {
+		site[i] = Record{"link": link, "caption": "Front"}
+	}
+	return Record{
+		"hotel_id":       h.id,
+		"destination_id": c.destinationID,
+		"hotel_name":     h.name,
+		"location": Record{
+			"address": h.address + ", " + h.postalCode,
+			"country": c.name,
+		},
+		"details":            h.description,
+		"amenities":          Record{"general": h.general, "room": h.room},
+		"images":             Record{"site": site},
+		"booking_conditions": conditions,
+	}
+}
@@ -0,0 +1,269 @@
+// Package mock serves Acme, Patagonia and Paperflies shaped supplier endpoints, so that the whole service can be run
+// offline. The responses can be degraded with latency, errors, malformed records and null fields to exercise
+// the error handling of the service.
+package mock
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds are the supplier kinds served by the mock, in the order of their endpoints.
+var Kinds = []string{"acme", "patagonia", "paperflies"}
+
+// idFields maps each supplier kind to the field of its records that holds the hotel ID.
+var idFields = map[string]string{
+	"acme":       "Id",
+	"patagonia":  "id",
+	"paperflies": "hotel_id",
+}
+
+// destinationFields maps each supplier kind to the field of its records that holds the destination ID.
+var destinationFields = map[string]string{
+	"acme":       "DestinationId",
+	"patagonia":  "destination",
+	"paperflies": "destination_id",
+}
+
+// Record is a hotel record in the response format of a supplier.
+type Record = map[string]any
+
+// Options control how the responses are degraded. The rates are probabilities between 0 and 1.
+type Options struct {
+	// Latency is added to every response, plus a random duration up to Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+	// ErrorRate is the rate of responses that fail with 500 Internal Server Error.
+	ErrorRate float64
+	// MalformedRate is the rate of records whose hotel ID has the wrong type, which fails the decoding of the response.
+	MalformedRate float64
+	// NullRate is the rate of record fields set to null.
+	NullRate float64
+	// Seed makes the degradation reproducible.
+	Seed uint64
+}
+
+// Server serves the records of each supplier kind at /suppliers/<kind>, e.g. /suppliers/acme.
+// The records can be filtered server-side with the ids (comma-separated) and destination query parameters,
+// and paginated with the page (from 1) or offset (from 0), and limit query parameters. Paginated responses
+// link to their next page in the Link header. Responses have an ETag, are compressed with gzip if the client
+// accepts it, and unchanged responses are answered with 304 Not Modified.
+type Server struct {
+	records map[string][]Record
+	opts    Options
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewServer creates a server for the records, keyed by supplier kind.
+func NewServer(records map[string][]Record, opts Options) *Server {
+	return &Server{
+		records: records,
+		opts:    opts,
+		rand:    rand.New(rand.NewPCG(opts.Seed, opts.Seed)),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	kind, ok := strings.CutPrefix(r.URL.Path, "/suppliers/")
+	records, found := s.records[kind]
+	if !ok || !found {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	select {
+	case <-time.After(s.latency()):
+	case <-r.Context().Done():
+		return
+	}
+
+	if s.chance(s.opts.ErrorRate) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":"injected failure"}`))
+		return
+	}
+
+	records, next, err := filter(kind, records, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if next != nil {
+		nextURL := *r.URL
+		nextURL.RawQuery = next.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, nextURL.String()))
+	}
+	body, err := json.Marshal(s.degrade(kind, records))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// the ETag changes with the body, so that unchanged responses can be revalidated
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		_, _ = gw.Write(body)
+		_ = gw.Close()
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+// filter returns the records matching the filters of the query, and the requested page of them.
+// If there are records after the page, it also returns the query of the next page.
+func filter(kind string, records []Record, query url.Values) ([]Record, url.Values, error) {
+	ids := make(map[string]bool)
+	if query.Has("ids") {
+		for _, id := range strings.Split(query.Get("ids"), ",") {
+			ids[id] = true
+		}
+	}
+	destination := -1
+	if query.Has("destination") {
+		var err error
+		if destination, err = strconv.Atoi(query.Get("destination")); err != nil {
+			return nil, nil, fmt.Errorf("invalid destination %q", query.Get("destination"))
+		}
+	}
+
+	filtered := make([]Record, 0, len(records))
+	for _, record := range records {
+		id, _ := record[idFields[kind]].(string)
+		// JSON numbers are decoded as float64, generated records hold ints
+		recordDestination, _ := record[destinationFields[kind]].(float64)
+		if d, ok := record[destinationFields[kind]].(int); ok {
+			recordDestination = float64(d)
+		}
+		if (len(ids) == 0 || ids[id]) && (destination < 0 || int(recordDestination) == destination) {
+			filtered = append(filtered, record)
+		}
+	}
+
+	if !query.Has("limit") {
+		return filtered, nil, nil
+	}
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		return nil, nil, fmt.Errorf("invalid limit %q", query.Get("limit"))
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	page, err := strconv.Atoi(query.Get("page"))
+	paged := err == nil && page > 0
+	if paged {
+		offset = (page - 1) * limit
+	}
+	if offset < 0 || offset >= len(filtered) {
+		return []Record{}, nil, nil
+	}
+	end := min(offset+limit, len(filtered))
+
+	var next url.Values
+	if end < len(filtered) {
+		next = url.Values{}
+		for key, values := range query {
+			next[key] = values
+		}
+		if paged {
+			next.Set("page", strconv.Itoa(page+1))
+		} else {
+			next.Set("offset", strconv.Itoa(end))
+		}
+	}
+	return filtered[offset:end], next, nil
+}
+
+// latency returns the latency of the next response.
+func (s *Server) latency() time.Duration {
+	if s.opts.Jitter <= 0 {
+		return s.opts.Latency
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opts.Latency + time.Duration(s.rand.Int64N(int64(s.opts.Jitter)))
+}
+
+// chance returns true with the given probability.
+func (s *Server) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Float64() < rate
+}
+
+// degrade returns a copy of the records with malformed records and null fields injected.
+// The records themselves are never modified, so every response starts from the same data.
+func (s *Server) degrade(kind string, records []Record) []Record {
+	degraded := make([]Record, len(records))
+	for i, record := range records {
+		if s.opts.MalformedRate <= 0 && s.opts.NullRate <= 0 {
+			degraded[i] = record
+			continue
+		}
+		out := make(Record, len(record))
+		for key, value := range record {
+			if key != idFields[kind] && s.chance(s.opts.NullRate) {
+				value = nil
+			}
+			out[key] = value
+		}
+		if s.chance(s.opts.MalformedRate) {
+			out[idFields[kind]] = map[string]any{"malformed": true}
+		}
+		degraded[i] = out
+	}
+	return degraded
+}
+
+// LoadRecords reads the records of a supplier from a file. The file holds either the JSON array of a supplier
+// response, or a fixture recorded by the fixture package, whose response body is used.
+func LoadRecords(path string) ([]Record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	if err := json.Unmarshal(data, &records); err == nil {
+		return records, nil
+	}
+	var recorded struct {
+		Body json.RawMessage `json:"body"`
+	}
+	if err := json.Unmarshal(data, &recorded); err != nil || len(recorded.Body) == 0 {
+		return nil, fmt.Errorf("%s: neither a supplier response nor a fixture", path)
+	}
+	if err := json.Unmarshal(recorded.Body, &records); err != nil {
+		return nil, fmt.Errorf("%s: fixture body is not a supplier response: %w", path, err)
+	}
+	return records, nil
+}
@@ -0,0 +1,81 @@
+package mock_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"merge-hotel/entity"
+	"merge-hotel/mock"
+	"merge-hotel/supplier"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+var decoders = map[string]func(io.Reader) ([]entity.Hotel, error){
+	"acme":       supplier.DecodeAcmeHotels,
+	"patagonia":  supplier.DecodePatagoniaHotels,
+	"paperflies": supplier.DecodePaperfliesHotels,
+}
+
+func get(t *testing.T, srv *httptest.Server, kind string) *http.Response {
+	t.Helper()
+	res, err := srv.Client().Get(srv.URL + "/suppliers/" + kind)
+	testutil.Ok(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestServerServesDecodableRecords(t *testing.T) {
+	for name, records := range map[string]map[string][]mock.Record{
+		"generated": mock.Generate(10, 1),
+		"files":     loadTestdata(t),
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(mock.NewServer(records, mock.Options{NullRate: 0.2, Seed: 1}))
+			defer srv.Close()
+
+			for _, kind := range mock.Kinds {
+				res := get(t, srv, kind)
+				testutil.Equals(t, http.StatusOK, res.StatusCode)
+				hotels, err := decoders[kind](res.Body)
+				testutil.Ok(t, err)
+				testutil.Equals(t, len(records[kind]), len(hotels))
+			}
+		})
+	}
+}
+
+func TestServerInjectsFaults(t *testing.T) {
+	records := mock.Generate(3, 1)
+
+	srv := httptest.NewServer(mock.NewServer(records, mock.Options{ErrorRate: 1}))
+	defer srv.Close()
+	testutil.Equals(t, http.StatusInternalServerError, get(t, srv, "acme").StatusCode)
+	testutil.Equals(t, http.StatusNotFound, get(t, srv, "unknown").StatusCode)
+
+	malformed := httptest.NewServer(mock.NewServer(records, mock.Options{MalformedRate: 1}))
+	defer malformed.Close()
+	_, err := supplier.DecodeAcmeHotels(get(t, malformed, "acme").Body)
+	testutil.NotOk(t, err)
+}
+
+func TestGenerateIsReproducible(t *testing.T) {
+	testutil.Equals(t, mock.Generate(5, 42), mock.Generate(5, 42))
+}
+
+func loadTestdata(t *testing.T) map[string][]mock.Record {
+	t.Helper()
+	records := make(map[string][]mock.Record)
+	for _, kind := range mock.Kinds {
+		kindRecords, err := mock.LoadRecords("../testdata/suppliers/" + kind + ".json")
+		testutil.Ok(t, err)
+		records[kind] = kindRecords
+	}
+	// fixtures are loaded from their response body
+	fromFixture, err := mock.LoadRecords("../testdata/fixtures/GET_5f2be0b4ffc88500167b85a0.mockapi.io_suppliers_acme.json")
+	testutil.Ok(t, err)
+	testutil.Equals(t, records["acme"], fromFixture)
+	return records
+}
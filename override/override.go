@@ -0,0 +1,188 @@
+// Package override applies manual corrections to the merged hotel data. An override changes one field of a hotel,
+// identified by its path such as location.address, and takes precedence over the data of every supplier.
+package override
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"merge-hotel/entity"
+)
+
+// Op is the operation of an override.
+type Op string
+
+const (
+	// Replace sets the field to the value.
+	Replace Op = "replace"
+	// Add appends the values to a list field, unless they are already in the list.
+	Add Op = "add"
+	// Remove removes the values from a list field, or clears the field if there is no value.
+	Remove Op = "remove"
+)
+
+// Override is a correction of a field of a hotel.
+type Override struct {
+	ID      string `json:"id"`
+	HotelID string `json:"hotel_id"`
+	// Field is the path of the field in the hotel response, e.g. location.address or amenities.general.
+	Field string `json:"field"`
+	Op    Op     `json:"op"`
+	// Value is a JSON value of the type of the field: a string, a number, a list of strings, or a list of images
+	// with link and description. Add and remove also take a single element of a list.
+	Value json.RawMessage `json:"value,omitempty"`
+	// Reason is a note for the editors, e.g. the ticket that requested the correction.
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// field gives access to a field of a hotel. Exactly one of the accessors is set, depending on the type of the field.
+type field struct {
+	text   func(h *entity.Hotel) *string
+	number func(h *entity.Hotel) *float64
+	list   func(h *entity.Hotel) *[]string
+	images func(h *entity.Hotel) *[]entity.Image
+}
+
+// fields are the fields of a hotel that can be overridden, keyed by path. The destination cannot be overridden,
+// as the searches by destination are filtered by the suppliers, before the overrides are applied.
+var fields = map[string]field{
+	"name":               {text: func(h *entity.Hotel) *string { return &h.Name }},
+	"description":        {text: func(h *entity.Hotel) *string { return &h.Description }},
+	"location.lat":       {number: func(h *entity.Hotel) *float64 { return &h.Location.Latitude }},
+	"location.lng":       {number: func(h *entity.Hotel) *float64 { return &h.Location.Longitude }},
+	"location.address":   {text: func(h *entity.Hotel) *string { return &h.Location.Address }},
+	"location.city":      {text: func(h *entity.Hotel) *string { return &h.Location.City }},
+	"location.country":   {text: func(h *entity.Hotel) *string { return &h.Location.Country }},
+	"amenities.general":  {list: func(h *entity.Hotel) *[]string { return &h.Amenities.General }},
+	"amenities.room":     {list: func(h *entity.Hotel) *[]string { return &h.Amenities.Room }},
+	"images.rooms":       {images: func(h *entity.Hotel) *[]entity.Image { return &h.Images.Rooms }},
+	"images.site":        {images: func(h *entity.Hotel) *[]entity.Image { return &h.Images.Site }},
+	"images.amenities":   {images: func(h *entity.Hotel) *[]entity.Image { return &h.Images.Amenities }},
+	"booking_conditions": {list: func(h *entity.Hotel) *[]string { return &h.BookingConditions }},
+}
+
+// Fields returns the sorted paths of the fields that can be overridden.
+func Fields() []string {
+	paths := make([]string, 0, len(fields))
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Validate checks that the override can be applied: that the field is known, and that the value suits the operation
+// and the type of the field.
+func (o Override) Validate() error {
+	if o.HotelID == "" {
+		return errors.New("hotel_id must be set")
+	}
+	f, ok := fields[o.Field]
+	if o.Field == "destination_id" {
+		return errors.New("destination_id cannot be overridden, as the searches by destination are filtered by the suppliers")
+	}
+	if !ok {
+		return fmt.Errorf("unknown field %q, must be one of %s", o.Field, strings.Join(Fields(), ", "))
+	}
+	switch o.Op {
+	case Replace:
+		if len(o.Value) == 0 {
+			return errors.New("replace requires a value")
+		}
+	case Add:
+		if f.list == nil && f.images == nil {
+			return fmt.Errorf("add only applies to list fields, use replace for %s", o.Field)
+		}
+		if len(o.Value) == 0 {
+			return errors.New("add requires a value")
+		}
+	case Remove:
+		if len(o.Value) > 0 && f.list == nil && f.images == nil {
+			return fmt.Errorf("remove of %s clears the field and takes no value", o.Field)
+		}
+	default:
+		return fmt.Errorf("unknown op %q, must be add, remove or replace", o.Op)
+	}
+	var hotel entity.Hotel
+	return o.apply(&hotel)
+}
+
+// apply applies the override to the hotel.
+func (o Override) apply(hotel *entity.Hotel) error {
+	f := fields[o.Field]
+	switch {
+	case f.text != nil:
+		return setValue(f.text(hotel), o)
+	case f.number != nil:
+		return setValue(f.number(hotel), o)
+	case f.list != nil:
+		return updateList(f.list(hotel), o, strings.EqualFold)
+	default:
+		return updateList(f.images(hotel), o, func(a, b entity.Image) bool { return a.Link == b.Link })
+	}
+}
+
+// setValue replaces or clears a field holding a single value.
+func setValue[T any](target *T, o Override) error {
+	var value T
+	if o.Op == Replace {
+		if err := decodeValue(o.Value, &value); err != nil {
+			return err
+		}
+	}
+	*target = value
+	return nil
+}
+
+// updateList applies the override to a list field, whose elements are the same if equal returns true.
+func updateList[T any](target *[]T, o Override, equal func(a, b T) bool) error {
+	var values []T
+	if len(o.Value) > 0 {
+		// a single element is accepted for convenience
+		if err := decodeValue(o.Value, &values); err != nil {
+			var value T
+			if decodeValue(o.Value, &value) != nil {
+				return err
+			}
+			values = []T{value}
+		}
+	}
+
+	contains := func(list []T, value T) bool {
+		return slices.ContainsFunc(list, func(element T) bool { return equal(element, value) })
+	}
+	switch o.Op {
+	case Replace:
+		*target = append([]T{}, values...)
+	case Add:
+		for _, value := range values {
+			if !contains(*target, value) {
+				*target = append(*target, value)
+			}
+		}
+	case Remove:
+		if len(o.Value) == 0 {
+			*target = []T{}
+			return nil
+		}
+		*target = slices.DeleteFunc(*target, func(element T) bool { return contains(values, element) })
+	}
+	return nil
+}
+
+// decodeValue decodes a JSON value, rejecting the fields that images do not have.
+func decodeValue(data json.RawMessage, value any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(value); err != nil {
+		return fmt.Errorf("invalid value %s: %w", data, err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package override
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"merge-hotel/entity"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+// testHotel is the merged hotel that the overrides are applied to.
+func testHotel() entity.Hotel {
+	return entity.Hotel{
+		ID:            "iJhz",
+		DestinationID: 5432,
+		Name:          "Beach Villas",
+		Location:      entity.Location{Latitude: 1.26, Address: "8 Sentosa Gateway", Country: "SG"},
+		Amenities:     entity.Amenities{General: []string{"pool", "wifi"}, Room: []string{"tv"}},
+		Images: entity.Images{
+			Rooms: []entity.Image{{Link: "https://img.example/1.jpg", Description: "Double room"}},
+		},
+		BookingConditions: []string{"No pets."},
+		Provenance:        entity.Provenance{Suppliers: []string{"Acme"}},
+	}
+}
+
+func TestApply(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		field    string
+		op       Op
+		value    string
+		expected func(h *entity.Hotel)
+	}{
+		{
+			name: "replace text", field: "location.address", op: Replace, value: `"1 Beach View"`,
+			expected: func(h *entity.Hotel) { h.Location.Address = "1 Beach View" },
+		},
+		{
+			name: "replace number", field: "location.lat", op: Replace, value: `1.264751`,
+			expected: func(h *entity.Hotel) { h.Location.Latitude = 1.264751 },
+		},
+		{
+			name: "clear text", field: "location.country", op: Remove,
+			expected: func(h *entity.Hotel) { h.Location.Country = "" },
+		},
+		{
+			name: "replace list", field: "amenities.general", op: Replace, value: `["gym"]`,
+			expected: func(h *entity.Hotel) { h.Amenities.General = []string{"gym"} },
+		},
+		{
+			name: "add to list", field: "amenities.general", op: Add, value: `["Pool", "spa"]`,
+			expected: func(h *entity.Hotel) { h.Amenities.General = []string{"pool", "wifi", "spa"} },
+		},
+		{
+			name: "add an element", field: "booking_conditions", op: Add, value: `"Check-in from 3pm."`,
+			expected: func(h *entity.Hotel) { h.BookingConditions = []string{"No pets.", "Check-in from 3pm."} },
+		},
+		{
+			name: "remove from list", field: "amenities.general", op: Remove, value: `"WiFi"`,
+			expected: func(h *entity.Hotel) { h.Amenities.General = []string{"pool"} },
+		},
+		{
+			name: "clear list", field: "amenities.room", op: Remove,
+			expected: func(h *entity.Hotel) { h.Amenities.Room = []string{} },
+		},
+		{
+			name: "add an image", field: "images.site", op: Add, value: `{"link": "https://img.example/2.jpg", "description": "Front"}`,
+			expected: func(h *entity.Hotel) {
+				h.Images.Site = []entity.Image{{Link: "https://img.example/2.jpg", Description: "Front"}}
+			},
+		},
+		{
+			name: "remove an image by link", field: "images.rooms", op: Remove, value: `[{"link": "https://img.example/1.jpg"}]`,
+			expected: func(h *entity.Hotel) { h.Images.Rooms = []entity.Image{} },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := NewStore("")
+			testutil.Ok(t, err)
+			added, err := s.Add(Override{HotelID: "iJhz", Field: tc.field, Op: tc.op, Value: json.RawMessage(tc.value)})
+			testutil.Ok(t, err)
+
+			original := testHotel()
+			expected := testHotel()
+			tc.expected(&expected)
+			expected.Provenance.Overrides = []string{added.ID}
+			expected.Provenance.ModifiedAt = added.CreatedAt
+			testutil.Equals(t, expected, s.Apply(original))
+			testutil.Equals(t, testHotel(), original, "the hotel must not be modified")
+
+			// the overrides of other hotels do not apply
+			other := testHotel()
+			other.ID = "SjyX"
+			testutil.Equals(t, other, s.Apply(other))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		override Override
+		expected string
+	}{
+		{name: "no hotel", override: Override{Field: "name", Op: Replace, Value: json.RawMessage(`"A"`)}, expected: "hotel_id must be set"},
+		{name: "unknown field", override: Override{HotelID: "a", Field: "stars", Op: Replace, Value: json.RawMessage(`5`)}, expected: `unknown field "stars"`},
+		{name: "destination", override: Override{HotelID: "a", Field: "destination_id", Op: Replace, Value: json.RawMessage(`1122`)}, expected: "destination_id cannot be overridden"},
+		{name: "unknown op", override: Override{HotelID: "a", Field: "name", Op: "set", Value: json.RawMessage(`"A"`)}, expected: `unknown op "set"`},
+		{name: "add to text", override: Override{HotelID: "a", Field: "name", Op: Add, Value: json.RawMessage(`"A"`)}, expected: "add only applies to list fields"},
+		{name: "replace without value", override: Override{HotelID: "a", Field: "name", Op: Replace}, expected: "replace requires a value"},
+		{name: "wrong type", override: Override{HotelID: "a", Field: "location.lat", Op: Replace, Value: json.RawMessage(`"north"`)}, expected: "invalid value"},
+		{name: "unknown image field", override: Override{HotelID: "a", Field: "images.site", Op: Add, Value: json.RawMessage(`{"url": "x"}`)}, expected: "invalid value"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.override.Validate()
+			testutil.NotOk(t, err)
+			testutil.Assert(t, strings.Contains(err.Error(), tc.expected), "expected %q in %v", tc.expected, err)
+
+			s, err := NewStore("")
+			testutil.Ok(t, err)
+			_, err = s.Add(tc.override)
+			testutil.Assert(t, errors.Is(err, ErrInvalid), "expected an invalid override, got %v", err)
+		})
+	}
+}
+
+func TestStorePersistsOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	s, err := NewStore(path)
+	testutil.Ok(t, err)
+	first, err := s.Add(Override{HotelID: "iJhz", Field: "name", Op: Replace, Value: json.RawMessage(`"Beach Villas Singapore"`), Reason: "TICKET-1"})
+	testutil.Ok(t, err)
+	second, err := s.Add(Override{HotelID: "SjyX", Field: "location.city", Op: Replace, Value: json.RawMessage(`"Singapore"`)})
+	testutil.Ok(t, err)
+	testutil.Assert(t, first.ID != "" && first.ID != second.ID, "expected unique IDs, got %q and %q", first.ID, second.ID)
+
+	reloaded, err := NewStore(path)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []Override{first, second}, reloaded.List(""))
+	testutil.Equals(t, []Override{second}, reloaded.List("SjyX"))
+
+	_, ok, err := reloaded.Delete(first.ID)
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected the override to be deleted")
+	_, ok, err = reloaded.Delete(first.ID)
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected the override to be gone")
+
+	reloaded, err = NewStore(path)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []Override{second}, reloaded.List(""))
+
+	testutil.Ok(t, os.WriteFile(path, []byte(`[{"id": "x", "hotel_id": "a", "field": "stars", "op": "replace", "value": 5}]`), 0o600))
+	_, err = NewStore(path)
+	testutil.NotOk(t, err)
+}
@@ -0,0 +1,151 @@
+package override
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"merge-hotel/entity"
+)
+
+// ErrInvalid is returned by Store.Add when the override cannot be applied.
+var ErrInvalid = errors.New("invalid override")
+
+// Store holds the overrides in memory, and persists them to a file if it has one.
+type Store struct {
+	path string
+
+	mu        sync.RWMutex // guards overrides, and serialises the writes of the file
+	overrides []Override   // in the order they were added, which is the order they are applied in
+}
+
+// NewStore creates a store persisted to the JSON file at path, loading the overrides it holds if it exists.
+// An empty path keeps the overrides in memory only.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.overrides); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, o := range s.overrides {
+		if err := o.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: override %s: %w", path, o.ID, err)
+		}
+	}
+	return s, nil
+}
+
+// List returns the overrides of a hotel, or all the overrides if hotelID is empty, in the order they are applied in.
+func (s *Store) List(hotelID string) []Override {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	overrides := []Override{}
+	for _, o := range s.overrides {
+		if hotelID == "" || o.HotelID == hotelID {
+			overrides = append(overrides, o)
+		}
+	}
+	return overrides
+}
+
+// Add validates the override and stores it with a new ID, after the other overrides of the field.
+// It returns the stored override.
+func (s *Store) Add(o Override) (Override, error) {
+	if err := o.Validate(); err != nil {
+		return Override{}, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Override{}, err
+	}
+	o.ID = hex.EncodeToString(id)
+	o.CreatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	overrides := append(slices.Clone(s.overrides), o)
+	if err := s.save(overrides); err != nil {
+		return Override{}, err
+	}
+	s.overrides = overrides
+	return o, nil
+}
+
+// Delete removes the override with the given ID and returns it. It reports whether the override existed.
+func (s *Store) Delete(id string) (Override, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.overrides, func(o Override) bool { return o.ID == id })
+	if i < 0 {
+		return Override{}, false, nil
+	}
+	deleted := s.overrides[i]
+	overrides := slices.Delete(slices.Clone(s.overrides), i, i+1)
+	if err := s.save(overrides); err != nil {
+		return Override{}, true, err
+	}
+	s.overrides = overrides
+	return deleted, true, nil
+}
+
+// Apply returns a copy of the hotel with its overrides applied, and their IDs recorded in its provenance.
+// The hotel is modified when its newest override was added, if that is after its data was modified.
+func (s *Store) Apply(hotel entity.Hotel) entity.Hotel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hotel = hotel.Clone()
+	for _, o := range s.overrides {
+		if o.HotelID != hotel.ID {
+			continue
+		}
+		// the overrides were validated when they were added, so they always apply
+		if err := o.apply(&hotel); err == nil {
+			hotel.Provenance.Overrides = append(hotel.Provenance.Overrides, o.ID)
+			if o.CreatedAt.After(hotel.Provenance.ModifiedAt) {
+				hotel.Provenance.ModifiedAt = o.CreatedAt
+			}
+		}
+	}
+	return hotel
+}
+
+// save writes the overrides to the file of the store, replacing it atomically so that a crash never leaves
+// a truncated file.
+func (s *Store) save(overrides []Override) error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ProblemContentType is the media type of the error responses, see RFC 7807.
+const ProblemContentType = "application/problem+json"
+
+// HeaderRequestID identifies a request in the logs and in its error response. It is taken from the request if the
+// client or a proxy sets it, and generated otherwise.
+const HeaderRequestID = "X-Request-ID"
+
+// requestIDKey is the key of the request ID in the gin context.
+const requestIDKey = "request_id"
+
+// Code is the machine-readable code of a problem, which clients can branch on. The codes are stable, unlike the
+// titles and details, which are meant for humans.
+type Code string
+
+const (
+	// CodeInvalidParameter is a query or path parameter with an invalid value, listed in the invalid params.
+	CodeInvalidParameter Code = "invalid_parameter"
+	// CodeInvalidBody is a request body that cannot be decoded or is not valid.
+	CodeInvalidBody Code = "invalid_body"
+	// CodeUnauthorized is a request to the admin API without a valid token.
+	CodeUnauthorized Code = "unauthorized"
+	// CodeInvalidSignature is a push without a valid signature of the supplier.
+	CodeInvalidSignature Code = "invalid_signature"
+	// CodeNotFound is a route or resource that does not exist.
+	CodeNotFound Code = "not_found"
+	// CodeNotAcceptable is an Accept header that accepts none of the formats of the response.
+	CodeNotAcceptable Code = "not_acceptable"
+	// CodePayloadTooLarge is a request body larger than the endpoint accepts.
+	CodePayloadTooLarge Code = "payload_too_large"
+	// CodeSuppliersUnavailable is a search without hotels because suppliers failed.
+	CodeSuppliersUnavailable Code = "suppliers_unavailable"
+	// CodeSuppliersTimeout is a search without hotels because suppliers did not answer within the latency budget.
+	CodeSuppliersTimeout Code = "suppliers_timeout"
+	// CodeInternalError is an unexpected failure of the service.
+	CodeInternalError Code = "internal_error"
+)
+
+// codeTitles are the titles of the problems, which do not change from one occurrence of a problem to another.
+var codeTitles = map[Code]string{
+	CodeInvalidParameter:     "Invalid parameter",
+	CodeInvalidBody:          "Invalid request body",
+	CodeUnauthorized:         "Unauthorized",
+	CodeInvalidSignature:     "Invalid signature",
+	CodeNotFound:             "Not found",
+	CodeNotAcceptable:        "Not acceptable",
+	CodePayloadTooLarge:      "Payload too large",
+	CodeSuppliersUnavailable: "Suppliers unavailable",
+	CodeSuppliersTimeout:     "Suppliers timed out",
+	CodeInternalError:        "Internal server error",
+}
+
+// Problem is the body of an error response, see RFC 7807.
+type Problem struct {
+	// Type identifies the problem type, /problems/ followed by the code.
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+	// Instance is the path of the request.
+	Instance      string         `json:"instance,omitempty"`
+	Code          Code           `json:"code"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+	RequestID     string         `json:"request_id,omitempty"`
+}
+
+// InvalidParam is a parameter of the request with an invalid value.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// NewProblem creates the problem of the code, for the request of the context.
+func NewProblem(c *gin.Context, status int, code Code, detail string, invalidParams ...InvalidParam) Problem {
+	return Problem{
+		Type:          "/problems/" + string(code),
+		Title:         codeTitles[code],
+		Status:        status,
+		Detail:        detail,
+		Instance:      c.Request.URL.Path,
+		Code:          code,
+		InvalidParams: invalidParams,
+		RequestID:     c.GetString(requestIDKey),
+	}
+}
+
+// abortWithProblem aborts the request with an application/problem+json response.
+func abortWithProblem(c *gin.Context, status int, code Code, detail string, invalidParams ...InvalidParam) {
+	// the content type is kept by the JSON renderer as it is set already
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(status, NewProblem(c, status, code, detail, invalidParams...))
+}
+
+// abortWithInvalidParam aborts the request with a problem about a single invalid parameter, explained by reason.
+func abortWithInvalidParam(c *gin.Context, name, reason string) {
+	abortWithProblem(c, http.StatusBadRequest, CodeInvalidParameter, reason, InvalidParam{Name: name, Reason: reason})
+}
+
+// RequestID returns a middleware that sets the request ID of every request, and returns it in the X-Request-ID header.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(HeaderRequestID, id)
+		c.Next()
+	}
+}
+
+// validRequestID reports whether a request ID set by a client can be used, so that it cannot inject anything into
+// the headers or logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	// the random source of the operating system does not fail in practice
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NotFound answers the requests to unknown routes.
+func NotFound(c *gin.Context) {
+	abortWithProblem(c, http.StatusNotFound, CodeNotFound, ErrRouteNotFound)
+}
+
+// Recover answers the requests whose handler panicked with an internal error.
+func Recover(c *gin.Context, err any) {
+	log.Error().Interface("panic", err).Str("request_id", c.GetString(requestIDKey)).Msg("Recovered from panic")
+	abortWithProblem(c, http.StatusInternalServerError, CodeInternalError, ErrInternalServerError)
+}
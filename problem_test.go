@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/gin-gonic/gin"
+)
+
+// stubUsecase returns the same search result to every search.
+type stubUsecase struct {
+	result SearchResult
+}
+
+func (s stubUsecase) GetHotels(context.Context, []string, int) (SearchResult, error) {
+	return s.result, nil
+}
+
+func TestProblemResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	failed := MissingSupplier{Name: "Acme", Err: errors.New("connection refused")}
+	timedOut := MissingSupplier{Name: "Paperflies", Err: fmt.Errorf("abandoned: %w", context.DeadlineExceeded)}
+
+	for _, tc := range []struct {
+		name          string
+		target        string
+		accept        string
+		result        SearchResult
+		status        int
+		code          Code
+		invalidParams []InvalidParam
+	}{
+		{
+			name: "invalid destination", target: "/hotels?destination=north",
+			status: http.StatusBadRequest, code: CodeInvalidParameter,
+			invalidParams: []InvalidParam{{Name: "destination", Reason: ErrInvalidDestinationID}},
+		},
+		{
+			name: "negative destination", target: "/hotels?destination=-5",
+			status: http.StatusBadRequest, code: CodeInvalidParameter,
+			invalidParams: []InvalidParam{{Name: "destination", Reason: ErrInvalidDestinationID}},
+		},
+		{name: "not acceptable", target: "/hotels", accept: "image/png", status: http.StatusNotAcceptable, code: CodeNotAcceptable},
+		{name: "unknown route", target: "/hotel", status: http.StatusNotFound, code: CodeNotFound},
+		{
+			name: "suppliers failed", target: "/hotels", result: SearchResult{Missing: []MissingSupplier{failed, timedOut}},
+			status: http.StatusBadGateway, code: CodeSuppliersUnavailable,
+		},
+		{
+			name: "suppliers timed out", target: "/export", result: SearchResult{Missing: []MissingSupplier{timedOut}},
+			status: http.StatusGatewayTimeout, code: CodeSuppliersTimeout,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewHandler(stubUsecase{result: tc.result}, time.Minute)
+			router := gin.New()
+			router.Use(RequestID())
+			router.NoRoute(NotFound)
+			router.GET("/hotels", handler.GetHotels)
+			router.GET("/export", handler.Export)
+
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			req.Header.Set(HeaderRequestID, "req-1")
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			testutil.Equals(t, tc.status, rec.Code)
+			testutil.Equals(t, ProblemContentType, rec.Header().Get("Content-Type"))
+			testutil.Equals(t, "req-1", rec.Header().Get(HeaderRequestID))
+			var problem Problem
+			testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+			testutil.Equals(t, tc.code, problem.Code)
+			testutil.Equals(t, "/problems/"+string(tc.code), problem.Type)
+			testutil.Equals(t, codeTitles[tc.code], problem.Title)
+			testutil.Equals(t, tc.status, problem.Status)
+			testutil.Equals(t, "req-1", problem.RequestID)
+			testutil.Equals(t, req.URL.Path, problem.Instance)
+			testutil.Equals(t, tc.invalidParams, problem.InvalidParams)
+		})
+	}
+}
+
+func TestEmptySearchIsNotAnError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/hotels", NewHandler(stubUsecase{}, time.Minute).GetHotels)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hotels?hotels=unknown", nil))
+	testutil.Equals(t, http.StatusOK, rec.Code)
+	testutil.Equals(t, "[]", rec.Body.String())
+}
+
+func TestRequestID(t *testing.T) {
+	for _, tc := range []struct {
+		id    string
+		valid bool
+	}{
+		{id: "4bf92f3577b34da6a3ce929d0e0e4736", valid: true},
+		{id: "req_1.retry-2", valid: true},
+		{id: ""},
+		{id: "a b"},
+		{id: "a\r\nSet-Cookie: x"},
+		{id: string(make([]byte, 129))},
+	} {
+		testutil.Equals(t, tc.valid, validRequestID(tc.id), "%q", tc.id)
+	}
+
+	generated := newRequestID()
+	testutil.Assert(t, validRequestID(generated), "expected a valid generated ID, got %q", generated)
+	testutil.Assert(t, generated != newRequestID(), "expected unique generated IDs")
+}
@@ -0,0 +1,201 @@
+// Package ratelimit limits the requests sent to a supplier API, so that the concurrent fetches of the service
+// stay within the rate limits of the supplier. The rate is lowered when the supplier answers 429 Too Many Requests,
+// and recovers gradually as the requests succeed again.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Options configure the limits of a supplier. Zero values mean no limit.
+type Options struct {
+	// Rate is the number of requests per second.
+	Rate float64
+	// Burst is the number of requests that can be sent at once above the rate. It defaults to 1.
+	Burst int
+	// MaxInFlight is the maximum number of concurrent requests, including the reading of their body.
+	MaxInFlight int
+}
+
+// Enabled reports whether the requests are limited.
+func (o Options) Enabled() bool {
+	return o.Rate > 0 || o.MaxInFlight > 0
+}
+
+const (
+	// throttleFactor is the factor the rate is multiplied by on each 429 response.
+	throttleFactor = 0.5
+	// minRateFraction is the fraction of the configured rate below which the rate is never throttled.
+	minRateFraction = 0.1
+	// recoveryFraction is the fraction of the configured rate that is restored on each successful response.
+	recoveryFraction = 0.05
+	// maxRetryAfter bounds the pause requested by a supplier, so that a bogus Retry-After cannot stall the supplier.
+	maxRetryAfter = time.Minute
+)
+
+// Transport is an http.RoundTripper that queues the requests until both the rate limit and the in-flight cap allow
+// them. A request that cannot be sent before the deadline of its context fails immediately instead of queueing.
+type Transport struct {
+	opts     Options
+	next     http.RoundTripper
+	now      func() time.Time
+	limiter  *rate.Limiter // nil if there is no rate limit
+	inFlight chan struct{} // nil if there is no in-flight cap
+
+	mu          sync.Mutex // guards the pause and serialises the changes of the rate
+	pausedUntil time.Time
+}
+
+// NewTransport creates a Transport that wraps next. It returns next itself if the options are not enabled.
+func NewTransport(opts Options, next http.RoundTripper) http.RoundTripper {
+	if !opts.Enabled() {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t := &Transport{opts: opts, next: next, now: time.Now}
+	if opts.Rate > 0 {
+		t.limiter = rate.NewLimiter(rate.Limit(opts.Rate), max(opts.Burst, 1))
+	}
+	if opts.MaxInFlight > 0 {
+		t.inFlight = make(chan struct{}, opts.MaxInFlight)
+	}
+	return t
+}
+
+// Rate returns the current rate in requests per second, after throttling. It is zero if there is no rate limit.
+func (t *Transport) Rate() float64 {
+	if t.limiter == nil {
+		return 0
+	}
+	return float64(t.limiter.Limit())
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if t.inFlight != nil {
+		select {
+		case t.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for a free request slot: %w", ctx.Err())
+		}
+	}
+	release := sync.OnceFunc(func() {
+		if t.inFlight != nil {
+			<-t.inFlight
+		}
+	})
+
+	if err := t.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	t.adapt(res)
+	// the request is in flight until its body is read, as the responses are decoded while they are streamed
+	res.Body = &releasingBody{ReadCloser: res.Body, release: release}
+	return res, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport, if it supports it.
+func (t *Transport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// wait blocks until the supplier is not paused and the rate limit allows a request.
+// It fails immediately if that would be after the deadline of the context.
+func (t *Transport) wait(ctx context.Context) error {
+	t.mu.Lock()
+	pause := t.pausedUntil.Sub(t.now())
+	t.mu.Unlock()
+
+	var reservation *rate.Reservation
+	delay := max(pause, 0)
+	if t.limiter != nil {
+		reservation = t.limiter.Reserve()
+		delay = max(delay, reservation.Delay())
+	}
+	if deadline, ok := ctx.Deadline(); ok && t.now().Add(delay).After(deadline) {
+		if reservation != nil {
+			reservation.Cancel()
+		}
+		return fmt.Errorf("rate limited for %s: %w", delay.Round(time.Millisecond), context.DeadlineExceeded)
+	}
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		if reservation != nil {
+			reservation.Cancel()
+		}
+		return fmt.Errorf("rate limited: %w", ctx.Err())
+	}
+}
+
+// adapt throttles the rate when the supplier answers 429, pausing for its Retry-After,
+// and restores the rate gradually when the requests succeed.
+func (t *Transport) adapt(res *http.Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if res.StatusCode == http.StatusTooManyRequests {
+		if retryAfter := parseRetryAfter(res.Header.Get("Retry-After"), t.now()); retryAfter > 0 {
+			if until := t.now().Add(min(retryAfter, maxRetryAfter)); until.After(t.pausedUntil) {
+				t.pausedUntil = until
+			}
+		}
+		if t.limiter != nil {
+			t.limiter.SetLimit(rate.Limit(max(t.Rate()*throttleFactor, t.opts.Rate*minRateFraction)))
+		}
+		return
+	}
+	if t.limiter != nil && res.StatusCode < 400 && t.Rate() < t.opts.Rate {
+		t.limiter.SetLimit(rate.Limit(min(t.Rate()+t.opts.Rate*recoveryFraction, t.opts.Rate)))
+	}
+}
+
+// parseRetryAfter returns the duration of a Retry-After header, given either in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// releasingBody releases the request slot when the body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
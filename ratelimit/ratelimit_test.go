@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func get(ctx context.Context, client *http.Client, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	return res.StatusCode, res.Body.Close()
+}
+
+func TestTransportCapsInFlight(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewTransport(Options{MaxInFlight: 2}, nil)}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := get(context.Background(), client, srv.URL)
+			testutil.Ok(t, err)
+		}()
+	}
+	wg.Wait()
+	testutil.Equals(t, 2, maxInFlight)
+}
+
+func TestTransportRespectsDeadlines(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewTransport(Options{Rate: 1, Burst: 1}, nil)}
+	_, err := get(context.Background(), client, srv.URL)
+	testutil.Ok(t, err)
+
+	// the next token is a second away, so the request fails without waiting for it
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = get(ctx, client, srv.URL)
+	testutil.Assert(t, errors.Is(err, context.DeadlineExceeded), "expected a deadline error, got %v", err)
+	testutil.Assert(t, time.Since(start) < 50*time.Millisecond, "expected to fail immediately, took %v", time.Since(start))
+}
+
+func TestTransportAdaptsTo429(t *testing.T) {
+	var mu sync.Mutex
+	status, retryAfter := http.StatusTooManyRequests, ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	set := func(s int, after string) {
+		mu.Lock()
+		defer mu.Unlock()
+		status, retryAfter = s, after
+	}
+
+	transport := NewTransport(Options{Rate: 1000, Burst: 10}, nil).(*Transport)
+	client := &http.Client{Transport: transport}
+
+	// each 429 halves the rate, down to a tenth of the configured rate
+	for _, expected := range []float64{500, 250, 125, 100} {
+		code, err := get(context.Background(), client, srv.URL)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusTooManyRequests, code)
+		testutil.Equals(t, expected, transport.Rate())
+	}
+
+	// the rate recovers gradually with the successful responses
+	set(http.StatusOK, "")
+	for _, expected := range []float64{150, 200} {
+		_, err := get(context.Background(), client, srv.URL)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expected, transport.Rate())
+	}
+
+	// Retry-After pauses the requests
+	set(http.StatusTooManyRequests, "1")
+	_, err := get(context.Background(), client, srv.URL)
+	testutil.Ok(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = get(ctx, client, srv.URL)
+	testutil.Assert(t, errors.Is(err, context.DeadlineExceeded), "expected a deadline error, got %v", err)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "", expected: 0},
+		{value: "3", expected: 3 * time.Second},
+		{value: "Tue, 02 Jan 2024 15:04:15 GMT", expected: 10 * time.Second},
+		{value: "soon", expected: 0},
+	} {
+		testutil.Equals(t, tc.expected, parseRetryAfter(tc.value, now), "Retry-After %q", tc.value)
+	}
+}
+
+func TestNewTransportDisabled(t *testing.T) {
+	testutil.Equals(t, http.DefaultTransport, NewTransport(Options{}, http.DefaultTransport))
+}
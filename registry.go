@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sync"
+)
+
+// registeredSupplier is a supplier in the registry that keeps track of its in-flight fetches,
+// so that it can be drained when it is removed from the registry.
+type registeredSupplier struct {
+	HotelSupplier
+
+	mu       sync.Mutex
+	draining bool
+	inflight sync.WaitGroup
+}
+
+// acquire registers a new in-flight fetch. It returns false if the supplier is being drained and must not be used.
+func (s *registeredSupplier) acquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.draining {
+		return false
+	}
+	s.inflight.Add(1)
+	return true
+}
+
+// release marks an in-flight fetch as done.
+func (s *registeredSupplier) release() {
+	s.inflight.Done()
+}
+
+// drain stops new fetches from starting and waits for the in-flight fetches to complete.
+func (s *registeredSupplier) drain() {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	s.inflight.Wait()
+
+	// release the connections kept alive for the supplier, if it supports it
+	if closer, ok := s.HotelSupplier.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// SupplierRegistry is an immutable set of suppliers, keyed by supplier name.
+// The registry used by the usecase is replaced as a whole when the configuration is reloaded.
+type SupplierRegistry struct {
+	suppliers map[string]*registeredSupplier
+}
+
+// NewSupplierRegistry creates a registry from the given suppliers.
+func NewSupplierRegistry(suppliers map[string]HotelSupplier) *SupplierRegistry {
+	r := &SupplierRegistry{suppliers: make(map[string]*registeredSupplier, len(suppliers))}
+	for name, s := range suppliers {
+		r.suppliers[name] = &registeredSupplier{HotelSupplier: s}
+	}
+	return r
+}
+
+// Suppliers returns the suppliers in the registry, keyed by supplier name.
+func (r *SupplierRegistry) Suppliers() map[string]HotelSupplier {
+	suppliers := make(map[string]HotelSupplier, len(r.suppliers))
+	for name, s := range r.suppliers {
+		suppliers[name] = s.HotelSupplier
+	}
+	return suppliers
+}
+
+// replacedBy returns the registered suppliers of r that are not part of the next registry,
+// either because they were removed or because they were replaced by a new instance.
+// Suppliers that are carried over to the next registry keep their in-flight tracking.
+func (r *SupplierRegistry) replacedBy(next map[string]HotelSupplier) (*SupplierRegistry, []*registeredSupplier) {
+	nextRegistry := &SupplierRegistry{suppliers: make(map[string]*registeredSupplier, len(next))}
+	for name, s := range next {
+		if current, ok := r.suppliers[name]; ok && current.HotelSupplier == s {
+			nextRegistry.suppliers[name] = current
+			continue
+		}
+		nextRegistry.suppliers[name] = &registeredSupplier{HotelSupplier: s}
+	}
+
+	var replaced []*registeredSupplier
+	for name, current := range r.suppliers {
+		if nextRegistry.suppliers[name] != current {
+			replaced = append(replaced, current)
+		}
+	}
+	return nextRegistry, replaced
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"merge-hotel/supplier"
+)
+
+// SupplierReplacer is implemented by the usecase to swap the suppliers it fetches from.
+type SupplierReplacer interface {
+	// Suppliers returns the suppliers currently in use, keyed by supplier name.
+	Suppliers() map[string]HotelSupplier
+	// ReplaceSuppliers atomically swaps the suppliers in use. The returned channel is closed
+	// once the in-flight fetches of the removed suppliers have completed.
+	ReplaceSuppliers(suppliers map[string]HotelSupplier) <-chan struct{}
+}
+
+// ConfigReloader reloads the supplier configuration at runtime, when the configuration file changes
+// or when the process receives SIGHUP. Only the supplier and logging settings are applied live,
+// a change to any other setting requires a restart.
+type ConfigReloader struct {
+	path   string
+	hotels SupplierReplacer
+
+	mu      sync.Mutex // serialises reloads
+	current *Config
+}
+
+// NewConfigReloader creates a ConfigReloader for the configuration file at path, which was loaded as cfg.
+func NewConfigReloader(path string, cfg *Config, hotels SupplierReplacer) *ConfigReloader {
+	return &ConfigReloader{
+		path:    path,
+		hotels:  hotels,
+		current: cfg,
+	}
+}
+
+// Run reloads the configuration on SIGHUP, and whenever the configuration file changes if interval is positive.
+// It blocks until the context is cancelled.
+func (r *ConfigReloader) Run(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// a nil channel never fires, so file watching is disabled if there is no interval
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	lastStat := statFile(r.path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Info().Str("path", r.path).Msg("Received SIGHUP, reloading configuration")
+			lastStat = statFile(r.path)
+			r.Reload()
+		case <-tick:
+			stat := statFile(r.path)
+			if stat == lastStat {
+				continue
+			}
+			lastStat = stat
+			log.Info().Str("path", r.path).Msg("Configuration file changed, reloading configuration")
+			r.Reload()
+		}
+	}
+}
+
+// Reload loads and validates the configuration file and swaps the suppliers that changed.
+// If the new configuration is invalid, it is logged and the current configuration is kept.
+// It returns the channel returned by ReplaceSuppliers, or nil if nothing was swapped.
+func (r *ConfigReloader) Reload() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := LoadConfig(r.path)
+	if err != nil {
+		log.Error().Err(err).Str("path", r.path).Msg("Invalid configuration, keeping the current configuration")
+		return nil
+	}
+
+	if !reflect.DeepEqual(cfg.Logging, r.current.Logging) {
+		setupLogging(cfg.Logging)
+		log.Info().Msg("Applied new logging configuration")
+	}
+	if !reflect.DeepEqual(cfg.Server, r.current.Server) || !reflect.DeepEqual(cfg.Cache, r.current.Cache) ||
+		!reflect.DeepEqual(cfg.Admin, r.current.Admin) || !reflect.DeepEqual(cfg.Reload, r.current.Reload) ||
+		!reflect.DeepEqual(cfg.Fixtures, r.current.Fixtures) || !reflect.DeepEqual(cfg.Overrides, r.current.Overrides) ||
+		!reflect.DeepEqual(cfg.Suppression, r.current.Suppression) {
+		log.Warn().Msg("Only supplier and logging settings are reloaded, restart to apply the other changes")
+	}
+
+	added, removed, changed := diffSuppliers(r.current.Suppliers, cfg.Suppliers)
+	for _, name := range added {
+		log.Info().Str("supplier", name).Msg("Supplier added")
+	}
+	for _, name := range removed {
+		log.Info().Str("supplier", name).Msg("Supplier removed")
+	}
+	for _, name := range changed {
+		log.Info().Str("supplier", name).
+			Interface("old", r.current.Suppliers[name]).
+			Interface("new", cfg.Suppliers[name]).
+			Msg("Supplier changed")
+	}
+	r.current = cfg
+	if len(added)+len(removed)+len(changed) == 0 {
+		log.Info().Msg("No supplier changes")
+		return nil
+	}
+
+	// keep the instances of the unchanged suppliers so that their connections are reused
+	unchanged := make(map[string]bool)
+	for name := range cfg.Suppliers {
+		unchanged[name] = true
+	}
+	for _, name := range append(added, changed...) {
+		unchanged[name] = false
+	}
+	current := r.hotels.Suppliers()
+	next := make(map[string]HotelSupplier)
+	for name, sCfg := range cfg.Suppliers {
+		if sCfg.Disabled {
+			continue
+		}
+		if s, ok := current[name]; ok && unchanged[name] {
+			next[name] = s
+			continue
+		}
+		if pushed, ok := current[name].(*supplier.Pushed); ok && sCfg.Ingest.Enabled() {
+			// the pushed hotels are only in memory, so the instance is kept and only its key and format change
+			pushed.Update(sCfg.Ingest.Secret, supplierFileFormat(sCfg))
+			next[name] = pushed
+			continue
+		}
+		s, ok := newSupplierFromConfig(cfg, name)
+		if !ok {
+			log.Warn().Str("supplier", name).Msg("Unknown supplier, skipping")
+			continue
+		}
+		next[name] = s
+	}
+
+	drained := r.hotels.ReplaceSuppliers(next)
+	names := make([]string, 0, len(next))
+	for name := range next {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log.Info().Strs("suppliers", names).Msg("Swapped supplier registry")
+	return drained
+}
+
+// diffSuppliers returns the sorted names of the suppliers that were added, removed or changed between two configurations.
+func diffSuppliers(old, new map[string]SupplierConfig) (added, removed, changed []string) {
+	for name, newCfg := range new {
+		oldCfg, ok := old[name]
+		switch {
+		case !ok:
+			added = append(added, name)
+		case !reflect.DeepEqual(oldCfg, newCfg):
+			changed = append(changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// fileStat is the part of the file information used to detect changes.
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// statFile returns the modification time and size of the file, or the zero value if it cannot be read.
+func statFile(path string) fileStat {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStat{}
+	}
+	return fileStat{modTime: info.ModTime(), size: info.Size()}
+}
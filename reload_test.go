@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"merge-hotel/auth"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestDiffSuppliers(t *testing.T) {
+	old := map[string]SupplierConfig{
+		"Acme":      {URL: "http://acme.example", Timeout: time.Second},
+		"Patagonia": {URL: "http://patagonia.example", Timeout: time.Second},
+	}
+	new := map[string]SupplierConfig{
+		"Acme":       {URL: "http://acme.example", Timeout: 2 * time.Second},
+		"Paperflies": {URL: "http://paperflies.example", Timeout: time.Second},
+	}
+
+	added, removed, changed := diffSuppliers(old, new)
+	testutil.Equals(t, []string{"Paperflies"}, added)
+	testutil.Equals(t, []string{"Patagonia"}, removed)
+	testutil.Equals(t, []string{"Acme"}, changed)
+}
+
+func TestConfigReloaderSwapsChangedSuppliers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		testutil.Ok(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	writeConfig(`
+suppliers:
+  Acme:
+    url: "http://acme.example"
+  Patagonia:
+    url: "http://patagonia.example"
+`)
+	cfg, err := LoadConfig(path)
+	testutil.Ok(t, err)
+	hotelService := NewUsecaseImpl(setupSupplierRegistry(cfg), newHotelCache(cfg.Cache), UsecaseOptions{CacheTTL: cfg.Cache.TTL, LatencyBudget: cfg.Server.LatencyBudget})
+	reloader := NewConfigReloader(path, cfg, hotelService)
+	acme := hotelService.Suppliers()["Acme"]
+
+	// an invalid configuration is rejected and the suppliers are kept
+	writeConfig("suppliers:\n  Acme:\n    url: \"not a url\"\n")
+	testutil.Assert(t, reloader.Reload() == nil, "expected invalid configuration to be rejected")
+	testutil.Equals(t, 2, len(hotelService.Suppliers()))
+
+	// disabling Patagonia removes it, and the unchanged Acme instance is kept
+	writeConfig(`
+suppliers:
+  Acme:
+    url: "http://acme.example"
+  Patagonia:
+    url: "http://patagonia.example"
+    disabled: true
+`)
+	drained := reloader.Reload()
+	testutil.Assert(t, drained != nil, "expected the registry to be swapped")
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("expected the removed supplier to be drained")
+	}
+
+	suppliers := hotelService.Suppliers()
+	testutil.Equals(t, 1, len(suppliers))
+	testutil.Assert(t, suppliers["Acme"] == acme, "expected the Acme instance to be reused")
+}
+
+func TestConfigReloaderKeepsPushedHotels(t *testing.T) {
+	dir := t.TempDir()
+	path, secretPath := filepath.Join(dir, "config.yaml"), filepath.Join(dir, "direct.key")
+	testutil.Ok(t, os.WriteFile(secretPath, []byte("old-key"), 0o600))
+	testutil.Ok(t, os.WriteFile(path, []byte(`
+suppliers:
+  Direct:
+    kind: Paperflies
+    ingest:
+      secret_file: "`+secretPath+`"
+`), 0o600))
+	cfg, err := LoadConfig(path)
+	testutil.Ok(t, err)
+	hotelService := NewUsecaseImpl(setupSupplierRegistry(cfg), newHotelCache(cfg.Cache), UsecaseOptions{})
+	reloader := NewConfigReloader(path, cfg, hotelService)
+	pusher, ok := hotelService.Pusher("Direct")
+	testutil.Assert(t, ok, "expected Direct to accept pushes")
+	_, err = hotelService.Ingest(pusher, strings.NewReader(`{"hotel_id": "new1", "destination_id": 5432}`))
+	testutil.Ok(t, err)
+
+	// rotating the key changes the configuration, but the pushed hotels are kept
+	testutil.Ok(t, os.WriteFile(secretPath, []byte("new-key"), 0o600))
+	drained := reloader.Reload()
+	testutil.Assert(t, drained != nil, "expected the registry to be swapped")
+	rotated, ok := hotelService.Pusher("Direct")
+	testutil.Assert(t, ok && rotated == pusher, "expected the pushed supplier to be kept")
+	result, err := hotelService.GetHotels(context.Background(), nil, 5432)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"new1"}, sortedHotelIDs(result.Hotels))
+
+	body := []byte(`{"hotel_id": "new2", "destination_id": 5432}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	testutil.NotOk(t, rotated.Verify("POST", "/ingest/Direct", timestamp, auth.Signature("old-key", "POST", "/ingest/Direct", timestamp, body), body))
+	testutil.Ok(t, rotated.Verify("POST", "/ingest/Direct", timestamp, auth.Signature("new-key", "POST", "/ingest/Direct", timestamp, body), body))
+}
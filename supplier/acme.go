@@ -4,32 +4,30 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"merge-hotel/entity"
 	"net/http"
 	"strconv"
-	"time"
-
-	"github.com/carlmjohnson/requests"
 )
 
 // Acme is a supplier that fetches hotel data from the Acme API.
 type Acme struct {
 	client  *http.Client
 	address string
+	query   Query
+	// pages keeps the fetched pages with their validators, for conditional requests.
+	pages *pageCache
 }
 
 // NewAcme creates a new Acme supplier with the given endpoint address.
-func NewAcme(address string) *Acme {
-	t := http.DefaultTransport.(*http.Transport).Clone()
-	t.MaxIdleConns = 100
-	t.MaxConnsPerHost = 100
-	t.MaxIdleConnsPerHost = 100
-
+// The client is used for all the requests to the supplier, see NewHTTPClient.
+// The query holds the filters that the API applies server-side, if any.
+func NewAcme(address string, client *http.Client, query Query) *Acme {
 	return &Acme{
-		client: &http.Client{
-			Timeout: 2 * time.Second,
-		},
+		client:  client,
 		address: address,
+		query:   query,
+		pages:   newPageCache(),
 	}
 }
 
@@ -107,25 +105,30 @@ func parseOptionalFloat(raw json.RawMessage, target **float64) error {
 func convertAcmeResponseToHotels(responses []AcmeResponse) []entity.Hotel {
 	hotels := make([]entity.Hotel, len(responses))
 	for i, response := range responses {
-		hotels[i] = entity.Hotel{
-			ID:            response.ID,
-			DestinationID: response.DestinationID,
-			Name:          response.Name,
-			Location:      convertAcmeLocations(response),
-			Description:   response.Description,
-			Amenities:     convertAcmeAmenities(response.Facilities),
-			Images: entity.Images{
-				Rooms:     []entity.Image{},
-				Site:      []entity.Image{},
-				Amenities: []entity.Image{},
-			}, // assuming no image data is directly available from Acme's response
-			BookingConditions: []string{}, // Assuming no booking conditions data is directly available from Acme's response
-		}
+		hotels[i] = convertAcmeResponse(response)
 	}
 
 	return hotels
 }
 
+// convertAcmeResponse converts a single AcmeResponse to the common Hotel struct.
+func convertAcmeResponse(response AcmeResponse) entity.Hotel {
+	return entity.Hotel{
+		ID:            response.ID,
+		DestinationID: response.DestinationID,
+		Name:          response.Name,
+		Location:      convertAcmeLocations(response),
+		Description:   response.Description,
+		Amenities:     convertAcmeAmenities(response.Facilities),
+		Images: entity.Images{
+			Rooms:     []entity.Image{},
+			Site:      []entity.Image{},
+			Amenities: []entity.Image{},
+		}, // assuming no image data is directly available from Acme's response
+		BookingConditions: []string{}, // Assuming no booking conditions data is directly available from Acme's response
+	}
+}
+
 // convertAcmeLocation converts AcmeResponse location data to the common Location struct.
 func convertAcmeLocations(response AcmeResponse) entity.Location {
 	return entity.Location{
@@ -147,42 +150,34 @@ func convertAcmeAmenities(facilities []string) entity.Amenities {
 	}
 }
 
-// FetchHotels fetches hotels from the Acme API.
+// DecodeAcmeHotels decodes a response of the Acme API, a JSON array of hotels or NDJSON with a hotel per line,
+// into the common Hotel struct. It is used to process supplier data captured to files.
+func DecodeAcmeHotels(r io.Reader) ([]entity.Hotel, error) {
+	return decodeHotels(r, convertAcmeResponse)
+}
+
+// FetchHotels fetches the hotels from the Acme API. The filters of its query are applied server-side,
+// and all the filters are applied while the response is decoded.
 func (a *Acme) FetchHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error) {
-	// fetch hotels from the API
-	var res []AcmeResponse
-	err := requests.
-		URL(a.address).
-		ToJSON(&res).
-		Client(a.client).
-		Fetch(ctx)
+	hotels, err := fetchHotels(ctx, a.client, a.pages, a.address, a.query, hotelIDs, destinationID, jsonPages(a.query, convertAcmeResponse))
 	if err != nil {
 		return []entity.Hotel{}, err
 	}
+	return hotels, nil
+}
 
-	// filter hotels based on destination ID and hotel IDs if provided
-	var filteredHotels []AcmeResponse
-	hotelIDSet := make(map[string]bool) // create a map for quick lookup of HotelIDs
-	if len(hotelIDs) > 0 {              // if hotelIDs is not empty, fill the map with the provided hotel IDs
-		for _, id := range hotelIDs {
-			hotelIDSet[id] = true
-		}
-	}
-
-	for _, hotel := range res {
-		// determine if the hotel should be included based on the provided parameters
-		shouldIncludeDestination := (destinationID < 0) || hotel.DestinationID == destinationID
-		shouldIncludeHotel := (len(hotelIDs) <= 0) || hotelIDSet[hotel.ID]
-
-		if shouldIncludeDestination && shouldIncludeHotel {
-			filteredHotels = append(filteredHotels, hotel)
-		}
-	}
-
-	return convertAcmeResponseToHotels(filteredHotels), nil
+// Capabilities returns the filters that the Acme supplier applies. The hotel ID and destination filters are
+// always applied, server-side or while decoding.
+func (a *Acme) Capabilities() Capabilities {
+	return Capabilities{HotelIDs: true, Destination: true, Pagination: a.query.Capabilities().Pagination}
 }
 
 // GetName returns the name of the supplier.
 func (a *Acme) GetName() string {
 	return "Acme"
 }
+
+// CloseIdleConnections closes the connections to the supplier that are kept alive but not in use.
+func (a *Acme) CloseIdleConnections() {
+	a.client.CloseIdleConnections()
+}
@@ -2,6 +2,7 @@ package supplier
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"merge-hotel/entity"
@@ -143,3 +144,24 @@ func TestConvertAcmeResponseToHotels(t *testing.T) {
 func newFloat64(val float64) *float64 {
 	return &val
 }
+
+func TestDecodeAcmeHotels(t *testing.T) {
+	hotels, err := DecodeAcmeHotels(strings.NewReader(`[
+		{"Id": "iJhz", "DestinationId": 5432, "Name": "Beach Villas Singapore", "Latitude": 1.264751, "Longitude": "103.824006", "Facilities": ["Pool"]},
+		{"Id": "SjyX", "DestinationId": 5432, "Name": "InterContinental", "Latitude": null, "Longitude": ""}
+	]`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(hotels))
+	testutil.Equals(t, entity.Location{Latitude: 1.264751, Longitude: 103.824006}, hotels[0].Location)
+	testutil.Equals(t, entity.Location{}, hotels[1].Location)
+
+	// an object is the first record of NDJSON
+	hotels, err = DecodeAcmeHotels(strings.NewReader("{\"Id\": \"iJhz\"}\n{\"Id\": \"SjyX\"}\n"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"SjyX", "iJhz"}, hotelIDs(hotels))
+
+	_, err = DecodeAcmeHotels(strings.NewReader(`{"Id": "iJhz"} {"Id": 1}`))
+	testutil.NotOk(t, err)
+	_, err = DecodeAcmeHotels(strings.NewReader(`[{"Id": "iJhz"}`))
+	testutil.NotOk(t, err)
+}
@@ -0,0 +1,121 @@
+package supplier
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"merge-hotel/cache"
+	"merge-hotel/entity"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	// maxValidatedPages is the number of pages kept per supplier for conditional requests. Pages are keyed by URL,
+	// so the pages of filters pushed down to the supplier API are kept separately.
+	maxValidatedPages = 64
+	// maxValidatedBytes bounds the size of the bodies kept per supplier for conditional requests. A page whose body
+	// is larger is not kept, and is downloaded again on the next request.
+	maxValidatedBytes = 16 << 20
+	// validatedPageTTL is how long a page is kept for conditional requests after it was last downloaded.
+	validatedPageTTL = time.Hour
+)
+
+// validatedPage is the body of a page kept with the validators of its response, so that it can be decoded again
+// when the supplier answers a conditional request with 304 Not Modified.
+type validatedPage struct {
+	etag         string
+	lastModified string
+	// body is the body as it was received, still compressed, so that it takes less memory than the decoded hotels
+	// and can be stream-decoded again with the filters of each request.
+	body   []byte
+	header http.Header
+	// fetchedAt is when the page was fetched, the time its hotels were modified at if it has no Last-Modified.
+	fetchedAt time.Time
+}
+
+// pageCache keeps the pages fetched from a supplier with their validators.
+type pageCache = cache.Cache[string, validatedPage]
+
+// newPageCache creates the cache of validated pages of a supplier.
+func newPageCache() *pageCache {
+	return cache.New[string, validatedPage](cache.Options[string, validatedPage]{
+		MaxEntries: maxValidatedPages,
+		MaxBytes:   maxValidatedBytes,
+		SizeOf: func(pageURL string, page validatedPage) int64 {
+			return int64(len(pageURL) + len(page.body))
+		},
+	})
+}
+
+// cappedBuffer keeps what is written to it, unless it grows larger than max, in which case it drops it all.
+type cappedBuffer struct {
+	buf        bytes.Buffer
+	max        int
+	overflowed bool
+}
+
+// Write implements io.Writer. It never fails, so that reading through a TeeReader is not affected by the cap.
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.overflowed || b.buf.Len()+len(p) > b.max {
+		b.overflowed = true
+		b.buf = bytes.Buffer{}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// Bytes returns what was written, or nil if it overflowed.
+func (b *cappedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// acceptEncoding is the Accept-Encoding of the requests to the suppliers. Setting it disables the transparent
+// gzip decompression of http.Transport, so the responses are decompressed by decompressed.
+const acceptEncoding = "gzip, br"
+
+// decompressed returns the body of a response, decompressed according to the Content-Encoding of its header.
+// The caller must close it.
+func decompressed(header http.Header, body io.Reader) (io.ReadCloser, error) {
+	switch encoding := strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return io.NopCloser(body), nil
+	case "gzip", "x-gzip":
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	case "br":
+		return io.NopCloser(brotli.NewReader(body)), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// decodeBody decompresses and stream-decodes the body of a page.
+func decodeBody(header http.Header, body io.Reader, decode pageDecoder, filter hotelFilter) (decodedPage, error) {
+	r, err := decompressed(header, body)
+	if err != nil {
+		return decodedPage{}, err
+	}
+	defer r.Close()
+	return decode(r, filter)
+}
+
+// setModifiedAt records when the hotels of a page were modified: at the Last-Modified of the response if it has one,
+// otherwise when the page was fetched.
+func setModifiedAt(hotels []entity.Hotel, header http.Header, fetchedAt time.Time) {
+	modifiedAt := fetchedAt
+	if lastModified, err := http.ParseTime(header.Get("Last-Modified")); err == nil {
+		modifiedAt = lastModified
+	}
+	for i := range hotels {
+		hotels[i].Provenance.ModifiedAt = modifiedAt
+	}
+}
@@ -0,0 +1,149 @@
+package supplier
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/efficientgo/core/testutil"
+)
+
+const conditionalBody = `[{"Id": "a", "DestinationId": 1, "Facilities": ["Pool"]}, {"Id": "b", "DestinationId": 2}]`
+
+func TestFetchHotelsRevalidates(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		validator   string
+		value       string
+		conditional string
+	}{
+		{name: "etag", validator: "ETag", value: `"v1"`, conditional: "If-None-Match"},
+		{name: "last modified", validator: "Last-Modified", value: "Mon, 02 Jan 2006 15:04:05 GMT", conditional: "If-Modified-Since"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var conditions []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conditions = append(conditions, r.Header.Get(tc.conditional))
+				if r.Header.Get(tc.conditional) == tc.value {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set(tc.validator, tc.value)
+				_, _ = io.WriteString(w, conditionalBody)
+			}))
+			defer srv.Close()
+
+			s := NewAcme(srv.URL, srv.Client(), Query{})
+			hotels, err := s.FetchHotels(context.Background(), nil, 1)
+			testutil.Ok(t, err)
+			testutil.Equals(t, []string{"a"}, hotelIDs(hotels))
+			// the caller may modify the hotels without affecting the reused page
+			hotels[0].Amenities.General[0] = "modified"
+
+			// the page is reused with other filters
+			hotels, err = s.FetchHotels(context.Background(), nil, -1)
+			testutil.Ok(t, err)
+			testutil.Equals(t, []string{"a", "b"}, hotelIDs(hotels))
+			testutil.Equals(t, []string{"", tc.value}, conditions)
+			testutil.Equals(t, "Pool", hotels[0].Amenities.General[0])
+		})
+	}
+}
+
+func TestFetchHotelsWithoutValidators(t *testing.T) {
+	var conditional bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = conditional || r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != ""
+		_, _ = io.WriteString(w, conditionalBody)
+	}))
+	defer srv.Close()
+
+	s := NewAcme(srv.URL, srv.Client(), Query{})
+	for i := 0; i < 2; i++ {
+		hotels, err := s.FetchHotels(context.Background(), nil, -1)
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"a", "b"}, hotelIDs(hotels))
+	}
+	testutil.Assert(t, !conditional, "expected no conditional request without validators")
+}
+
+func TestFetchHotelsDecompresses(t *testing.T) {
+	var gzipped, brotlied bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	_, _ = io.WriteString(gw, conditionalBody)
+	testutil.Ok(t, gw.Close())
+	bw := brotli.NewWriter(&brotlied)
+	_, _ = io.WriteString(bw, conditionalBody)
+	testutil.Ok(t, bw.Close())
+
+	for encoding, body := range map[string][]byte{"gzip": gzipped.Bytes(), "br": brotlied.Bytes(), "": []byte(conditionalBody)} {
+		t.Run(encoding, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				testutil.Equals(t, acceptEncoding, r.Header.Get("Accept-Encoding"))
+				if encoding != "" {
+					w.Header().Set("Content-Encoding", encoding)
+				}
+				_, _ = w.Write(body)
+			}))
+			defer srv.Close()
+
+			hotels, err := NewAcme(srv.URL, srv.Client(), Query{}).FetchHotels(context.Background(), nil, -1)
+			testutil.Ok(t, err)
+			testutil.Equals(t, []string{"a", "b"}, hotelIDs(hotels))
+		})
+	}
+}
+
+func TestFetchHotelsKeepsCompressedBody(t *testing.T) {
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	_, _ = io.WriteString(gw, conditionalBody)
+	testutil.Ok(t, gw.Close())
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(gzipped.Bytes())
+	}))
+	defer srv.Close()
+
+	s := NewAcme(srv.URL, srv.Client(), Query{})
+	hotels, err := s.FetchHotels(context.Background(), nil, 2)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"b"}, hotelIDs(hotels))
+	// the body is kept as received, not the decoded hotels
+	testutil.Equals(t, int64(len(srv.URL)+gzipped.Len()), s.pages.Stats().Bytes)
+
+	items := s.pages.Items()
+	testutil.Equals(t, 1, len(items))
+	testutil.Equals(t, validatedPageTTL, items[0].ExpiresAt.Sub(items[0].CreatedAt))
+
+	hotels, err = s.FetchHotels(context.Background(), nil, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a", "b"}, hotelIDs(hotels))
+	testutil.Equals(t, 2, requests)
+}
+
+func TestCappedBuffer(t *testing.T) {
+	b := &cappedBuffer{max: 4}
+	_, _ = io.WriteString(b, "abc")
+	testutil.Equals(t, "abc", string(b.Bytes()))
+	n, err := io.WriteString(b, "de")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, n, "the writes succeed past the cap")
+	testutil.Assert(t, b.overflowed, "expected the buffer to overflow")
+	testutil.Equals(t, 0, len(b.Bytes()))
+	_, _ = io.WriteString(b, "f")
+	testutil.Equals(t, 0, len(b.Bytes()))
+}
@@ -0,0 +1,286 @@
+package supplier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"merge-hotel/entity"
+)
+
+// FeedFormat is the format of a supplier feed that is not a JSON API.
+type FeedFormat string
+
+const (
+	// FeedXML is an XML document with an element per hotel, such as an OTA hotel descriptive content feed.
+	FeedXML FeedFormat = "xml"
+	// FeedCSV is comma-separated text with a header row.
+	FeedCSV FeedFormat = "csv"
+	// FeedTSV is tab-separated text with a header row.
+	FeedTSV FeedFormat = "tsv"
+)
+
+// FeedFields are the fields of the hotel that the records of a feed can be mapped to. The image fields are
+// paired by position, the first link with the first description.
+var FeedFields = []string{
+	"id", "destination_id", "name", "description",
+	"location.lat", "location.lng", "location.address", "location.city", "location.country",
+	"amenities.general", "amenities.room",
+	"images.rooms.link", "images.rooms.description",
+	"images.site.link", "images.site.description",
+	"images.amenities.link", "images.amenities.description",
+	"booking_conditions",
+}
+
+// DefaultListSeparator separates the values of the list fields in a delimited text feed, if no separator is set.
+const DefaultListSeparator = "|"
+
+// Feed describes how the records of a feed map to hotels.
+type Feed struct {
+	Format FeedFormat
+	// Record is the slash-separated path of the element of each hotel in an XML feed, e.g. Hotels/Hotel.
+	// It is matched against the end of the path of the elements, so the root elements can be left out.
+	Record string
+	// Delimiter is the column delimiter of a delimited text feed. It defaults to a comma for csv and a tab for tsv.
+	Delimiter string
+	// ListSeparator separates the values of the list fields in a delimited text feed, see DefaultListSeparator.
+	ListSeparator string
+	// Fields maps the fields of the hotel, see FeedFields, to the column headers of a delimited text feed or to
+	// the paths of an XML feed. An XML path is relative to the record element, with slash-separated element names,
+	// an optional [@attribute=value] condition on each element, and a final @attribute to select an attribute
+	// instead of the text, e.g. Images/Image[@Category=room]/@URL.
+	Fields map[string]string
+}
+
+// Validate checks the feed description and returns all the problems found, joined into a single error.
+func (f Feed) Validate() error {
+	_, err := newFeedDecoder(f)
+	return err
+}
+
+// feedRecord holds the values of the mapped fields of a record, in the order they appear in the record.
+type feedRecord map[string][]string
+
+// first returns the first non-empty value of the field.
+func (r feedRecord) first(field string) string {
+	for _, value := range r[field] {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// list returns the non-empty values of the field.
+func (r feedRecord) list(field string) []string {
+	values := []string{}
+	for _, value := range r[field] {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// images pairs the links of a category of images with their descriptions.
+func (r feedRecord) images(category string) []entity.Image {
+	links, descriptions := r["images."+category+".link"], r["images."+category+".description"]
+	images := []entity.Image{}
+	for i, link := range links {
+		if link == "" {
+			continue
+		}
+		image := entity.Image{Link: link}
+		if i < len(descriptions) {
+			image.Description = descriptions[i]
+		}
+		images = append(images, image)
+	}
+	return images
+}
+
+// convertFeedRecord converts the record of a feed to the common Hotel struct.
+func convertFeedRecord(record feedRecord) (entity.Hotel, error) {
+	hotel := entity.Hotel{
+		ID:          record.first("id"),
+		Name:        record.first("name"),
+		Description: record.first("description"),
+		Location: entity.Location{
+			Address: record.first("location.address"),
+			City:    record.first("location.city"),
+			Country: record.first("location.country"),
+		},
+		Amenities: entity.Amenities{
+			General: record.list("amenities.general"),
+			Room:    record.list("amenities.room"),
+		},
+		Images: entity.Images{
+			Rooms:     record.images("rooms"),
+			Site:      record.images("site"),
+			Amenities: record.images("amenities"),
+		},
+		BookingConditions: record.list("booking_conditions"),
+	}
+
+	var err error
+	if value := record.first("destination_id"); value != "" {
+		if hotel.DestinationID, err = strconv.Atoi(value); err != nil {
+			return hotel, fmt.Errorf("hotel %q: destination_id: %w", hotel.ID, err)
+		}
+	}
+	// in the case of an empty value, we use 0 as the coordinate, as the other suppliers do
+	for field, target := range map[string]*float64{"location.lat": &hotel.Location.Latitude, "location.lng": &hotel.Location.Longitude} {
+		if value := record.first(field); value != "" {
+			if *target, err = strconv.ParseFloat(value, 64); err != nil {
+				return hotel, fmt.Errorf("hotel %q: %s: %w", hotel.ID, field, err)
+			}
+		}
+	}
+	return hotel, nil
+}
+
+// newFeedDecoder returns the page decoder of a feed, after checking its description.
+func newFeedDecoder(f Feed) (pageDecoder, error) {
+	var errs []error
+	if _, ok := f.Fields["id"]; !ok {
+		errs = append(errs, errors.New("fields: the id field must be mapped"))
+	}
+	fields := make([]string, 0, len(f.Fields))
+	for field := range f.Fields {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	for _, field := range fields {
+		if !slices.Contains(FeedFields, field) {
+			errs = append(errs, fmt.Errorf("fields: unknown field %q, must be one of %s", field, strings.Join(FeedFields, ", ")))
+		}
+	}
+
+	switch f.Format {
+	case FeedXML:
+		paths := make(map[string]xmlPath, len(f.Fields))
+		for _, field := range fields {
+			path, err := parseXMLPath(f.Fields[field])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("fields.%s: %w", field, err))
+			}
+			paths[field] = path
+		}
+		record := strings.Split(strings.Trim(f.Record, "/"), "/")
+		if f.Record == "" {
+			errs = append(errs, errors.New("record: the path of the hotel elements must be set for xml"))
+		}
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		return func(r io.Reader, filter hotelFilter) (decodedPage, error) {
+			return decodeXMLPage(r, record, paths, filter)
+		}, nil
+
+	case FeedCSV, FeedTSV:
+		delimiter := ','
+		if f.Format == FeedTSV {
+			delimiter = '\t'
+		}
+		if f.Delimiter != "" {
+			var size int
+			delimiter, size = utf8.DecodeRuneInString(f.Delimiter)
+			if size != len(f.Delimiter) || delimiter == '"' || delimiter == '\r' || delimiter == '\n' {
+				errs = append(errs, fmt.Errorf("delimiter: %q is not a valid delimiter", f.Delimiter))
+			}
+		}
+		separator := f.ListSeparator
+		if separator == "" {
+			separator = DefaultListSeparator
+		}
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		return func(r io.Reader, filter hotelFilter) (decodedPage, error) {
+			return decodeDelimitedPage(r, delimiter, separator, f.Fields, filter)
+		}, nil
+
+	default:
+		errs = append(errs, fmt.Errorf("format: unknown feed format %q, must be xml, csv or tsv", f.Format))
+		return nil, errors.Join(errs...)
+	}
+}
+
+// FeedSupplier is a supplier whose feed is XML or delimited text, mapped to hotels as described by a Feed.
+type FeedSupplier struct {
+	name    string
+	client  *http.Client
+	address string
+	query   Query
+	// pages keeps the fetched pages with their validators, for conditional requests.
+	pages  *pageCache
+	decode pageDecoder
+	// err is the problem of the feed description, returned by every fetch.
+	err error
+}
+
+// NewFeed creates a supplier that fetches the feed at the given endpoint address. The name of the supplier
+// is recorded in the provenance of its hotels. The query holds the filters that the API applies server-side,
+// if any; cursors are not supported, as they are read from JSON responses. If the feed description is invalid,
+// every fetch fails, see Feed.Validate.
+func NewFeed(name, address string, client *http.Client, query Query, feed Feed) *FeedSupplier {
+	decode, err := newFeedDecoder(feed)
+	return &FeedSupplier{
+		name:    name,
+		client:  client,
+		address: address,
+		query:   query,
+		pages:   newPageCache(),
+		decode:  decode,
+		err:     err,
+	}
+}
+
+// DecodeFeedHotels decodes a feed into the common Hotel struct, as described by feed.
+// It is used to process supplier data captured to files.
+func DecodeFeedHotels(r io.Reader, feed Feed) ([]entity.Hotel, error) {
+	decode, err := newFeedDecoder(feed)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decode(r, newHotelFilter(nil, -1))
+	if err != nil {
+		return nil, err
+	}
+	return decoded.hotels, nil
+}
+
+// FetchHotels fetches the hotels of the feed. The filters of its query are applied server-side,
+// and all the filters are applied while the feed is decoded.
+func (f *FeedSupplier) FetchHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error) {
+	if f.err != nil {
+		return []entity.Hotel{}, f.err
+	}
+	hotels, err := fetchHotels(ctx, f.client, f.pages, f.address, f.query, hotelIDs, destinationID, f.decode)
+	if err != nil {
+		return []entity.Hotel{}, err
+	}
+	return hotels, nil
+}
+
+// Capabilities returns the filters that the feed supplier applies. The hotel ID and destination filters are
+// always applied, server-side or while decoding.
+func (f *FeedSupplier) Capabilities() Capabilities {
+	return Capabilities{HotelIDs: true, Destination: true, Pagination: f.query.Capabilities().Pagination}
+}
+
+// GetName returns the name of the supplier.
+func (f *FeedSupplier) GetName() string {
+	return f.name
+}
+
+// CloseIdleConnections closes the connections to the supplier that are kept alive but not in use.
+func (f *FeedSupplier) CloseIdleConnections() {
+	f.client.CloseIdleConnections()
+}
@@ -0,0 +1,83 @@
+package supplier
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// listFields are the fields that hold several values, separated by the list separator in a delimited text feed.
+var listFields = map[string]bool{
+	"amenities.general": true, "amenities.room": true,
+	"images.rooms.link": true, "images.rooms.description": true,
+	"images.site.link": true, "images.site.description": true,
+	"images.amenities.link": true, "images.amenities.description": true,
+	"booking_conditions": true,
+}
+
+// decodeDelimitedPage stream-decodes a delimited text feed, converting and filtering the rows one at a time.
+// The first row is the header, and columns maps the fields of the hotel to the column headers.
+func decodeDelimitedPage(r io.Reader, delimiter rune, separator string, columns map[string]string, filter hotelFilter) (decodedPage, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.ReuseRecord = true
+	// tab-separated files seldom quote their values
+	reader.LazyQuotes = delimiter == '\t'
+
+	var decoded decodedPage
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return decoded, nil
+	}
+	if err != nil {
+		return decoded, err
+	}
+	indexes := make(map[string]int, len(header))
+	for i, name := range header {
+		// the header of files saved by spreadsheets may start with a byte order mark
+		indexes[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	fieldIndexes := make(map[string]int, len(columns))
+	for field, column := range columns {
+		i, ok := indexes[column]
+		if !ok {
+			return decoded, fmt.Errorf("column %q of field %s is not in the header", column, field)
+		}
+		fieldIndexes[field] = i
+	}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return decoded, nil
+		}
+		if err != nil {
+			return decoded, err
+		}
+		decoded.records++
+
+		record := make(feedRecord, len(fieldIndexes))
+		for field, i := range fieldIndexes {
+			value := strings.TrimSpace(row[i])
+			if !listFields[field] {
+				record[field] = []string{value}
+				continue
+			}
+			values := strings.Split(value, separator)
+			for j := range values {
+				values[j] = strings.TrimSpace(values[j])
+			}
+			record[field] = values
+		}
+		hotel, err := convertFeedRecord(record)
+		if err != nil {
+			line, _ := reader.FieldPos(0)
+			return decoded, fmt.Errorf("line %d: %w", line, err)
+		}
+		if filter.match(hotel) {
+			decoded.hotels = append(decoded.hotels, hotel)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package supplier
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"merge-hotel/entity"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+// otaFeed is an XML feed in the style of an OTA hotel descriptive content response.
+const otaFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<OTA_HotelDescriptiveInfoRS xmlns="http://www.opentravel.org/OTA/2003/05">
+  <HotelDescriptiveContents>
+    <HotelDescriptiveContent HotelCode="h1" DestinationCode="5432">
+      <HotelName>Beach Villas</HotelName>
+      <Position Latitude="1.264751" Longitude="103.824006"/>
+      <Address><AddressLine>8 Sentosa Gateway</AddressLine><CityName>Singapore</CityName><CountryName>SG</CountryName></Address>
+      <Amenities>
+        <Amenity Scope="hotel">Pool</Amenity>
+        <Amenity Scope="room">Aircon</Amenity>
+        <Amenity Scope="hotel">WiFi</Amenity>
+      </Amenities>
+      <Images>
+        <Image Category="room" URL="https://img.example/1.jpg"><Caption>Double room</Caption></Image>
+        <Image Category="site" URL="https://img.example/2.jpg"><Caption>Front</Caption></Image>
+      </Images>
+    </HotelDescriptiveContent>
+    <HotelDescriptiveContent HotelCode="h2" DestinationCode="1122">
+      <HotelName>  City Inn  </HotelName>
+    </HotelDescriptiveContent>
+  </HotelDescriptiveContents>
+</OTA_HotelDescriptiveInfoRS>`
+
+// otaFeedDescription maps otaFeed to hotels.
+var otaFeedDescription = Feed{
+	Format: FeedXML,
+	Record: "HotelDescriptiveContents/HotelDescriptiveContent",
+	Fields: map[string]string{
+		"id":                       "@HotelCode",
+		"destination_id":           "@DestinationCode",
+		"name":                     "HotelName",
+		"location.lat":             "Position/@Latitude",
+		"location.lng":             "Position/@Longitude",
+		"location.address":         "Address/AddressLine",
+		"location.city":            "Address/CityName",
+		"location.country":         "Address/CountryName",
+		"amenities.general":        "Amenities/Amenity[@Scope=hotel]",
+		"amenities.room":           "Amenities/Amenity[@Scope='room']",
+		"images.rooms.link":        "Images/Image[@Category=room]/@URL",
+		"images.rooms.description": "Images/Image[@Category=room]/Caption",
+		"images.site.link":         "Images/Image[@Category=site]/@URL",
+		"images.site.description":  "Images/Image[@Category=site]/Caption",
+	},
+}
+
+func TestDecodeFeedHotels(t *testing.T) {
+	beachVillas := entity.Hotel{
+		ID:            "h1",
+		DestinationID: 5432,
+		Name:          "Beach Villas",
+		Location:      entity.Location{Latitude: 1.264751, Longitude: 103.824006, Address: "8 Sentosa Gateway", City: "Singapore", Country: "SG"},
+		Amenities:     entity.Amenities{General: []string{"Pool", "WiFi"}, Room: []string{"Aircon"}},
+		Images: entity.Images{
+			Rooms:     []entity.Image{{Link: "https://img.example/1.jpg", Description: "Double room"}},
+			Site:      []entity.Image{{Link: "https://img.example/2.jpg", Description: "Front"}},
+			Amenities: []entity.Image{},
+		},
+		BookingConditions: []string{},
+	}
+	cityInn := entity.Hotel{
+		ID:                "h2",
+		DestinationID:     1122,
+		Name:              "City Inn",
+		Amenities:         entity.Amenities{General: []string{}, Room: []string{}},
+		Images:            entity.Images{Rooms: []entity.Image{}, Site: []entity.Image{}, Amenities: []entity.Image{}},
+		BookingConditions: []string{},
+	}
+	delimitedFields := map[string]string{
+		"id":                       "hotel_id",
+		"destination_id":           "destination",
+		"name":                     "name",
+		"location.lat":             "lat",
+		"location.lng":             "lng",
+		"location.address":         "address",
+		"location.city":            "city",
+		"location.country":         "country",
+		"amenities.general":        "facilities",
+		"amenities.room":           "room_facilities",
+		"images.rooms.link":        "room_images",
+		"images.rooms.description": "room_captions",
+		"images.site.link":         "site_images",
+		"images.site.description":  "site_captions",
+	}
+
+	for _, tc := range []struct {
+		name     string
+		body     string
+		feed     Feed
+		expected []entity.Hotel
+	}{
+		{
+			name:     "xml",
+			body:     otaFeed,
+			feed:     otaFeedDescription,
+			expected: []entity.Hotel{beachVillas, cityInn},
+		},
+		{
+			name: "csv",
+			body: "\ufeffhotel_id,destination,name,lat,lng,address,city,country,facilities,room_facilities,room_images,room_captions,site_images,site_captions\n" +
+				`h1,5432,Beach Villas,1.264751,103.824006,8 Sentosa Gateway,Singapore,SG,Pool | WiFi,Aircon,https://img.example/1.jpg,Double room,https://img.example/2.jpg,Front` + "\n" +
+				`h2,1122,"  City Inn  ",,,,,,,,,,,` + "\n",
+			feed:     Feed{Format: FeedCSV, Fields: delimitedFields},
+			expected: []entity.Hotel{beachVillas, cityInn},
+		},
+		{
+			name: "tsv with a list separator",
+			body: "hotel_id\tdestination\tname\tlat\tlng\taddress\tcity\tcountry\tfacilities\troom_facilities\troom_images\troom_captions\tsite_images\tsite_captions\n" +
+				"h1\t5432\tBeach Villas\t1.264751\t103.824006\t8 Sentosa Gateway\tSingapore\tSG\tPool;WiFi\tAircon\thttps://img.example/1.jpg\tDouble room\thttps://img.example/2.jpg\tFront\n",
+			feed:     Feed{Format: FeedTSV, ListSeparator: ";", Fields: delimitedFields},
+			expected: []entity.Hotel{beachVillas},
+		},
+		{
+			name:     "semicolon delimiter",
+			body:     "id;name\nh2;City Inn\n",
+			feed:     Feed{Format: FeedCSV, Delimiter: ";", Fields: map[string]string{"id": "id", "name": "name"}},
+			expected: []entity.Hotel{{ID: "h2", Name: "City Inn", Amenities: cityInn.Amenities, Images: cityInn.Images, BookingConditions: []string{}}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hotels, err := DecodeFeedHotels(strings.NewReader(tc.body), tc.feed)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expected, hotels)
+		})
+	}
+}
+
+func TestDecodeFeedHotelsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+		feed Feed
+	}{
+		{name: "truncated xml", body: otaFeed[:len(otaFeed)/2], feed: otaFeedDescription},
+		{name: "invalid coordinate", body: `<Hotels><Hotel Id="a"><Lat>north</Lat></Hotel></Hotels>`, feed: Feed{Format: FeedXML, Record: "Hotel", Fields: map[string]string{"id": "@Id", "location.lat": "Lat"}}},
+		{name: "missing column", body: "id,name\na,A\n", feed: Feed{Format: FeedCSV, Fields: map[string]string{"id": "id", "location.city": "city"}}},
+		{name: "invalid destination", body: "id,destination\na,five\n", feed: Feed{Format: FeedCSV, Fields: map[string]string{"id": "id", "destination_id": "destination"}}},
+		{name: "ragged row", body: "id,name\na,A,extra\n", feed: Feed{Format: FeedCSV, Fields: map[string]string{"id": "id"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DecodeFeedHotels(strings.NewReader(tc.body), tc.feed)
+			testutil.NotOk(t, err)
+		})
+	}
+}
+
+func TestFeedValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		feed     Feed
+		expected []string
+	}{
+		{
+			name:     "unknown format",
+			feed:     Feed{Format: "json", Fields: map[string]string{"id": "id"}},
+			expected: []string{`format: unknown feed format "json", must be xml, csv or tsv`},
+		},
+		{
+			name: "invalid xml paths",
+			feed: Feed{Format: FeedXML, Record: "Hotel", Fields: map[string]string{"id": "@", "name": "Names[Name]", "description": "Text[@lang=en"}},
+			expected: []string{
+				`fields.description: "Text[@lang=en": invalid condition "[@lang=en", expected [@attribute=value]`,
+				`fields.id: "@": empty attribute name`,
+				`fields.name: "Names[Name]": invalid condition "[Name]", expected [@attribute=value]`,
+			},
+		},
+		{
+			name:     "invalid delimiter",
+			feed:     Feed{Format: FeedCSV, Delimiter: "::", Fields: map[string]string{"id": "id"}},
+			expected: []string{`delimiter: "::" is not a valid delimiter`},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.feed.Validate()
+			testutil.NotOk(t, err)
+			testutil.Equals(t, tc.expected, strings.Split(err.Error(), "\n"))
+		})
+	}
+	testutil.Ok(t, otaFeedDescription.Validate())
+}
+
+func TestFeedSupplierFetchHotels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = w.Write([]byte(otaFeed))
+	}))
+	defer srv.Close()
+
+	s := NewFeed("OTA", srv.URL, srv.Client(), Query{}, otaFeedDescription)
+	testutil.Equals(t, "OTA", s.GetName())
+	testutil.Equals(t, Capabilities{HotelIDs: true, Destination: true}, s.Capabilities())
+
+	hotels, err := s.FetchHotels(context.Background(), nil, 1122)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"h2"}, hotelIDs(hotels))
+
+	invalid := NewFeed("OTA", srv.URL, srv.Client(), Query{}, Feed{Format: FeedXML})
+	_, err = invalid.FetchHotels(context.Background(), nil, -1)
+	testutil.NotOk(t, err)
+}
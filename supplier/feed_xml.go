@@ -0,0 +1,180 @@
+package supplier
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlStep selects the child elements with a name, and optionally an attribute value.
+type xmlStep struct {
+	name      string
+	attribute string
+	value     string
+}
+
+// xmlPath selects values relative to a record element: the text of the elements selected by steps,
+// or their attribute if attribute is set.
+type xmlPath struct {
+	steps     []xmlStep
+	attribute string
+}
+
+// parseXMLPath parses a path such as Address/Line, @HotelCode or Images/Image[@Category=room]/@URL.
+func parseXMLPath(path string) (xmlPath, error) {
+	var parsed xmlPath
+	if path == "" || path == "." {
+		return parsed, nil
+	}
+	segments := strings.Split(path, "/")
+	if last := segments[len(segments)-1]; strings.HasPrefix(last, "@") {
+		parsed.attribute = last[1:]
+		if parsed.attribute == "" {
+			return parsed, fmt.Errorf("%q: empty attribute name", path)
+		}
+		segments = segments[:len(segments)-1]
+	}
+	for _, segment := range segments {
+		name, condition, hasCondition := strings.Cut(segment, "[")
+		step := xmlStep{name: name}
+		if name == "" || strings.ContainsAny(name, "@]=") {
+			return parsed, fmt.Errorf("%q: invalid element name %q", path, name)
+		}
+		if hasCondition {
+			inner, ok := strings.CutSuffix(condition, "]")
+			attribute, value, hasValue := strings.Cut(strings.TrimPrefix(inner, "@"), "=")
+			if !ok || !hasValue || !strings.HasPrefix(inner, "@") || attribute == "" {
+				return parsed, fmt.Errorf("%q: invalid condition %q, expected [@attribute=value]", path, "["+condition)
+			}
+			step.attribute, step.value = attribute, strings.Trim(value, `'"`)
+		}
+		parsed.steps = append(parsed.steps, step)
+	}
+	return parsed, nil
+}
+
+// xmlNode is an element of a record, decoded with its attributes, text and children.
+type xmlNode struct {
+	name       string
+	attributes map[string]string
+	text       strings.Builder
+	children   []*xmlNode
+}
+
+// values returns the values selected by the path in the record.
+func (p xmlPath) values(record *xmlNode) []string {
+	nodes := []*xmlNode{record}
+	for _, step := range p.steps {
+		var next []*xmlNode
+		for _, node := range nodes {
+			for _, child := range node.children {
+				if child.name == step.name && (step.attribute == "" || child.attributes[step.attribute] == step.value) {
+					next = append(next, child)
+				}
+			}
+		}
+		nodes = next
+	}
+
+	values := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if p.attribute == "" {
+			values = append(values, strings.TrimSpace(node.text.String()))
+		} else if value, ok := node.attributes[p.attribute]; ok {
+			values = append(values, strings.TrimSpace(value))
+		}
+	}
+	return values
+}
+
+// decodeXMLPage stream-decodes an XML feed, converting and filtering the record elements one at a time.
+// Only one record is kept in memory while it is decoded.
+func decodeXMLPage(r io.Reader, record []string, paths map[string]xmlPath, filter hotelFilter) (decodedPage, error) {
+	dec := xml.NewDecoder(r)
+	var decoded decodedPage
+	var stack []string
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			if len(stack) > 0 {
+				return decoded, io.ErrUnexpectedEOF
+			}
+			return decoded, nil
+		}
+		if err != nil {
+			return decoded, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			if !hasSuffix(stack, record) {
+				continue
+			}
+			node, err := decodeXMLNode(dec, t)
+			if err != nil {
+				return decoded, err
+			}
+			stack = stack[:len(stack)-1]
+			decoded.records++
+
+			fields := make(feedRecord, len(paths))
+			for field, path := range paths {
+				fields[field] = path.values(node)
+			}
+			hotel, err := convertFeedRecord(fields)
+			if err != nil {
+				return decoded, err
+			}
+			if filter.match(hotel) {
+				decoded.hotels = append(decoded.hotels, hotel)
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// decodeXMLNode decodes the element that starts with start, up to and including its end element.
+func decodeXMLNode(dec *xml.Decoder, start xml.StartElement) (*xmlNode, error) {
+	node := &xmlNode{name: start.Name.Local, attributes: make(map[string]string, len(start.Attr))}
+	for _, attr := range start.Attr {
+		node.attributes[attr.Name.Local] = attr.Value
+	}
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLNode(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			node.children = append(node.children, child)
+		case xml.CharData:
+			node.text.Write(t)
+		case xml.EndElement:
+			return node, nil
+		}
+	}
+}
+
+// hasSuffix reports whether the element path ends with the record path.
+func hasSuffix(path, suffix []string) bool {
+	if len(path) < len(suffix) {
+		return false
+	}
+	for i, name := range suffix {
+		if path[len(path)-len(suffix)+i] != name {
+			return false
+		}
+	}
+	return true
+}
@@ -1,5 +1,23 @@
 package supplier
 
+import (
+	"net/http"
+	"time"
+)
+
+// NewHTTPClient creates an HTTP client suitable for fetching from a supplier, with the given request timeout.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = 100
+	t.MaxConnsPerHost = 100
+	t.MaxIdleConnsPerHost = 100
+
+	return &http.Client{
+		Transport: t,
+		Timeout:   timeout,
+	}
+}
+
 // derefFloat64 safely dereferences a float64 pointer, returning 0 if the pointer is nil.
 func derefFloat64(f *float64) float64 {
 	if f != nil {
@@ -0,0 +1,179 @@
+package supplier
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"merge-hotel/entity"
+)
+
+// FileFormat is the format of the files of a local supplier.
+type FileFormat struct {
+	// Extensions are the extensions of the files read from a directory, e.g. .json. A file given as the path
+	// of the supplier is read whatever its extension.
+	Extensions []string
+	// Decode decodes the hotels of a file.
+	Decode func(r io.Reader) ([]entity.Hotel, error)
+}
+
+// JSONFiles is the format of the files holding hotels in the response format of a supplier,
+// a JSON array or NDJSON, decoded by decode, e.g. DecodeAcmeHotels.
+func JSONFiles(decode func(r io.Reader) ([]entity.Hotel, error)) FileFormat {
+	return FileFormat{Extensions: []string{".json", ".ndjson", ".jsonl"}, Decode: decode}
+}
+
+// FeedFiles is the format of the files of an XML or delimited text feed.
+func FeedFiles(feed Feed) FileFormat {
+	return FileFormat{
+		Extensions: []string{"." + string(feed.Format)},
+		Decode: func(r io.Reader) ([]entity.Hotel, error) {
+			return DecodeFeedHotels(r, feed)
+		},
+	}
+}
+
+// localFile is the state of a file of a local supplier, used to detect changes.
+type localFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Local is a supplier that reads hotels from a local file, or from the files of a directory, such as manual
+// overrides and curated hotels. The files are read on the first fetch, and read again when they change
+// if they are watched.
+type Local struct {
+	name   string
+	path   string
+	format FileFormat
+	watch  time.Duration
+
+	mu        sync.Mutex // guards the fields below, and serialises the reads of the files
+	hotels    []entity.Hotel
+	files     []localFile
+	loaded    bool
+	checkedAt time.Time
+}
+
+// NewLocal creates a supplier that reads the hotels of the file or directory at path, in the given format.
+// The name of the supplier is recorded in the provenance of its hotels. If watch is positive, the files are
+// checked for changes at most once per watch interval, when hotels are fetched.
+func NewLocal(name, path string, format FileFormat, watch time.Duration) *Local {
+	return &Local{name: name, path: path, format: format, watch: watch}
+}
+
+// FetchHotels returns the hotels of the files that match the hotel IDs and destination.
+// If the files cannot be read, the hotels read before are not returned, so that a broken edit is noticed.
+func (l *Local) FetchHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error) {
+	if err := ctx.Err(); err != nil {
+		return []entity.Hotel{}, err
+	}
+	hotels, err := l.load()
+	if err != nil {
+		return []entity.Hotel{}, err
+	}
+
+	filter := newHotelFilter(hotelIDs, destinationID)
+	matched := []entity.Hotel{}
+	for _, hotel := range hotels {
+		if filter.match(hotel) {
+			// the hotels are cleaned and merged in place, so the ones read from the files are kept intact
+			matched = append(matched, hotel.Clone())
+		}
+	}
+	return matched, nil
+}
+
+// load returns the hotels of the files, reading them if they have not been read yet or if they changed.
+func (l *Local) load() ([]entity.Hotel, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.loaded && (l.watch <= 0 || time.Since(l.checkedAt) < l.watch) {
+		return l.hotels, nil
+	}
+	files, err := l.list()
+	if err != nil {
+		l.loaded = false
+		return nil, err
+	}
+	l.checkedAt = time.Now()
+	if l.loaded && slices.Equal(files, l.files) {
+		return l.hotels, nil
+	}
+
+	var hotels []entity.Hotel
+	for _, file := range files {
+		fileHotels, err := readHotelsFile(file.path, l.format)
+		if err != nil {
+			l.loaded = false
+			return nil, err
+		}
+		for i := range fileHotels {
+			fileHotels[i].Provenance.ModifiedAt = file.modTime
+		}
+		hotels = append(hotels, fileHotels...)
+	}
+	l.hotels, l.files, l.loaded = hotels, files, true
+	return hotels, nil
+}
+
+// list returns the files of the supplier in a stable order: the path itself if it is a file,
+// otherwise the files of the directory and its subdirectories with one of the extensions of the format.
+func (l *Local) list() ([]localFile, error) {
+	var files []localFile
+	err := filepath.WalkDir(l.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path != l.path && !slices.Contains(l.format.Extensions, strings.ToLower(filepath.Ext(path))) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, localFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no %s files found", l.path, strings.Join(l.format.Extensions, ", "))
+	}
+	return files, nil
+}
+
+// readHotelsFile decodes the hotels of a file in the given format.
+func readHotelsFile(path string, format FileFormat) ([]entity.Hotel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hotels, err := format.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return hotels, nil
+}
+
+// Capabilities returns the filters that the local supplier applies, all of them as the hotels are in memory.
+func (l *Local) Capabilities() Capabilities {
+	return Capabilities{HotelIDs: true, Destination: true}
+}
+
+// GetName returns the name of the supplier.
+func (l *Local) GetName() string {
+	return l.name
+}
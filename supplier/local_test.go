@@ -0,0 +1,86 @@
+package supplier
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestLocalFetchHotels(t *testing.T) {
+	dir := t.TempDir()
+	testutil.Ok(t, os.WriteFile(filepath.Join(dir, "curated.json"), []byte(`[{"Id": "a", "DestinationId": 1}, {"Id": "b", "DestinationId": 2}]`), 0o600))
+	testutil.Ok(t, os.MkdirAll(filepath.Join(dir, "overrides"), 0o700))
+	testutil.Ok(t, os.WriteFile(filepath.Join(dir, "overrides", "c.ndjson"), []byte("{\"Id\": \"c\", \"DestinationId\": 1}\n\n{\"Id\": \"d\", \"DestinationId\": 3}\n"), 0o600))
+	testutil.Ok(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not hotels"), 0o600))
+
+	for _, tc := range []struct {
+		name          string
+		path          string
+		hotelIDs      []string
+		destinationID int
+		expectedIDs   []string
+	}{
+		{name: "directory", path: dir, destinationID: -1, expectedIDs: []string{"a", "b", "c", "d"}},
+		{name: "destination", path: dir, destinationID: 1, expectedIDs: []string{"a", "c"}},
+		{name: "hotel IDs", path: dir, hotelIDs: []string{"b", "d"}, destinationID: -1, expectedIDs: []string{"b", "d"}},
+		{name: "file", path: filepath.Join(dir, "overrides", "c.ndjson"), destinationID: -1, expectedIDs: []string{"c", "d"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewLocal("Curated", tc.path, JSONFiles(DecodeAcmeHotels), 0)
+			hotels, err := s.FetchHotels(context.Background(), tc.hotelIDs, tc.destinationID)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expectedIDs, hotelIDs(hotels))
+		})
+	}
+}
+
+func TestLocalWatchesFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "curated.json")
+	write := func(body string, modTime time.Time) {
+		testutil.Ok(t, os.WriteFile(path, []byte(body), 0o600))
+		testutil.Ok(t, os.Chtimes(path, modTime, modTime))
+	}
+	fetch := func(s *Local) ([]string, error) {
+		hotels, err := s.FetchHotels(context.Background(), nil, -1)
+		return hotelIDs(hotels), err
+	}
+	start := time.Now().Add(-time.Hour)
+	write(`[{"Id": "a"}]`, start)
+
+	watched := NewLocal("Curated", path, JSONFiles(DecodeAcmeHotels), time.Nanosecond)
+	unwatched := NewLocal("Curated", path, JSONFiles(DecodeAcmeHotels), 0)
+	for _, s := range []*Local{watched, unwatched} {
+		ids, err := fetch(s)
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"a"}, ids)
+	}
+
+	write(`[{"Id": "a"}, {"Id": "b"}]`, start.Add(time.Minute))
+	ids, err := fetch(watched)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a", "b"}, ids)
+	ids, err = fetch(unwatched)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a"}, ids)
+
+	// a broken edit is reported, then the fixed file is read again
+	write(`[{"Id": "a"`, start.Add(2*time.Minute))
+	_, err = fetch(watched)
+	testutil.NotOk(t, err)
+	write(`[{"Id": "c"}]`, start.Add(3*time.Minute))
+	ids, err = fetch(watched)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"c"}, ids)
+}
+
+func TestLocalFetchHotelsErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := NewLocal("Curated", dir, JSONFiles(DecodeAcmeHotels), 0).FetchHotels(context.Background(), nil, -1)
+	testutil.NotOk(t, err, "a directory without hotel files")
+	_, err = NewLocal("Curated", filepath.Join(dir, "missing.json"), JSONFiles(DecodeAcmeHotels), 0).FetchHotels(context.Background(), nil, -1)
+	testutil.NotOk(t, err, "a missing file")
+}
@@ -2,32 +2,30 @@ package supplier
 
 import (
 	"context"
+	"io"
 	"net/http"
-	"time"
 
 	"merge-hotel/entity"
-
-	"github.com/carlmjohnson/requests"
 )
 
 // Paperflies is a supplier that fetches hotel data from Paperflies API.
 type Paperflies struct {
 	client  *http.Client
 	address string
+	query   Query
+	// pages keeps the fetched pages with their validators, for conditional requests.
+	pages *pageCache
 }
 
 // NewPaperflies creates a new Paperflies supplier with the given endpoint address.
-func NewPaperflies(address string) *Paperflies {
-	t := http.DefaultTransport.(*http.Transport).Clone()
-	t.MaxIdleConns = 100
-	t.MaxConnsPerHost = 100
-	t.MaxIdleConnsPerHost = 100
-
+// The client is used for all the requests to the supplier, see NewHTTPClient.
+// The query holds the filters that the API applies server-side, if any.
+func NewPaperflies(address string, client *http.Client, query Query) *Paperflies {
 	return &Paperflies{
-		client: &http.Client{
-			Timeout: 2 * time.Second,
-		},
+		client:  client,
 		address: address,
+		query:   query,
+		pages:   newPageCache(),
 	}
 }
 
@@ -71,25 +69,30 @@ type PaperfliesImage struct {
 func convertPaperfliesResponseToHotels(responses []PaperfliesResponse) []entity.Hotel {
 	hotels := make([]entity.Hotel, len(responses))
 	for i, response := range responses {
-		hotels[i] = entity.Hotel{
-			ID:            response.HotelID,
-			DestinationID: response.DestinationID,
-			Name:          response.HotelName,
-			Location:      convertPaperfliesLocations(response),
-			Description:   response.Details,
-			Amenities:     convertPaperfliesAmenities(response.Amenities),
-			Images: entity.Images{
-				Rooms:     convertPaperfliesImages(response.Images.Rooms),
-				Site:      convertPaperfliesImages(response.Images.Site),
-				Amenities: []entity.Image{}, // assuming no specific amenity images are listed in Paperflies's response
-			},
-			BookingConditions: response.BookingConditions,
-		}
+		hotels[i] = convertPaperfliesResponse(response)
 	}
 
 	return hotels
 }
 
+// convertPaperfliesResponse converts a single PaperfliesResponse to the common Hotel struct.
+func convertPaperfliesResponse(response PaperfliesResponse) entity.Hotel {
+	return entity.Hotel{
+		ID:            response.HotelID,
+		DestinationID: response.DestinationID,
+		Name:          response.HotelName,
+		Location:      convertPaperfliesLocations(response),
+		Description:   response.Details,
+		Amenities:     convertPaperfliesAmenities(response.Amenities),
+		Images: entity.Images{
+			Rooms:     convertPaperfliesImages(response.Images.Rooms),
+			Site:      convertPaperfliesImages(response.Images.Site),
+			Amenities: []entity.Image{}, // assuming no specific amenity images are listed in Paperflies's response
+		},
+		BookingConditions: response.BookingConditions,
+	}
+}
+
 // convertPaperfliesLocation converts PaperfliesResponse location data to the common Location struct.
 func convertPaperfliesLocations(response PaperfliesResponse) entity.Location {
 	return entity.Location{
@@ -118,41 +121,33 @@ func convertPaperfliesImages(images []PaperfliesImage) []entity.Image {
 	return convertedImages
 }
 
-// FetchHotels fetches hotels from the Paperflies API.
+// DecodePaperfliesHotels decodes a response of the Paperflies API, a JSON array of hotels or NDJSON with a hotel per line,
+// into the common Hotel struct. It is used to process supplier data captured to files.
+func DecodePaperfliesHotels(r io.Reader) ([]entity.Hotel, error) {
+	return decodeHotels(r, convertPaperfliesResponse)
+}
+
+// FetchHotels fetches the hotels from the Paperflies API. The filters of its query are applied server-side,
+// and all the filters are applied while the response is decoded.
 func (p *Paperflies) FetchHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error) {
-	// fetch hotels from the API
-	var res []PaperfliesResponse
-	err := requests.
-		URL(p.address).
-		ToJSON(&res).
-		Client(p.client).
-		Fetch(ctx)
+	hotels, err := fetchHotels(ctx, p.client, p.pages, p.address, p.query, hotelIDs, destinationID, jsonPages(p.query, convertPaperfliesResponse))
 	if err != nil {
 		return []entity.Hotel{}, err
 	}
+	return hotels, nil
+}
 
-	// filter hotels based on destination ID and hotel IDs if provided
-	var filteredHotels []PaperfliesResponse
-	hotelIDSet := make(map[string]bool) // create a map for quick lookup of HotelIDs
-	if len(hotelIDs) > 0 {              // if hotelIDs is not empty, fill the map with the provided hotel IDs
-		for _, id := range hotelIDs {
-			hotelIDSet[id] = true
-		}
-	}
-
-	for _, hotel := range res {
-		// determine if the hotel should be included based on the provided parameters
-		shouldIncludeDestination := (destinationID < 0) || hotel.DestinationID == destinationID
-		shouldIncludeHotel := (len(hotelIDs) <= 0) || hotelIDSet[hotel.HotelID]
-
-		if shouldIncludeDestination && shouldIncludeHotel {
-			filteredHotels = append(filteredHotels, hotel)
-		}
-	}
-
-	return convertPaperfliesResponseToHotels(filteredHotels), nil
+// Capabilities returns the filters that the Paperflies supplier applies. The hotel ID and destination filters are
+// always applied, server-side or while decoding.
+func (p *Paperflies) Capabilities() Capabilities {
+	return Capabilities{HotelIDs: true, Destination: true, Pagination: p.query.Capabilities().Pagination}
 }
 
 func (p *Paperflies) GetName() string {
 	return "Paperflies"
 }
+
+// CloseIdleConnections closes the connections to the supplier that are kept alive but not in use.
+func (p *Paperflies) CloseIdleConnections() {
+	p.client.CloseIdleConnections()
+}
@@ -2,32 +2,30 @@ package supplier
 
 import (
 	"context"
+	"io"
 	"net/http"
-	"time"
 
 	"merge-hotel/entity"
-
-	"github.com/carlmjohnson/requests"
 )
 
 // Patagonia is a supplier that fetches hotel data from Patagonia API.
 type Patagonia struct {
 	client  *http.Client
 	address string
+	query   Query
+	// pages keeps the fetched pages with their validators, for conditional requests.
+	pages *pageCache
 }
 
 // NewPatagonia creates a new Patagonia supplier with the given endpoint address.
-func NewPatagonia(address string) *Patagonia {
-	t := http.DefaultTransport.(*http.Transport).Clone()
-	t.MaxIdleConns = 100
-	t.MaxConnsPerHost = 100
-	t.MaxIdleConnsPerHost = 100
-
+// The client is used for all the requests to the supplier, see NewHTTPClient.
+// The query holds the filters that the API applies server-side, if any.
+func NewPatagonia(address string, client *http.Client, query Query) *Patagonia {
 	return &Patagonia{
-		client: &http.Client{
-			Timeout: 2 * time.Second,
-		},
+		client:  client,
 		address: address,
+		query:   query,
+		pages:   newPageCache(),
 	}
 }
 
@@ -61,25 +59,30 @@ type PatagoniaImage struct {
 func convertPatagoniaResponseToHotels(responses []PatagoniaResponse) []entity.Hotel {
 	hotels := make([]entity.Hotel, len(responses))
 	for i, response := range responses {
-		hotels[i] = entity.Hotel{
-			ID:            response.ID,
-			DestinationID: response.Destination,
-			Name:          response.Name,
-			Location:      convertPatagoniaLocations(response),
-			Description:   derefString(response.Info), // handle possible null string
-			Amenities:     convertPatagoniaAmenities(response.Amenities),
-			Images: entity.Images{
-				Rooms:     convertPatagoniaImages(response.Images.Rooms),
-				Site:      convertPatagoniaImages(response.Images.Site),
-				Amenities: convertPatagoniaImages(response.Images.Amenities),
-			},
-			BookingConditions: []string{}, // assuming no booking conditions data is directly available from Patagonia's response
-		}
+		hotels[i] = convertPatagoniaResponse(response)
 	}
 
 	return hotels
 }
 
+// convertPatagoniaResponse converts a single PatagoniaResponse to the common Hotel struct.
+func convertPatagoniaResponse(response PatagoniaResponse) entity.Hotel {
+	return entity.Hotel{
+		ID:            response.ID,
+		DestinationID: response.Destination,
+		Name:          response.Name,
+		Location:      convertPatagoniaLocations(response),
+		Description:   derefString(response.Info), // handle possible null string
+		Amenities:     convertPatagoniaAmenities(response.Amenities),
+		Images: entity.Images{
+			Rooms:     convertPatagoniaImages(response.Images.Rooms),
+			Site:      convertPatagoniaImages(response.Images.Site),
+			Amenities: convertPatagoniaImages(response.Images.Amenities),
+		},
+		BookingConditions: []string{}, // assuming no booking conditions data is directly available from Patagonia's response
+	}
+}
+
 // convertPatagoniaLocation converts PatagoniaResponse location data to the common Location struct.
 func convertPatagoniaLocations(response PatagoniaResponse) entity.Location {
 	return entity.Location{
@@ -111,41 +114,34 @@ func convertPatagoniaImages(images []PatagoniaImage) []entity.Image {
 	return convertedImages
 }
 
+// DecodePatagoniaHotels decodes a response of the Patagonia API, a JSON array of hotels or NDJSON with a hotel per line,
+// into the common Hotel struct. It is used to process supplier data captured to files.
+func DecodePatagoniaHotels(r io.Reader) ([]entity.Hotel, error) {
+	return decodeHotels(r, convertPatagoniaResponse)
+}
+
+// FetchHotels fetches the hotels from the Patagonia API. The filters of its query are applied server-side,
+// and all the filters are applied while the response is decoded.
 func (p *Patagonia) FetchHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error) {
-	// fetch hotels from the API
-	var res []PatagoniaResponse
-	err := requests.
-		URL(p.address).
-		ToJSON(&res).
-		Client(p.client).
-		Fetch(ctx)
+	hotels, err := fetchHotels(ctx, p.client, p.pages, p.address, p.query, hotelIDs, destinationID, jsonPages(p.query, convertPatagoniaResponse))
 	if err != nil {
 		return []entity.Hotel{}, err
 	}
+	return hotels, nil
+}
 
-	// filter hotels based on destination ID and hotel IDs if provided
-	var filteredHotels []PatagoniaResponse
-	hotelIDSet := make(map[string]bool) // create a map for quick lookup of HotelIDs
-	if len(hotelIDs) > 0 {              // if hotelIDs is not empty, fill the map with the provided hotel IDs
-		for _, id := range hotelIDs {
-			hotelIDSet[id] = true
-		}
-	}
-
-	for _, hotel := range res {
-		// determine if the hotel should be included based on the provided parameters
-		shouldIncludeDestination := (destinationID < 0) || hotel.Destination == destinationID
-		shouldIncludeHotel := (len(hotelIDs) <= 0) || hotelIDSet[hotel.ID]
-
-		if shouldIncludeDestination && shouldIncludeHotel {
-			filteredHotels = append(filteredHotels, hotel)
-		}
-	}
-
-	return convertPatagoniaResponseToHotels(filteredHotels), nil
+// Capabilities returns the filters that the Patagonia supplier applies. The hotel ID and destination filters are
+// always applied, server-side or while decoding.
+func (p *Patagonia) Capabilities() Capabilities {
+	return Capabilities{HotelIDs: true, Destination: true, Pagination: p.query.Capabilities().Pagination}
 }
 
 // GetName returns the name of the supplier.
 func (p *Patagonia) GetName() string {
 	return "Patagonia"
 }
+
+// CloseIdleConnections closes the connections to the supplier that are kept alive but not in use.
+func (p *Patagonia) CloseIdleConnections() {
+	p.client.CloseIdleConnections()
+}
@@ -0,0 +1,99 @@
+package supplier
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"merge-hotel/auth"
+	"merge-hotel/entity"
+)
+
+// Pushed is a supplier whose partner pushes its hotel updates to the service instead of being polled.
+// The pushed hotels are kept in memory, and replaced when the partner pushes them again. There is no way for the
+// partner to delete a hotel: it is kept until the supplier is removed or the service restarts.
+type Pushed struct {
+	name string
+
+	mu     sync.RWMutex // guards the fields below
+	key    auth.Secret
+	decode func(r io.Reader) ([]entity.Hotel, error)
+	hotels map[string]entity.Hotel
+}
+
+// NewPushed creates a supplier that receives the hotels of its partner, in the format of the files of a local
+// supplier. The pushes must be signed with key, like the requests of the HMAC auth scheme.
+func NewPushed(name string, key auth.Secret, format FileFormat) *Pushed {
+	return &Pushed{name: name, key: key, decode: format.Decode, hotels: make(map[string]entity.Hotel)}
+}
+
+// Update replaces the key and the format of the pushes, e.g. when the key is rotated. The pushed hotels are kept,
+// so that they are still served until the partner pushes them again.
+func (p *Pushed) Update(key auth.Secret, format FileFormat) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key, p.decode = key, format.Decode
+}
+
+// Verify checks the signature of a push, see auth.VerifySignature.
+func (p *Pushed) Verify(method, requestURI, timestamp, signature string, body []byte) error {
+	p.mu.RLock()
+	key := p.key
+	p.mu.RUnlock()
+	return auth.VerifySignature(key, method, requestURI, timestamp, body, signature, time.Now())
+}
+
+// Push decodes the records of a push, a single record or a batch, and stores their hotels. A hotel replaces
+// the hotel pushed before with the same ID. Nothing is stored if a record cannot be decoded.
+func (p *Pushed) Push(r io.Reader) ([]entity.Hotel, error) {
+	p.mu.RLock()
+	decode := p.decode
+	p.mu.RUnlock()
+	hotels, err := decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	pushedAt := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range hotels {
+		hotels[i].Provenance.ModifiedAt = pushedAt
+		p.hotels[hotels[i].ID] = hotels[i].Clone()
+	}
+	return hotels, nil
+}
+
+// FetchHotels returns the pushed hotels that match the hotel IDs and destination, sorted by ID.
+func (p *Pushed) FetchHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error) {
+	if err := ctx.Err(); err != nil {
+		return []entity.Hotel{}, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	filter := newHotelFilter(hotelIDs, destinationID)
+	matched := []entity.Hotel{}
+	for _, hotel := range p.hotels {
+		if filter.match(hotel) {
+			// the hotels are cleaned and merged in place, so the pushed ones are kept intact
+			matched = append(matched, hotel.Clone())
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].ID < matched[j].ID
+	})
+	return matched, nil
+}
+
+// Capabilities returns the filters that the pushed supplier applies, all of them as the hotels are in memory.
+func (p *Pushed) Capabilities() Capabilities {
+	return Capabilities{HotelIDs: true, Destination: true}
+}
+
+// GetName returns the name of the supplier.
+func (p *Pushed) GetName() string {
+	return p.name
+}
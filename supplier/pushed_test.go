@@ -0,0 +1,51 @@
+package supplier
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"merge-hotel/auth"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestPushedFetchHotels(t *testing.T) {
+	s := NewPushed("Paperflies", "key", JSONFiles(DecodePaperfliesHotels))
+	hotels, err := s.FetchHotels(context.Background(), nil, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(hotels))
+
+	// a single record, then a batch replacing it
+	_, err = s.Push(strings.NewReader(`{"hotel_id": "a", "destination_id": 1, "hotel_name": "Old"}`))
+	testutil.Ok(t, err)
+	pushed, err := s.Push(strings.NewReader(`[{"hotel_id": "a", "destination_id": 1, "hotel_name": "New"}, {"hotel_id": "b", "destination_id": 2}]`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a", "b"}, hotelIDs(pushed))
+
+	hotels, err = s.FetchHotels(context.Background(), nil, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a", "b"}, hotelIDs(hotels))
+	testutil.Equals(t, "New", hotels[0].Name)
+	hotels, err = s.FetchHotels(context.Background(), []string{"a", "b"}, 2)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"b"}, hotelIDs(hotels))
+
+	// a batch with an invalid record is rejected as a whole
+	_, err = s.Push(strings.NewReader(`[{"hotel_id": "c"}, {"hotel_id": 4}]`))
+	testutil.NotOk(t, err)
+	hotels, err = s.FetchHotels(context.Background(), nil, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a", "b"}, hotelIDs(hotels))
+}
+
+func TestPushedVerify(t *testing.T) {
+	s := NewPushed("Paperflies", "key", JSONFiles(DecodePaperfliesHotels))
+	body := []byte(`{"hotel_id": "a"}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	testutil.Ok(t, s.Verify(http.MethodPost, "/ingest/Paperflies", timestamp, auth.Signature("key", http.MethodPost, "/ingest/Paperflies", timestamp, body), body))
+	testutil.NotOk(t, s.Verify(http.MethodPost, "/ingest/Paperflies", timestamp, auth.Signature("other", http.MethodPost, "/ingest/Paperflies", timestamp, body), body))
+}
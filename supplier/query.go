@@ -0,0 +1,397 @@
+package supplier
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"merge-hotel/entity"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/sourcegraph/conc/pool"
+)
+
+// maxPages bounds the number of pages fetched from a paginated API, in case it never returns a last page.
+const maxPages = 1000
+
+// Query holds the query-parameter templates of the filters that a supplier API applies server-side,
+// and how its responses are paginated.
+// An empty template means that the API cannot apply the filter, and the hotels are filtered client-side.
+type Query struct {
+	// HotelIDs filters by hotel IDs, e.g. "ids={ids}". {ids} is replaced by the comma-separated hotel IDs.
+	HotelIDs string
+	// Destination filters by destination, e.g. "destination={destination}".
+	Destination string
+
+	// Page selects a page of hotels, e.g. "page={page}&limit={limit}" or "offset={offset}&limit={limit}".
+	// {page} starts at 1, {offset} at 0 and {limit} is PageSize. Pages are fetched until a page is not full.
+	Page     string
+	PageSize int
+	// Concurrency is the number of pages fetched concurrently with Page. It defaults to 1.
+	Concurrency int
+
+	// Cursor selects the page after a cursor, e.g. "cursor={cursor}&limit={limit}". The first page is requested
+	// without the params of the cursor, e.g. with the limit only, and the cursor of the next page is read from
+	// the NextCursor field of each response. Pages are fetched until a response has no cursor or no records.
+	Cursor     string
+	NextCursor string
+
+	// FollowLinks fetches the next pages from the Link header of the responses, e.g. Link: <...>; rel="next".
+	FollowLinks bool
+
+	// Records is the field of the response object that holds the records, for APIs that wrap them in an object.
+	// By default the response is a JSON array of records.
+	Records string
+}
+
+// Capabilities are the filters that a supplier applies itself, so that its hotels need not be filtered again.
+type Capabilities struct {
+	HotelIDs    bool
+	Destination bool
+	Pagination  bool
+}
+
+// Capabilities returns the filters that the query applies server-side.
+func (q Query) Capabilities() Capabilities {
+	return Capabilities{
+		HotelIDs:    q.HotelIDs != "",
+		Destination: q.Destination != "",
+		Pagination:  q.numbered() || q.Cursor != "" || q.FollowLinks,
+	}
+}
+
+// numbered reports whether the pages are selected by page number or offset.
+func (q Query) numbered() bool {
+	return q.Page != "" && q.PageSize > 0
+}
+
+// render replaces the placeholders of the template with their query-escaped values.
+func render(template string, values map[string]string) string {
+	pairs := make([]string, 0, 2*len(values))
+	for placeholder, value := range values {
+		pairs = append(pairs, "{"+placeholder+"}", url.QueryEscape(value))
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// withParams returns the URL with the params added to its query.
+func withParams(base *url.URL, params ...string) string {
+	u := *base
+	var query []string
+	if u.RawQuery != "" {
+		query = append(query, u.RawQuery)
+	}
+	for _, param := range params {
+		if param != "" {
+			query = append(query, param)
+		}
+	}
+	u.RawQuery = strings.Join(query, "&")
+	return u.String()
+}
+
+// fetchHotels fetches the hotels of a supplier API, applying the filters of the query server-side
+// and following the pages if the API is paginated. The records are stream-decoded by decode, which converts
+// and filters them one at a time, whether or not the API applied the filters.
+func fetchHotels(ctx context.Context, client *http.Client, pages *pageCache, address string, query Query, hotelIDs []string, destinationID int, decode pageDecoder) ([]entity.Hotel, error) {
+	base, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	capabilities := query.Capabilities()
+	var filters []string
+	if capabilities.HotelIDs && len(hotelIDs) > 0 {
+		escaped := make([]string, len(hotelIDs))
+		for i, id := range hotelIDs {
+			escaped[i] = url.QueryEscape(id)
+		}
+		// the IDs are escaped one by one so that the commas between them are kept
+		filters = append(filters, strings.ReplaceAll(query.HotelIDs, "{ids}", strings.Join(escaped, ",")))
+	}
+	if capabilities.Destination && destinationID >= 0 {
+		filters = append(filters, render(query.Destination, map[string]string{"destination": strconv.Itoa(destinationID)}))
+	}
+	filtered, err := url.Parse(withParams(base, filters...))
+	if err != nil {
+		return nil, err
+	}
+
+	fetch := func(ctx context.Context, pageURL string) (page, error) {
+		return fetchPage(ctx, client, pages, pageURL, decode, newHotelFilter(hotelIDs, destinationID))
+	}
+	switch {
+	case query.numbered():
+		return fetchNumberedPages(ctx, filtered, query, fetch)
+	case query.Cursor != "":
+		return fetchCursorPages(ctx, filtered, query, fetch)
+	case query.FollowLinks:
+		return fetchLinkedPages(ctx, filtered, fetch)
+	default:
+		single, err := fetch(ctx, filtered.String())
+		return single.hotels, err
+	}
+}
+
+// page is a fetched page of hotels, with what is needed to find the next page.
+type page struct {
+	decodedPage
+	header http.Header
+}
+
+// fetchPage fetches a single page and stream-decodes its records.
+// If the page was fetched before with validators, the request is conditional and the body kept with the page
+// is decoded again when the supplier answers 304 Not Modified.
+func fetchPage(ctx context.Context, client *http.Client, pages *pageCache, pageURL string, decode pageDecoder, filter hotelFilter) (page, error) {
+	cached, revalidate := pages.Get(pageURL)
+	rb := requests.
+		URL(pageURL).
+		Client(client).
+		Header("Accept-Encoding", acceptEncoding)
+	if revalidate && cached.etag != "" {
+		rb.Header("If-None-Match", cached.etag)
+	}
+	if revalidate && cached.lastModified != "" {
+		rb.Header("If-Modified-Since", cached.lastModified)
+	}
+
+	var p page
+	err := rb.
+		AddValidator(func(res *http.Response) error {
+			if revalidate && res.StatusCode == http.StatusNotModified {
+				return nil
+			}
+			return requests.DefaultValidator(res)
+		}).
+		Handle(func(res *http.Response) error {
+			if res.StatusCode == http.StatusNotModified {
+				// the page is kept for another TTL, as the supplier confirmed it is still current
+				pages.Set(pageURL, cached, validatedPageTTL)
+				decoded, err := decodeBody(cached.header, bytes.NewReader(cached.body), decode, filter)
+				p = page{decodedPage: decoded, header: cached.header}
+				setModifiedAt(p.hotels, cached.header, cached.fetchedAt)
+				return err
+			}
+			fetchedAt := time.Now()
+			p.header = res.Header
+
+			etag, lastModified := res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+			if etag == "" && lastModified == "" {
+				decoded, err := decodeBody(res.Header, res.Body, decode, filter)
+				p.decodedPage = decoded
+				setModifiedAt(p.hotels, res.Header, fetchedAt)
+				return err
+			}
+			// the body is kept as it is received while it is decoded, unless it is too large to be kept
+			kept := &cappedBuffer{max: maxValidatedBytes}
+			body := io.TeeReader(res.Body, kept)
+			decoded, err := decodeBody(res.Header, body, decode, filter)
+			if err != nil {
+				return err
+			}
+			p.decodedPage = decoded
+			setModifiedAt(p.hotels, res.Header, fetchedAt)
+			if !kept.overflowed {
+				// the decoder may stop before the end of the body, e.g. before the trailer of a gzip stream
+				_, err = io.Copy(io.Discard, body)
+			}
+			if err != nil || kept.overflowed {
+				pages.Delete(pageURL)
+				return nil
+			}
+			pages.Set(pageURL, validatedPage{
+				etag: etag, lastModified: lastModified, body: kept.Bytes(), header: res.Header, fetchedAt: fetchedAt,
+			}, validatedPageTTL)
+			return nil
+		}).
+		Fetch(ctx)
+	return p, err
+}
+
+// pageFetcher fetches and decodes the page at a URL.
+type pageFetcher func(ctx context.Context, pageURL string) (page, error)
+
+// fetchNumberedPages fetches the pages selected by page number or offset, up to Concurrency pages at a time.
+// The pages of a batch are appended in order, and the fetch stops at the first page that is not full;
+// an API that ignores the pagination returns more than a page, which stops the fetch too.
+func fetchNumberedPages(ctx context.Context, base *url.URL, query Query, fetch pageFetcher) ([]entity.Hotel, error) {
+	concurrency := max(query.Concurrency, 1)
+	var hotels []entity.Hotel
+	for first := 1; first <= maxPages; first += concurrency {
+		p := pool.New().WithContext(ctx).WithCancelOnError().WithFirstError().WithMaxGoroutines(concurrency)
+		pages := make([]page, concurrency)
+		for i := range pages {
+			number := first + i
+			p.Go(func(ctx context.Context) error {
+				pageURL := withParams(base, render(query.Page, map[string]string{
+					"page":   strconv.Itoa(number),
+					"offset": strconv.Itoa((number - 1) * query.PageSize),
+					"limit":  strconv.Itoa(query.PageSize),
+				}))
+				var err error
+				pages[i], err = fetch(ctx, pageURL)
+				return err
+			})
+		}
+		if err := p.Wait(); err != nil {
+			return nil, err
+		}
+
+		for _, fetched := range pages {
+			hotels = append(hotels, fetched.hotels...)
+			if fetched.records != query.PageSize {
+				return hotels, nil
+			}
+		}
+	}
+	return hotels, nil
+}
+
+// fetchCursorPages fetches the pages one after the other, with the cursor returned by the previous page.
+func fetchCursorPages(ctx context.Context, base *url.URL, query Query, fetch pageFetcher) ([]entity.Hotel, error) {
+	var hotels []entity.Hotel
+	cursor := ""
+	// the first page is requested without the params of the cursor, but with the others, e.g. the limit
+	var first []string
+	for _, param := range strings.Split(query.Cursor, "&") {
+		if !strings.Contains(param, "{cursor}") {
+			first = append(first, param)
+		}
+	}
+	for n := 0; n < maxPages; n++ {
+		template := query.Cursor
+		if n == 0 {
+			template = strings.Join(first, "&")
+		}
+		pageURL := withParams(base, render(template, map[string]string{
+			"cursor": cursor,
+			"limit":  strconv.Itoa(query.PageSize),
+		}))
+		fetched, err := fetch(ctx, pageURL)
+		if err != nil {
+			return nil, err
+		}
+		hotels = append(hotels, fetched.hotels...)
+		if fetched.nextCursor == "" || fetched.records == 0 {
+			break
+		}
+		cursor = fetched.nextCursor
+	}
+	return hotels, nil
+}
+
+// fetchLinkedPages fetches the pages one after the other, following the next links of the Link headers.
+func fetchLinkedPages(ctx context.Context, base *url.URL, fetch pageFetcher) ([]entity.Hotel, error) {
+	var hotels []entity.Hotel
+	pageURL := base
+	for n := 0; n < maxPages && pageURL != nil; n++ {
+		fetched, err := fetch(ctx, pageURL.String())
+		if err != nil {
+			return nil, err
+		}
+		hotels = append(hotels, fetched.hotels...)
+		if fetched.records == 0 {
+			break
+		}
+		pageURL = nextLink(fetched.header, pageURL)
+	}
+	return hotels, nil
+}
+
+// nextLink returns the URL of the next page in the Link header, e.g. Link: </hotels?page=2>; rel="next",
+// resolved against the URL of the current page. It returns nil if there is no next page.
+func nextLink(header http.Header, current *url.URL) *url.URL {
+	for _, value := range header.Values("Link") {
+		for _, link := range parseLinks(value) {
+			isNext := func(rel string) bool { return strings.EqualFold(rel, "next") }
+			if !slices.ContainsFunc(strings.Fields(link.params["rel"]), isNext) {
+				continue
+			}
+			next, err := current.Parse(link.target)
+			if err != nil {
+				return nil
+			}
+			return next
+		}
+	}
+	return nil
+}
+
+// link is a link of a Link header, with its parameters keyed by lowercase name.
+type link struct {
+	target string
+	params map[string]string
+}
+
+// parseLinks parses the links of a Link header value, see RFC 8288. The targets are delimited by < and >, so that
+// they may contain commas and semicolons, and the parameter values may be quoted strings. Parsing stops at the first
+// malformed link.
+func parseLinks(value string) []link {
+	var links []link
+	rest := value
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		if !strings.HasPrefix(rest, "<") {
+			return links
+		}
+		target, after, ok := strings.Cut(rest[1:], ">")
+		if !ok {
+			return links
+		}
+		l := link{target: target, params: map[string]string{}}
+		rest = strings.TrimLeft(after, " \t")
+		for strings.HasPrefix(rest, ";") {
+			rest = strings.TrimLeft(rest[1:], " \t")
+			end := strings.IndexAny(rest, "=;,")
+			if end < 0 {
+				end = len(rest)
+			}
+			name, paramValue := strings.TrimSpace(rest[:end]), ""
+			rest = rest[end:]
+			if strings.HasPrefix(rest, "=") {
+				paramValue, rest = parseParamValue(strings.TrimLeft(rest[1:], " \t"))
+			}
+			if name != "" {
+				l.params[strings.ToLower(name)] = paramValue
+			}
+			rest = strings.TrimLeft(rest, " \t")
+		}
+		links = append(links, l)
+		if rest != "" && !strings.HasPrefix(rest, ",") {
+			return links
+		}
+	}
+}
+
+// parseParamValue parses the value of a link parameter at the start of s, a token or a quoted string,
+// and returns it with the rest of s.
+func parseParamValue(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexAny(s, ";,")
+		if end < 0 {
+			end = len(s)
+		}
+		return strings.TrimSpace(s[:end]), s[end:]
+	}
+	var value strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return value.String(), s[i+1:]
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+	// an unterminated quoted string runs to the end of the value
+	return value.String(), ""
+}
@@ -0,0 +1,182 @@
+package supplier
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+
+	"merge-hotel/entity"
+	"merge-hotel/mock"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestQueryCapabilities(t *testing.T) {
+	testutil.Equals(t, Capabilities{}, Query{}.Capabilities())
+	testutil.Equals(t, Capabilities{HotelIDs: true, Destination: true, Pagination: true}, Query{
+		HotelIDs: "ids={ids}", Destination: "destination={destination}", Page: "page={page}&limit={limit}", PageSize: 2,
+	}.Capabilities())
+	// a page template without a page size does not paginate
+	testutil.Equals(t, Capabilities{}, Query{Page: "page={page}"}.Capabilities())
+}
+
+func TestFetchHotelsPushesFiltersDown(t *testing.T) {
+	var mu sync.Mutex
+	var queries []string
+	handler := mock.NewServer(mock.Generate(5, 1), mock.Options{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.RawQuery)
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name            string
+		query           Query
+		address         string
+		hotelIDs        []string
+		destinationID   int
+		expectedQueries []string
+		expectedIDs     []string
+	}{
+		{
+			name:            "filtered while decoding",
+			hotelIDs:        []string{"h001", "h003"},
+			destinationID:   -1,
+			expectedQueries: []string{""},
+			expectedIDs:     []string{"h001", "h003"},
+		},
+		{
+			name:            "hotel IDs",
+			query:           Query{HotelIDs: "ids={ids}"},
+			hotelIDs:        []string{"h001", "h003"},
+			destinationID:   -1,
+			expectedQueries: []string{"ids=h001,h003"},
+			expectedIDs:     []string{"h001", "h003"},
+		},
+		{
+			name:            "pagination",
+			query:           Query{Page: "page={page}&limit={limit}", PageSize: 2},
+			destinationID:   -1,
+			expectedQueries: []string{"page=1&limit=2", "page=2&limit=2", "page=3&limit=2"},
+			expectedIDs:     []string{"h000", "h001", "h002", "h003", "h004"},
+		},
+		{
+			name:            "offset pagination with filters",
+			query:           Query{HotelIDs: "ids={ids}", Page: "offset={offset}&limit={limit}", PageSize: 1},
+			hotelIDs:        []string{"h000", "h004"},
+			destinationID:   -1,
+			expectedQueries: []string{"ids=h000,h004&offset=0&limit=1", "ids=h000,h004&offset=1&limit=1", "ids=h000,h004&offset=2&limit=1"},
+			expectedIDs:     []string{"h000", "h004"},
+		},
+		{
+			name:            "concurrent pages",
+			query:           Query{Page: "page={page}&limit={limit}", PageSize: 2, Concurrency: 4},
+			destinationID:   -1,
+			expectedQueries: []string{"page=1&limit=2", "page=2&limit=2", "page=3&limit=2", "page=4&limit=2"},
+			expectedIDs:     []string{"h000", "h001", "h002", "h003", "h004"},
+		},
+		{
+			name:            "link header",
+			query:           Query{FollowLinks: true},
+			address:         "/suppliers/acme?limit=2&page=1",
+			destinationID:   -1,
+			expectedQueries: []string{"limit=2&page=1", "limit=2&page=2", "limit=2&page=3"},
+			expectedIDs:     []string{"h000", "h001", "h002", "h003", "h004"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			queries = nil
+			address := "/suppliers/acme"
+			if tc.address != "" {
+				address = tc.address
+			}
+			s := NewAcme(srv.URL+address, srv.Client(), tc.query)
+			hotels, err := s.FetchHotels(context.Background(), tc.hotelIDs, tc.destinationID)
+			testutil.Ok(t, err)
+			// concurrent pages are requested in any order
+			sort.Strings(queries)
+			testutil.Equals(t, tc.expectedQueries, queries)
+			testutil.Equals(t, tc.expectedIDs, hotelIDs(hotels))
+		})
+	}
+}
+
+func TestFetchHotelsRejectsErrorResponses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, `[]`)
+	}))
+	defer srv.Close()
+
+	for _, query := range []Query{{}, {FollowLinks: true}} {
+		_, err := NewAcme(srv.URL, srv.Client(), query).FetchHotels(context.Background(), nil, -1)
+		testutil.NotOk(t, err)
+	}
+}
+
+func TestFetchHotelsFollowsCursors(t *testing.T) {
+	pages := map[string]string{
+		"":   `{"data": [{"Id": "a"}, {"Id": "b"}], "next": "c2"}`,
+		"c2": `{"data": [{"Id": "c"}], "next": 3}`,
+		"3":  `{"data": [{"Id": "d"}], "next": null}`,
+	}
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		_, _ = io.WriteString(w, pages[r.URL.Query().Get("cursor")])
+	}))
+	defer srv.Close()
+
+	s := NewAcme(srv.URL, srv.Client(), Query{Cursor: "cursor={cursor}&limit={limit}", PageSize: 2, NextCursor: "next", Records: "data"})
+	hotels, err := s.FetchHotels(context.Background(), nil, -1)
+	testutil.Ok(t, err)
+	// the limit is sent from the first page, which has no cursor yet
+	testutil.Equals(t, []string{"limit=2", "cursor=c2&limit=2", "cursor=3&limit=2"}, queries)
+	testutil.Equals(t, []string{"a", "b", "c", "d"}, hotelIDs(hotels))
+}
+
+func TestNextLink(t *testing.T) {
+	current, _ := url.Parse("https://example.com/hotels?page=1")
+	for _, tc := range []struct {
+		link     string
+		expected string
+	}{
+		{link: `<https://example.com/hotels?page=2>; rel="next"`, expected: "https://example.com/hotels?page=2"},
+		{link: `</hotels?page=1>; rel="prev", </hotels?page=3>; rel="next last"`, expected: "https://example.com/hotels?page=3"},
+		{link: `<?page=2>; rel=next`, expected: "https://example.com/hotels?page=2"},
+		{link: `</hotels?cursor=a,b;c>; rel="next"`, expected: "https://example.com/hotels?cursor=a,b;c"},
+		{link: `</hotels?ids=1,2>; rel="prev", </hotels?ids=3,4>; title="a, b; rel=next"; rel=next`, expected: "https://example.com/hotels?ids=3,4"},
+		{link: `</hotels?page=1>; title="next"; REL="first", </hotels?page=2>; Rel="Next"`, expected: "https://example.com/hotels?page=2"},
+		{link: `</hotels?page=1>; rel="first"`},
+		{link: `</hotels?page=2; rel="next"`},
+		{},
+	} {
+		header := http.Header{}
+		if tc.link != "" {
+			header.Set("Link", tc.link)
+		}
+		next := nextLink(header, current)
+		if tc.expected == "" {
+			testutil.Assert(t, next == nil, "expected no next link for %q, got %v", tc.link, next)
+			continue
+		}
+		testutil.Equals(t, tc.expected, next.String())
+	}
+}
+
+func hotelIDs(hotels []entity.Hotel) []string {
+	var ids []string
+	for _, hotel := range hotels {
+		ids = append(ids, hotel.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,183 @@
+package supplier
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode"
+
+	"merge-hotel/entity"
+)
+
+// hotelFilter matches the hotels by ID and destination while the records are decoded,
+// so that the records that are filtered out are never kept in memory.
+type hotelFilter struct {
+	hotelIDs      map[string]bool
+	destinationID int
+}
+
+// newHotelFilter creates a filter for the hotel IDs and destination. No hotel IDs and a negative destination
+// match all the hotels.
+func newHotelFilter(hotelIDs []string, destinationID int) hotelFilter {
+	f := hotelFilter{destinationID: destinationID}
+	if len(hotelIDs) > 0 {
+		f.hotelIDs = make(map[string]bool, len(hotelIDs))
+		for _, id := range hotelIDs {
+			f.hotelIDs[id] = true
+		}
+	}
+	return f
+}
+
+// match reports whether the hotel passes the filter.
+func (f hotelFilter) match(hotel entity.Hotel) bool {
+	return (f.hotelIDs == nil || f.hotelIDs[hotel.ID]) && (f.destinationID < 0 || hotel.DestinationID == f.destinationID)
+}
+
+// decodedPage is the result of decoding a page of records.
+type decodedPage struct {
+	// hotels are the converted records that passed the filter.
+	hotels []entity.Hotel
+	// records is the number of records in the page, before filtering.
+	records    int
+	nextCursor string
+}
+
+// pageDecoder stream-decodes a page of a supplier response, keeping the hotels that pass the filter.
+type pageDecoder func(r io.Reader, filter hotelFilter) (decodedPage, error)
+
+// jsonPages returns the decoder of the JSON pages of a supplier, whose records are converted by convert.
+func jsonPages[T any](query Query, convert func(T) entity.Hotel) pageDecoder {
+	return func(r io.Reader, filter hotelFilter) (decodedPage, error) {
+		return decodePage(r, query, convert, filter)
+	}
+}
+
+// decodePage stream-decodes a response of a supplier API, converting and filtering the records one at a time.
+// The response is either a JSON array of records, or an object with the records in its query.Records field.
+// Only the hotels that pass the filter are kept, so the memory used does not depend on the size of the response.
+func decodePage[T any](r io.Reader, query Query, convert func(T) entity.Hotel, filter hotelFilter) (decodedPage, error) {
+	dec := json.NewDecoder(r)
+	var decoded decodedPage
+	decodeRecords := func() error {
+		return streamArray(dec, func(record T) {
+			decoded.records++
+			if hotel := convert(record); filter.match(hotel) {
+				decoded.hotels = append(decoded.hotels, hotel)
+			}
+		})
+	}
+
+	if query.Records == "" {
+		return decoded, decodeRecords()
+	}
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return decoded, err
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return decoded, err
+		}
+		switch key, _ := token.(string); key {
+		case query.Records:
+			if err := decodeRecords(); err != nil {
+				return decoded, fmt.Errorf("%s: %w", key, err)
+			}
+		case query.NextCursor:
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return decoded, err
+			}
+			decoded.nextCursor = cursorValue(raw)
+		default:
+			// skip the other fields, such as the total count
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return decoded, err
+			}
+		}
+	}
+	return decoded, expectDelim(dec, '}')
+}
+
+// decodeHotels decodes supplier data captured to files: a JSON array of records, as returned by the supplier API,
+// or newline-delimited JSON with one record per line.
+func decodeHotels[T any](r io.Reader, convert func(T) entity.Hotel) ([]entity.Hotel, error) {
+	buffered := bufio.NewReader(r)
+	for {
+		b, err := buffered.Peek(1)
+		if err != nil || !unicode.IsSpace(rune(b[0])) {
+			break
+		}
+		_, _ = buffered.Discard(1)
+	}
+	if b, err := buffered.Peek(1); err != nil || b[0] != '{' {
+		// the errors, including empty data, are reported by the decoder of the supplier responses
+		decoded, err := decodePage(buffered, Query{}, convert, newHotelFilter(nil, -1))
+		return decoded.hotels, err
+	}
+
+	var hotels []entity.Hotel
+	dec := json.NewDecoder(buffered)
+	for line := 1; ; line++ {
+		var record T
+		if err := dec.Decode(&record); errors.Is(err, io.EOF) {
+			return hotels, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("record %d: %w", line, err)
+		}
+		hotels = append(hotels, convert(record))
+	}
+}
+
+// cursorValue returns the cursor held by a JSON value, which may be a string or a number. Null means no cursor.
+func cursorValue(raw json.RawMessage) string {
+	var cursor string
+	if err := json.Unmarshal(raw, &cursor); err == nil {
+		return cursor
+	}
+	var number json.Number
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return number.String()
+	}
+	return ""
+}
+
+// streamArray decodes a JSON array from the decoder one element at a time, calling fn for each element.
+// A null array is decoded as an empty one.
+func streamArray[T any](dec *json.Decoder, fn func(T)) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected a JSON array, got %v", token)
+	}
+	for dec.More() {
+		var element T
+		if err := dec.Decode(&element); err != nil {
+			return err
+		}
+		fn(element)
+	}
+	return expectDelim(dec, ']')
+}
+
+// expectDelim reads the next token of the decoder and checks that it is the given delimiter.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
+	}
+	return nil
+}
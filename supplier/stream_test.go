@@ -0,0 +1,112 @@
+package supplier
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"merge-hotel/entity"
+	"merge-hotel/mock"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestDecodePage(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		body            string
+		query           Query
+		filter          hotelFilter
+		expectedIDs     []string
+		expectedRecords int
+		expectedCursor  string
+	}{
+		{
+			name:            "array",
+			body:            `[{"Id": "a", "DestinationId": 1}, {"Id": "b", "DestinationId": 2}, {"Id": "c", "DestinationId": 1}]`,
+			filter:          newHotelFilter(nil, 1),
+			expectedIDs:     []string{"a", "c"},
+			expectedRecords: 3,
+		},
+		{
+			name:            "null array",
+			body:            `null`,
+			filter:          newHotelFilter(nil, -1),
+			expectedRecords: 0,
+		},
+		{
+			name:            "object",
+			body:            `{"total": 2, "data": [{"Id": "a"}, {"Id": "b"}], "meta": {"next": "x"}, "next": "c2"}`,
+			query:           Query{Records: "data", NextCursor: "next"},
+			filter:          newHotelFilter([]string{"b"}, -1),
+			expectedIDs:     []string{"b"},
+			expectedRecords: 2,
+			expectedCursor:  "c2",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			decoded, err := decodePage(strings.NewReader(tc.body), tc.query, convertAcmeResponse, tc.filter)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expectedIDs, hotelIDs(decoded.hotels))
+			testutil.Equals(t, tc.expectedRecords, decoded.records)
+			testutil.Equals(t, tc.expectedCursor, decoded.nextCursor)
+		})
+	}
+}
+
+func TestDecodePageErrors(t *testing.T) {
+	for _, body := range []string{`{"Id": "a"}`, `[{"Id": "a"}`, `[{"Id": 1}]`, ``} {
+		_, err := decodePage(strings.NewReader(body), Query{}, convertAcmeResponse, newHotelFilter(nil, -1))
+		testutil.NotOk(t, err, "body %q", body)
+	}
+}
+
+// feedSize is the number of hotels of the benchmark feed, the size of a large supplier catalogue.
+const feedSize = 100_000
+
+// acmeFeed is a generated Acme response of feedSize hotels.
+var acmeFeed = sync.OnceValue(func() []byte {
+	data, err := json.Marshal(mock.Generate(feedSize, 1)["acme"])
+	if err != nil {
+		panic(err)
+	}
+	return data
+})
+
+// BenchmarkDecodeFull decodes the whole feed into memory before converting and filtering it,
+// as the suppliers did before streaming.
+func BenchmarkDecodeFull(b *testing.B) {
+	feed := acmeFeed()
+	filter := newHotelFilter(nil, 5432)
+	b.SetBytes(int64(len(feed)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var res []AcmeResponse
+		if err := json.NewDecoder(bytes.NewReader(feed)).Decode(&res); err != nil {
+			b.Fatal(err)
+		}
+		var hotels []entity.Hotel
+		for _, hotel := range convertAcmeResponseToHotels(res) {
+			if filter.match(hotel) {
+				hotels = append(hotels, hotel)
+			}
+		}
+	}
+}
+
+// BenchmarkDecodeStreaming decodes, converts and filters the feed one record at a time.
+func BenchmarkDecodeStreaming(b *testing.B) {
+	feed := acmeFeed()
+	filter := newHotelFilter(nil, 5432)
+	b.SetBytes(int64(len(feed)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := decodePage(bytes.NewReader(feed), Query{}, convertAcmeResponse, filter); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Package suppress hides hotels that must not be shown, such as closed, fraudulent or contractually excluded hotels,
+// and drops images and amenities from the merged hotel data. Every suppression is recorded with the reason of its rule.
+package suppress
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"merge-hotel/entity"
+)
+
+// Rule selects hotels by the conditions that are set, all of which must match, and suppresses them.
+// If Images or Amenities is set, only the matching images or amenities of the selected hotels are dropped.
+type Rule struct {
+	// Reason is recorded with every suppression of the rule, e.g. closed or contract.
+	Reason       string
+	HotelIDs     []string
+	Destinations []int
+	// Suppliers select the hotels that one of the suppliers contributed to.
+	Suppliers []string
+	// Name is a regular expression matched against the hotel name.
+	Name string
+	// Images is a regular expression matched against the links of the images to drop.
+	Images string
+	// Amenities is a regular expression matched against the amenities to drop.
+	Amenities string
+}
+
+// Kind is what a suppression removed.
+type Kind string
+
+const (
+	// Hotel is a hotel hidden from the results.
+	Hotel Kind = "hotel"
+	// Image is an image dropped from a hotel.
+	Image Kind = "image"
+	// Amenity is an amenity dropped from a hotel.
+	Amenity Kind = "amenity"
+)
+
+// Suppression records something removed from the hotels by a rule.
+type Suppression struct {
+	HotelID string `json:"hotel_id"`
+	Kind    Kind   `json:"kind"`
+	// Value is the link of the image or the amenity removed, empty for a hotel.
+	Value string `json:"value,omitempty"`
+	// Rule is the index of the rule in the rule set.
+	Rule   int    `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+// rule is a Rule with its regular expressions compiled.
+type rule struct {
+	Rule
+	name, images, amenities *regexp.Regexp
+}
+
+// RuleSet applies rules to hotels. It is safe for concurrent use.
+type RuleSet struct {
+	rules []rule
+}
+
+// Validate checks the rule, and returns all the problems found joined into a single error.
+// Each problem is prefixed with the field of the rule it is about.
+func (r Rule) Validate() error {
+	_, err := compile(r)
+	return err
+}
+
+// compile checks the rule and compiles its regular expressions.
+func compile(r Rule) (rule, error) {
+	compiled := rule{Rule: r}
+	var errs []error
+	if r.Reason == "" {
+		errs = append(errs, errors.New("reason: must be set"))
+	}
+	for _, pattern := range []struct {
+		key    string
+		value  string
+		target **regexp.Regexp
+	}{
+		{"name", r.Name, &compiled.name},
+		{"images", r.Images, &compiled.images},
+		{"amenities", r.Amenities, &compiled.amenities},
+	} {
+		if pattern.value == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern.value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", pattern.key, err))
+		}
+		*pattern.target = re
+	}
+	// a rule without any condition would hide every hotel
+	if r.Images == "" && r.Amenities == "" && len(r.HotelIDs) == 0 && len(r.Destinations) == 0 && len(r.Suppliers) == 0 && r.Name == "" {
+		errs = append(errs, errors.New("hotel_ids: a rule suppressing hotels needs at least one of hotel_ids, destinations, suppliers or name"))
+	}
+	return compiled, errors.Join(errs...)
+}
+
+// NewRuleSet compiles the rules. The suppressions refer to the rules by their index.
+func NewRuleSet(rules []Rule) (*RuleSet, error) {
+	s := &RuleSet{rules: make([]rule, 0, len(rules))}
+	for i, r := range rules {
+		compiled, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		s.rules = append(s.rules, compiled)
+	}
+	return s, nil
+}
+
+// matches reports whether the hotel is selected by the conditions of the rule.
+func (r rule) matches(hotel entity.Hotel) bool {
+	return (len(r.HotelIDs) == 0 || slices.Contains(r.HotelIDs, hotel.ID)) &&
+		(len(r.Destinations) == 0 || slices.Contains(r.Destinations, hotel.DestinationID)) &&
+		(len(r.Suppliers) == 0 || slices.ContainsFunc(r.Suppliers, func(name string) bool {
+			return slices.Contains(hotel.Provenance.Suppliers, name)
+		})) &&
+		(r.name == nil || r.name.MatchString(hotel.Name))
+}
+
+// Apply returns the hotels without the suppressed hotels, images and amenities, and the suppressions.
+// The hotels passed are not modified, the hotels whose images or amenities are dropped are copies.
+func (s *RuleSet) Apply(hotels []entity.Hotel) ([]entity.Hotel, []Suppression) {
+	var suppressions []Suppression
+	kept := make([]entity.Hotel, 0, len(hotels))
+	for _, hotel := range hotels {
+		hotel, hidden := s.apply(hotel, &suppressions)
+		if !hidden {
+			kept = append(kept, hotel)
+		}
+	}
+	return kept, suppressions
+}
+
+// apply applies the rules to a hotel, in order, and reports whether the hotel is suppressed.
+func (s *RuleSet) apply(hotel entity.Hotel, suppressions *[]Suppression) (entity.Hotel, bool) {
+	cloned := false
+	for i, r := range s.rules {
+		if !r.matches(hotel) {
+			continue
+		}
+		suppress := func(kind Kind, value string) {
+			*suppressions = append(*suppressions, Suppression{HotelID: hotel.ID, Kind: kind, Value: value, Rule: i, Reason: r.Reason})
+		}
+		if r.images == nil && r.amenities == nil {
+			suppress(Hotel, "")
+			return hotel, true
+		}
+		if !cloned {
+			hotel, cloned = hotel.Clone(), true
+		}
+		if r.images != nil {
+			for _, images := range []*[]entity.Image{&hotel.Images.Rooms, &hotel.Images.Site, &hotel.Images.Amenities} {
+				*images = slices.DeleteFunc(*images, func(image entity.Image) bool {
+					if r.images.MatchString(image.Link) {
+						suppress(Image, image.Link)
+						return true
+					}
+					return false
+				})
+			}
+		}
+		if r.amenities != nil {
+			for _, amenities := range []*[]string{&hotel.Amenities.General, &hotel.Amenities.Room} {
+				*amenities = slices.DeleteFunc(*amenities, func(amenity string) bool {
+					if r.amenities.MatchString(amenity) {
+						suppress(Amenity, amenity)
+						return true
+					}
+					return false
+				})
+			}
+		}
+	}
+	return hotel, false
+}
@@ -0,0 +1,147 @@
+package suppress
+
+import (
+	"strings"
+	"testing"
+
+	"merge-hotel/entity"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+// testHotels are the merged hotels that the rules are applied to.
+func testHotels() []entity.Hotel {
+	return []entity.Hotel{
+		{
+			ID:            "iJhz",
+			DestinationID: 5432,
+			Name:          "Beach Villas",
+			Amenities:     entity.Amenities{General: []string{"pool", "wifi"}, Room: []string{"tv", "WiFi"}},
+			Images: entity.Images{
+				Rooms: []entity.Image{{Link: "https://img.example/1.jpg"}, {Link: "https://broken.example/2.jpg"}},
+				Site:  []entity.Image{{Link: "https://broken.example/3.jpg"}},
+			},
+			Provenance: entity.Provenance{Suppliers: []string{"Acme", "Patagonia"}},
+		},
+		{ID: "SjyX", DestinationID: 5432, Name: "InterContinental (closed)", Provenance: entity.Provenance{Suppliers: []string{"Acme"}}},
+		{ID: "f8c9", DestinationID: 1122, Name: "Hilton Tokyo", Provenance: entity.Provenance{Suppliers: []string{"Paperflies"}}},
+	}
+}
+
+func TestApply(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		rules         []Rule
+		expectedIDs   []string
+		expected      []Suppression
+		expectedFirst func(h *entity.Hotel)
+	}{
+		{
+			name:        "no rules",
+			expectedIDs: []string{"iJhz", "SjyX", "f8c9"},
+		},
+		{
+			name:        "hotel IDs",
+			rules:       []Rule{{Reason: "contract", HotelIDs: []string{"f8c9"}}},
+			expectedIDs: []string{"iJhz", "SjyX"},
+			expected:    []Suppression{{HotelID: "f8c9", Kind: Hotel, Reason: "contract"}},
+		},
+		{
+			name:        "destination and name",
+			rules:       []Rule{{Reason: "closed", Destinations: []int{5432}, Name: `(?i)\(closed\)`}},
+			expectedIDs: []string{"iJhz", "f8c9"},
+			expected:    []Suppression{{HotelID: "SjyX", Kind: Hotel, Reason: "closed"}},
+		},
+		{
+			name:        "supplier",
+			rules:       []Rule{{Reason: "fraud", Suppliers: []string{"Paperflies", "Patagonia"}}},
+			expectedIDs: []string{"SjyX"},
+			expected:    []Suppression{{HotelID: "iJhz", Kind: Hotel, Reason: "fraud"}, {HotelID: "f8c9", Kind: Hotel, Reason: "fraud"}},
+		},
+		{
+			name:        "images",
+			rules:       []Rule{{Reason: "broken", Images: `^https://broken\.example/`}},
+			expectedIDs: []string{"iJhz", "SjyX", "f8c9"},
+			expected: []Suppression{
+				{HotelID: "iJhz", Kind: Image, Value: "https://broken.example/2.jpg", Reason: "broken"},
+				{HotelID: "iJhz", Kind: Image, Value: "https://broken.example/3.jpg", Reason: "broken"},
+			},
+			expectedFirst: func(h *entity.Hotel) {
+				h.Images.Rooms = []entity.Image{{Link: "https://img.example/1.jpg"}}
+				h.Images.Site = []entity.Image{}
+			},
+		},
+		{
+			name: "amenities after a hotel rule",
+			rules: []Rule{
+				{Reason: "closed", HotelIDs: []string{"SjyX"}},
+				{Reason: "not offered", Amenities: `(?i)^wifi$`},
+			},
+			expectedIDs: []string{"iJhz", "f8c9"},
+			expected: []Suppression{
+				{HotelID: "iJhz", Kind: Amenity, Value: "wifi", Rule: 1, Reason: "not offered"},
+				{HotelID: "iJhz", Kind: Amenity, Value: "WiFi", Rule: 1, Reason: "not offered"},
+				{HotelID: "SjyX", Kind: Hotel, Rule: 0, Reason: "closed"},
+			},
+			expectedFirst: func(h *entity.Hotel) {
+				h.Amenities = entity.Amenities{General: []string{"pool"}, Room: []string{"tv"}}
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := NewRuleSet(tc.rules)
+			testutil.Ok(t, err)
+			hotels, suppressed := s.Apply(testHotels())
+
+			var ids []string
+			for _, hotel := range hotels {
+				ids = append(ids, hotel.ID)
+			}
+			testutil.Equals(t, tc.expectedIDs, ids)
+			testutil.Equals(t, tc.expected, suppressed)
+			if tc.expectedFirst != nil {
+				expected := testHotels()[0]
+				tc.expectedFirst(&expected)
+				testutil.Equals(t, expected, hotels[0])
+			}
+		})
+	}
+}
+
+func TestApplyKeepsHotelsIntact(t *testing.T) {
+	s, err := NewRuleSet([]Rule{{Reason: "broken", Images: `broken`, Amenities: `wifi`}})
+	testutil.Ok(t, err)
+	hotels := testHotels()
+	s.Apply(hotels)
+	testutil.Equals(t, testHotels(), hotels)
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		rule     Rule
+		expected []string
+	}{
+		{name: "no reason", rule: Rule{HotelIDs: []string{"a"}}, expected: []string{"reason: must be set"}},
+		{
+			name:     "invalid patterns",
+			rule:     Rule{Reason: "closed", Name: "(", Images: "[a-"},
+			expected: []string{"name: error parsing regexp: missing closing ): `(`", "images: error parsing regexp: missing closing ]: `[a-`"},
+		},
+		{
+			name:     "no condition",
+			rule:     Rule{Reason: "closed"},
+			expected: []string{"hotel_ids: a rule suppressing hotels needs at least one of hotel_ids, destinations, suppliers or name"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.rule.Validate()
+			testutil.NotOk(t, err)
+			testutil.Equals(t, tc.expected, strings.Split(err.Error(), "\n"))
+
+			_, err = NewRuleSet([]Rule{{Reason: "closed", HotelIDs: []string{"a"}}, tc.rule})
+			testutil.NotOk(t, err)
+			testutil.Assert(t, strings.HasPrefix(err.Error(), "rule 1: "), "expected the index of the rule in %v", err)
+		})
+	}
+}
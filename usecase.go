@@ -3,10 +3,21 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"merge-hotel/cache"
+	"merge-hotel/changes"
 	"merge-hotel/entity"
+	"merge-hotel/override"
+	"merge-hotel/supplier"
+	"merge-hotel/suppress"
 
 	"github.com/rs/zerolog/log"
 	"github.com/sourcegraph/conc/pool"
@@ -16,100 +27,479 @@ import (
 type HotelSupplier interface {
 	// FetchHotels returns a slice of Hotels for the given hotelIDs and destinationID.
 	// If you do not want to filter by destinationID, set it to -1.
-	// If both are provided, only hotels for the destinationID are returned.
 	// If neither are provided, all hotels are returned.
-	// If there is no matching hotel, it returns an empty slice.
+	// Only the filters declared by FilterCapable are guaranteed to be applied; the hotels are filtered
+	// again client-side for any other filter.
 	FetchHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error)
 	GetName() string
 }
 
+// FilterCapable is implemented by the suppliers that declare which filters they apply themselves,
+// server-side or while decoding. Suppliers that do not implement it are assumed to return their full catalogue.
+type FilterCapable interface {
+	Capabilities() supplier.Capabilities
+}
+
+// HotelPusher is implemented by the suppliers whose partner pushes its hotels to the service instead of being polled.
+type HotelPusher interface {
+	HotelSupplier
+	// Verify checks the signature of a push.
+	Verify(method, requestURI, timestamp, signature string, body []byte) error
+	// Push decodes the records of a push and stores their hotels, replacing the hotels pushed before with the same IDs.
+	Push(r io.Reader) ([]entity.Hotel, error)
+}
+
+// Cacher is an interface that defines the methods for caching merged hotel data by hotel ID.
 type Cacher interface {
-	Get(key string) (interface{}, bool)
-	Set(key string, value interface{}, ttl time.Duration)
+	// GetMany returns the cached hotels for the given hotelIDs and the hotelIDs that are not cached.
+	GetMany(hotelIDs []string) (map[string]entity.Hotel, []string)
+	// SetMany caches the given hotels, keyed by hotel ID, for the duration of ttl.
+	SetMany(hotels map[string]entity.Hotel, ttl time.Duration)
+	// Items returns a snapshot of the cached hotels.
+	Items() []cache.Item[string, entity.Hotel]
+	// Stats returns the cache statistics.
+	Stats() cache.Stats
+	// Delete removes the hotel with the given ID from the cache and reports whether it was cached.
+	Delete(hotelID string) bool
+	// DeleteFunc removes all the hotels for which del returns true and returns how many were removed.
+	DeleteFunc(del func(hotelID string, hotel entity.Hotel) bool) int
+	// Flush removes all the hotels from the cache.
+	Flush()
+}
+
+// OverrideStore is an interface that defines the methods for managing the manual overrides of the hotel data.
+type OverrideStore interface {
+	// List returns the overrides of a hotel, or all the overrides if hotelID is empty.
+	List(hotelID string) []override.Override
+	// Add validates and stores an override, and returns it with its ID.
+	Add(o override.Override) (override.Override, error)
+	// Delete removes an override and returns it. It reports whether the override existed.
+	Delete(id string) (override.Override, bool, error)
+	// Apply returns a copy of the hotel with its overrides applied.
+	Apply(hotel entity.Hotel) entity.Hotel
+}
+
+// SearchResult is the result of a hotel search.
+type SearchResult struct {
+	Hotels []entity.Hotel
+	// Missing are the suppliers whose hotels may be missing from the result, because they failed or did not
+	// answer within the latency budget, sorted by name. The result is partial if there is any.
+	Missing []MissingSupplier
+	// Suppressed are the hotels, images and amenities removed from the result by the suppression rules.
+	Suppressed []suppress.Suppression
+}
+
+// Partial reports whether some suppliers are missing from the result.
+func (r SearchResult) Partial() bool {
+	return len(r.Missing) > 0
+}
+
+// MissingSupplier is a supplier that did not contribute to a search result.
+type MissingSupplier struct {
+	Name string
+	Err  error
+}
+
+// TimedOut reports whether the supplier was abandoned because it exceeded a latency budget.
+func (m MissingSupplier) TimedOut() bool {
+	return errors.Is(m.Err, context.DeadlineExceeded)
 }
 
 // UsecaseImpl is a concrete implementation of the Usecase interface.
 type UsecaseImpl struct {
-	supplierRegistry map[string]HotelSupplier
+	supplierRegistry atomic.Pointer[SupplierRegistry]
+	registryMu       sync.Mutex // serialises the replacement of the supplier registry
 	cache            Cacher
+	cacheTTL         time.Duration
+	latencyBudget    time.Duration
+	overrides        OverrideStore
+	suppression      *suppress.RuleSet
+	changeLog        *changes.Log
 }
 
-// NewUsecaseImpl creates a new instance of the UsecaseImpl struct with the given supplierRegistry.
-func NewUsecaseImpl(supplierRegistry map[string]HotelSupplier, cache Cacher) *UsecaseImpl {
-	return &UsecaseImpl{
-		supplierRegistry: supplierRegistry,
-		cache:            cache,
+// changeLogSize is the number of recent hotel changes kept for the clients following them.
+const changeLogSize = 10000
+
+// defaultCacheTTL is how long the merged hotels are kept in the cache if the options do not say.
+const defaultCacheTTL = time.Minute
+
+// UsecaseOptions configures a UsecaseImpl.
+type UsecaseOptions struct {
+	// CacheTTL is how long the merged hotels are kept in the cache. Zero means defaultCacheTTL, so that the hotels
+	// always expire.
+	CacheTTL time.Duration
+	// LatencyBudget is how long the suppliers are waited for, before they are abandoned. Zero means that all the
+	// suppliers are waited for.
+	LatencyBudget time.Duration
+	// Overrides are applied to the merged hotels. Nil means that they are kept in memory only.
+	Overrides OverrideStore
+	// Suppression is applied to every result. Nil means that nothing is suppressed.
+	Suppression *suppress.RuleSet
+}
+
+// NewUsecaseImpl creates a new instance of the UsecaseImpl struct with the given supplierRegistry and cache.
+func NewUsecaseImpl(supplierRegistry map[string]HotelSupplier, cache Cacher, opts UsecaseOptions) *UsecaseImpl {
+	u := &UsecaseImpl{
+		cache:         cache,
+		cacheTTL:      opts.CacheTTL,
+		latencyBudget: opts.LatencyBudget,
+		overrides:     opts.Overrides,
+		suppression:   opts.Suppression,
+		changeLog:     changes.NewLog(changeLogSize),
 	}
+	if u.cacheTTL <= 0 {
+		u.cacheTTL = defaultCacheTTL
+	}
+	if u.overrides == nil {
+		// a store without a file cannot fail to be created
+		u.overrides, _ = override.NewStore("")
+	}
+	u.supplierRegistry.Store(NewSupplierRegistry(supplierRegistry))
+	return u
 }
 
-func (u *UsecaseImpl) GetHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error) {
+// Suppliers returns the suppliers currently in use, keyed by supplier name.
+func (u *UsecaseImpl) Suppliers() map[string]HotelSupplier {
+	return u.supplierRegistry.Load().Suppliers()
+}
+
+// ReplaceSuppliers atomically swaps the supplier registry. Requests that start after the swap only use the new suppliers.
+// Suppliers that are removed or replaced by a new instance are drained in the background:
+// their in-flight fetches are allowed to complete, and the returned channel is closed once they have.
+func (u *UsecaseImpl) ReplaceSuppliers(supplierRegistry map[string]HotelSupplier) <-chan struct{} {
+	u.registryMu.Lock()
+	next, replaced := u.supplierRegistry.Load().replacedBy(supplierRegistry)
+	u.supplierRegistry.Store(next)
+	u.registryMu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for _, s := range replaced {
+			s.drain()
+			log.Debug().Str("supplier", s.GetName()).Msg("Drained removed supplier")
+		}
+	}()
+	return drained
+}
+
+func (u *UsecaseImpl) GetHotels(ctx context.Context, hotelIDs []string, destinationID int) (SearchResult, error) {
 	// optimisation: we can use cache to store the results of the previous call
 	// in this demo, we use the cache when user provides only hotelIDs
 	// for each hotelID, we need to determine the cache key
 	// we can use the hotelID as the key
 	var cachedHotels []entity.Hotel
-	remainingHotelIDs := make([]string, 0, len(hotelIDs))
+	remainingHotelIDs := hotelIDs
 	if len(hotelIDs) > 0 && destinationID < 0 {
 		// if destinationID is not provided, we can use the hotelID as the cache key
+		// any hotelID that is not cached is added to the remaining hotelIDs
+		var found map[string]entity.Hotel
+		found, remainingHotelIDs = u.cache.GetMany(hotelIDs)
 		for _, hotelID := range hotelIDs {
-			cachedHotel, err := u.getHotelFromCache(hotelIDs[0])
-			if err != nil {
-				// if there is error getting data from cache, we add the id to the remaining hotelIDs
-				remainingHotelIDs = append(remainingHotelIDs, hotelID)
-				continue
+			if cachedHotel, ok := found[hotelID]; ok {
+				cachedHotels = append(cachedHotels, cachedHotel)
 			}
-			cachedHotels = append(cachedHotels, cachedHotel)
 		}
-	} else {
-		// if not using cache, add all hotelIDs to the remaining hotelIDs
-		remainingHotelIDs = hotelIDs
 	}
 
 	if len(remainingHotelIDs) == 0 && len(hotelIDs) > 0 {
 		// if there are no remaining hotelIDs, we can return the list of hotels immediately
-		return cachedHotels, nil
+		return u.suppress(SearchResult{Hotels: cachedHotels}), nil
+	}
+
+	// the suppliers that have not answered within the latency budget are abandoned
+	if u.latencyBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.latencyBudget)
+		defer cancel()
 	}
 
 	// concurrently fetch data from all suppliers
-	p := pool.NewWithResults[[]entity.Hotel]()
-	for _, supplier := range u.supplierRegistry {
+	p := pool.NewWithResults[supplierResult]()
+	for _, supplier := range u.supplierRegistry.Load().suppliers {
 		supplier := supplier // capture the loop variable
-		p.Go(func() []entity.Hotel {
+		if !supplier.acquire() {
+			// the supplier was removed from the registry after this request started
+			continue
+		}
+		p.Go(func() supplierResult {
 			logger := log.With().Str("supplier", supplier.GetName()).Logger()
 			logger.Debug().Msgf("Fetching hotels from supplier %s", supplier.GetName())
-			supplierHotels, err := supplier.FetchHotels(ctx, remainingHotelIDs, destinationID)
+			supplierHotels, err := fetchWithin(ctx, supplier, remainingHotelIDs, destinationID)
 			if err != nil {
-				// if there is any error when fetching hotels from a supplier, we log it and return an empty slice
+				// if there is any error when fetching hotels from a supplier, we log it and report the supplier as missing
 				// we do not return an error here because we want to continue fetching hotels from other suppliers
 				logger.Error().Err(err).Msgf("Failed to fetch hotels from supplier %s", supplier.GetName())
-				return []entity.Hotel{}
+				return supplierResult{name: supplier.GetName(), err: err}
 			}
+			supplierHotels = filterUnsupported(supplier.HotelSupplier, supplierHotels, remainingHotelIDs, destinationID)
 
-			// clean the hotel data before returning it
-			// doing this in service layer so that all the suppliers can use the same cleaner
-			return cleanHotelData(supplierHotels)
+			return supplierResult{name: supplier.GetName(), hotels: prepareSupplierHotels(supplier.GetName(), supplierHotels)}
 		})
 	}
 	results := p.Wait()
+	// merge in a stable order, as the descriptions and lists are concatenated in the order of the suppliers,
+	// so that merging the same data twice gives the same hotels and is not reported as a change
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].name < results[j].name
+	})
 
 	// flatten the results into a single slice
 	var allHotels []entity.Hotel
-	for _, supplierHotels := range results {
-		allHotels = append(allHotels, supplierHotels...)
+	var missing []MissingSupplier
+	for _, result := range results {
+		if result.err != nil {
+			missing = append(missing, MissingSupplier{Name: result.name, Err: result.err})
+			continue
+		}
+		allHotels = append(allHotels, result.hotels...)
 	}
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].Name < missing[j].Name
+	})
 
 	// uniquely merge the data from all suppliers and return the final list
 	mergedHotels := mergeHotelData(allHotels)
+	// the manual overrides take precedence over the data of every supplier, and are cached with the hotels
+	for i, hotel := range mergedHotels {
+		mergedHotels[i] = u.overrides.Apply(hotel)
+	}
 
-	// set the cache for the retrieved hotels
-	for _, hotel := range mergedHotels {
-		u.cache.Set(hotel.ID, hotel, time.Minute)
+	// record how the merged hotels changed since the previous merge; the hotels of a partial result
+	// may be missing because of a failed supplier, so they are not recorded as removed
+	// the changes are those of the hotels as they are served, so that the suppressed hotels are not disclosed
+	served := mergedHotels
+	if u.suppression != nil {
+		served, _ = u.suppression.Apply(mergedHotels)
+	}
+	u.changeLog.Record(served, remainingHotelIDs, destinationID, len(missing) == 0)
+
+	// set the cache for the retrieved hotels; the hotels of a partial result lack the data of the missing suppliers,
+	// so they are not cached, and the next search fetches them again instead of serving them as complete
+	if len(missing) == 0 {
+		hotelsToCache := make(map[string]entity.Hotel, len(mergedHotels))
+		for _, hotel := range mergedHotels {
+			hotelsToCache[hotel.ID] = hotel
+		}
+		u.cache.SetMany(hotelsToCache, u.cacheTTL)
 	}
 
 	// concatenate the mergedHotels with the cachedHotels, if any
 	mergedHotels = append(mergedHotels, cachedHotels...)
 
-	return mergedHotels, nil
+	return u.suppress(SearchResult{Hotels: mergedHotels, Missing: missing}), nil
+}
+
+// suppress applies the suppression rules to the hotels of the result. The hotels are cached before the rules
+// are applied, so that the suppressions are reported whether the hotels come from the cache or the suppliers.
+func (u *UsecaseImpl) suppress(result SearchResult) SearchResult {
+	if u.suppression != nil {
+		result.Hotels, result.Suppressed = u.suppression.Apply(result.Hotels)
+	}
+	return result
+}
+
+// supplierResult is the outcome of the fetch from a supplier.
+type supplierResult struct {
+	name   string
+	hotels []entity.Hotel
+	err    error
+}
+
+// fetchWithin fetches the hotels from the supplier, returning when the context is done even if the supplier
+// has not returned yet. The abandoned fetch keeps running in the background until the supplier returns,
+// and only then is released, so that draining the supplier waits for it.
+func fetchWithin(ctx context.Context, s *registeredSupplier, hotelIDs []string, destinationID int) ([]entity.Hotel, error) {
+	done := make(chan supplierResult, 1)
+	go func() {
+		defer s.release()
+		hotels, err := s.FetchHotels(ctx, hotelIDs, destinationID)
+		done <- supplierResult{hotels: hotels, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.hotels, result.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("abandoned: %w", ctx.Err())
+	}
+}
+
+// Pusher returns the supplier of the given name if its partner pushes its hotels.
+func (u *UsecaseImpl) Pusher(supplierName string) (HotelPusher, bool) {
+	pusher, ok := u.supplierRegistry.Load().Suppliers()[supplierName].(HotelPusher)
+	return pusher, ok
+}
+
+// Ingest stores the hotels pushed to a supplier, and updates the cache without fetching from the other suppliers,
+// so that the pushes of a partner do not turn into load on every supplier. A cached hotel that the supplier did not
+// contribute to yet is merged with the pushed hotel. A cached hotel that holds the data pushed before is evicted
+// instead, as that data cannot be told apart from the data of the other suppliers, and it is merged again on the
+// next search, like the pushed hotels that are not cached. It returns the sorted IDs of the pushed hotels.
+func (u *UsecaseImpl) Ingest(pusher HotelPusher, body io.Reader) ([]string, error) {
+	hotels, err := pusher.Push(body)
+	if err != nil {
+		return nil, err
+	}
+	// a hotel pushed twice in a batch replaces the first one, as in the store of the supplier
+	pushed := make(map[string]entity.Hotel, len(hotels))
+	for _, hotel := range prepareSupplierHotels(pusher.GetName(), hotels) {
+		pushed[hotel.ID] = hotel
+	}
+	hotelIDs := make([]string, 0, len(pushed))
+	for hotelID := range pushed {
+		hotelIDs = append(hotelIDs, hotelID)
+	}
+	sort.Strings(hotelIDs)
+
+	cached, _ := u.cache.GetMany(hotelIDs)
+	merged := make(map[string]entity.Hotel, len(cached))
+	for hotelID, hotel := range cached {
+		if slices.Contains(hotel.Provenance.Suppliers, pusher.GetName()) {
+			u.cache.Delete(hotelID)
+			continue
+		}
+		hotel = entity.MergeHotelData(hotel.Clone(), pushed[hotelID])
+		// the overrides take precedence over the pushed data, so they are applied again
+		hotel.Provenance.Overrides = nil
+		merged[hotelID] = u.overrides.Apply(hotel)
+	}
+	if len(merged) == 0 {
+		return hotelIDs, nil
+	}
+
+	served := make([]entity.Hotel, 0, len(merged))
+	for _, hotel := range merged {
+		served = append(served, hotel)
+	}
+	if u.suppression != nil {
+		served, _ = u.suppression.Apply(served)
+	}
+	u.changeLog.Record(served, hotelIDs, -1, false)
+	u.cache.SetMany(merged, u.cacheTTL)
+	return hotelIDs, nil
+}
+
+// Changes returns the log of the changes of the merged hotels.
+func (u *UsecaseImpl) Changes() *changes.Log {
+	return u.changeLog
+}
+
+// CachedHotels returns a snapshot of the hotels in the cache and the cache statistics.
+func (u *UsecaseImpl) CachedHotels() ([]cache.Item[string, entity.Hotel], cache.Stats) {
+	return u.cache.Items(), u.cache.Stats()
+}
+
+// EvictHotel removes a hotel from the cache. It reports whether the hotel was cached.
+func (u *UsecaseImpl) EvictHotel(hotelID string) bool {
+	return u.cache.Delete(hotelID)
+}
+
+// EvictDestination removes all the hotels of a destination from the cache and returns how many were removed.
+func (u *UsecaseImpl) EvictDestination(destinationID int) int {
+	return u.cache.DeleteFunc(func(_ string, hotel entity.Hotel) bool {
+		return hotel.DestinationID == destinationID
+	})
+}
+
+// EvictSupplier removes all the hotels that a supplier contributed to from the cache and returns how many were removed.
+func (u *UsecaseImpl) EvictSupplier(supplierName string) int {
+	return u.cache.DeleteFunc(func(_ string, hotel entity.Hotel) bool {
+		return slices.Contains(hotel.Provenance.Suppliers, supplierName)
+	})
+}
+
+// FlushCache removes all the hotels from the cache.
+func (u *UsecaseImpl) FlushCache() {
+	u.cache.Flush()
+}
+
+// Overrides returns the overrides of a hotel, or all the overrides if hotelID is empty.
+func (u *UsecaseImpl) Overrides(hotelID string) []override.Override {
+	return u.overrides.List(hotelID)
+}
+
+// AddOverride stores an override and evicts its hotel from the cache, so that the next search applies it.
+func (u *UsecaseImpl) AddOverride(o override.Override) (override.Override, error) {
+	added, err := u.overrides.Add(o)
+	if err != nil {
+		return added, err
+	}
+	u.cache.Delete(added.HotelID)
+	return added, nil
+}
+
+// DeleteOverride removes an override and evicts its hotel from the cache. It reports whether the override existed.
+func (u *UsecaseImpl) DeleteOverride(id string) (bool, error) {
+	deleted, ok, err := u.overrides.Delete(id)
+	if ok {
+		u.cache.Delete(deleted.HotelID)
+	}
+	return ok, err
+}
+
+// WarmUp pre-populates the cache by fetching all the hotels known to the suppliers.
+// It returns the number of hotels cached.
+func (u *UsecaseImpl) WarmUp(ctx context.Context) (int, error) {
+	result, err := u.GetHotels(ctx, nil, -1)
+	if err != nil {
+		return 0, err
+	}
+	return len(result.Hotels), nil
+}
+
+// prepareSupplierHotels records which supplier the hotel data came from and cleans it, so that it is ready to be merged.
+func prepareSupplierHotels(supplierName string, hotels []entity.Hotel) []entity.Hotel {
+	fetchedAt := time.Now()
+	for i := range hotels {
+		hotels[i].Provenance.Suppliers = []string{supplierName}
+		// the suppliers that do not know when their data was modified are assumed to have just modified it
+		if hotels[i].Provenance.ModifiedAt.IsZero() {
+			hotels[i].Provenance.ModifiedAt = fetchedAt
+		}
+	}
+
+	// clean the hotel data before returning it
+	// doing this in service layer so that all the suppliers can use the same cleaner
+	return cleanHotelData(hotels)
+}
+
+// filterUnsupported applies the filters that the supplier does not apply itself.
+func filterUnsupported(s HotelSupplier, hotels []entity.Hotel, hotelIDs []string, destinationID int) []entity.Hotel {
+	var capabilities supplier.Capabilities
+	if capable, ok := s.(FilterCapable); ok {
+		capabilities = capable.Capabilities()
+	}
+	if capabilities.HotelIDs {
+		hotelIDs = nil
+	}
+	if capabilities.Destination {
+		destinationID = -1
+	}
+	return filterHotels(hotels, hotelIDs, destinationID)
+}
+
+// filterHotels returns the hotels that match the hotelIDs and destinationID.
+// An empty hotelIDs or a negative destinationID does not filter.
+func filterHotels(hotels []entity.Hotel, hotelIDs []string, destinationID int) []entity.Hotel {
+	if len(hotelIDs) == 0 && destinationID < 0 {
+		return hotels
+	}
+
+	hotelIDSet := make(map[string]bool, len(hotelIDs)) // create a map for quick lookup of HotelIDs
+	for _, id := range hotelIDs {
+		hotelIDSet[id] = true
+	}
+
+	filteredHotels := make([]entity.Hotel, 0, len(hotels))
+	for _, hotel := range hotels {
+		shouldIncludeDestination := (destinationID < 0) || hotel.DestinationID == destinationID
+		shouldIncludeHotel := (len(hotelIDs) == 0) || hotelIDSet[hotel.ID]
+		if shouldIncludeDestination && shouldIncludeHotel {
+			filteredHotels = append(filteredHotels, hotel)
+		}
+	}
+	return filteredHotels
 }
 
 // cleanHotelData performs some basic cleaning on the hotel data before returning it to the caller.
@@ -158,24 +548,3 @@ func mergeHotelData(hotels []entity.Hotel) []entity.Hotel {
 
 	return finalHotels
 }
-
-// getHotelFromCache returns the hotel data from the cache if it exists.
-// If the hotel data is not found in the cache, returns error.
-func (u *UsecaseImpl) getHotelFromCache(hotelID string) (entity.Hotel, error) {
-	// check if the hotelID is already in the cache
-	data, found := u.cache.Get(hotelID)
-	if !found {
-		// if not found, we return an error
-		return entity.Hotel{}, errors.New("hotel data not found in cache")
-	}
-
-	// if found, we can directly return the data
-	cachedHotel, ok := data.(entity.Hotel)
-	if !ok {
-		// if the data is not a hotel, we return an error and log an error
-		log.Error().Str("hotelID", hotelID).Msg("Cache data is not a hotel")
-		return entity.Hotel{}, errors.New("cache data is not a hotel")
-	}
-
-	return cachedHotel, nil
-}
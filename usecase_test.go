@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"merge-hotel/changes"
+	"merge-hotel/entity"
+	"merge-hotel/fixture"
+	"merge-hotel/override"
+	"merge-hotel/supplier"
+	"merge-hotel/suppress"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+// fixturesMode is the fixture mode of the end-to-end tests. Run `go test -fixtures=record` to re-record the fixtures
+// from the live supplier APIs.
+var fixturesMode = flag.String("fixtures", string(fixture.Replay), "fixture mode of the end-to-end tests: replay, record or off")
+
+// fixtureSetup customises the usecase created by newFixtureUsecase.
+type fixtureSetup struct {
+	// config changes the configuration before the suppliers are created from it.
+	config func(cfg *Config)
+	// suppliers changes the suppliers created from the configuration.
+	suppliers func(suppliers map[string]HotelSupplier)
+	// opts are the options of the usecase. The cache TTL and latency budget are taken from the configuration.
+	opts UsecaseOptions
+}
+
+// newFixtureUsecase creates a usecase with the suppliers of config.yaml, served from the fixtures in testdata/fixtures.
+// The environment is not applied to the configuration, so that the tests do not depend on it.
+func newFixtureUsecase(t *testing.T, setups ...fixtureSetup) *UsecaseImpl {
+	t.Helper()
+	data, err := os.ReadFile("config.yaml")
+	testutil.Ok(t, err)
+	cfg, err := parseConfig(data)
+	testutil.Ok(t, err)
+	cfg.Fixtures = FixturesConfig{Mode: *fixturesMode, Dir: "testdata/fixtures"}
+	var setup fixtureSetup
+	if len(setups) > 0 {
+		setup = setups[0]
+	}
+	if setup.config != nil {
+		setup.config(cfg)
+	}
+	applySupplierDefaults(cfg)
+	testutil.Ok(t, cfg.Validate())
+
+	suppliers := setupSupplierRegistry(cfg)
+	if setup.suppliers != nil {
+		setup.suppliers(suppliers)
+	}
+	opts := setup.opts
+	opts.CacheTTL, opts.LatencyBudget = cfg.Cache.TTL, cfg.Server.LatencyBudget
+	return NewUsecaseImpl(suppliers, newHotelCache(cfg.Cache), opts)
+}
+
+// sortedHotelIDs returns the IDs of the hotels in order, as the merged hotels are not sorted.
+func sortedHotelIDs(hotels []entity.Hotel) []string {
+	var ids []string
+	for _, hotel := range hotels {
+		ids = append(ids, hotel.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestUsecaseGetHotelsFromFixtures(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		hotelIDs      []string
+		destinationID int
+		expected      []string
+	}{
+		{name: "all hotels", destinationID: -1, expected: []string{"SjyX", "f8c9", "iJhz"}},
+		{name: "by destination", destinationID: 5432, expected: []string{"SjyX", "iJhz"}},
+		{name: "by hotel IDs", hotelIDs: []string{"iJhz", "f8c9"}, destinationID: -1, expected: []string{"f8c9", "iJhz"}},
+		{name: "unknown destination", destinationID: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := newFixtureUsecase(t).GetHotels(context.Background(), tc.hotelIDs, tc.destinationID)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expected, sortedHotelIDs(result.Hotels))
+			testutil.Assert(t, !result.Partial(), "unexpected missing suppliers %v", result.Missing)
+		})
+	}
+}
+
+func TestUsecaseGetHotelsMergesSuppliers(t *testing.T) {
+	result, err := newFixtureUsecase(t).GetHotels(context.Background(), []string{"iJhz"}, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(result.Hotels))
+
+	hotel := result.Hotels[0]
+	testutil.Equals(t, "Beach Villas Singapore", hotel.Name)
+	testutil.Equals(t, 5432, hotel.DestinationID)
+	testutil.Equals(t, "8 Sentosa Gateway, Beach Villas, 098269", hotel.Location.Address)
+	testutil.Equals(t, "Singapore", hotel.Location.Country)
+	testutil.Equals(t, 3, len(hotel.Images.Rooms))
+	testutil.Equals(t, 3, len(hotel.BookingConditions))
+	sort.Strings(hotel.Provenance.Suppliers)
+	testutil.Equals(t, []string{"Acme", "Paperflies", "Patagonia"}, hotel.Provenance.Suppliers)
+}
+
+func TestUsecaseGetHotelsUsesCache(t *testing.T) {
+	usecase := newFixtureUsecase(t)
+	_, err := usecase.GetHotels(context.Background(), nil, -1)
+	testutil.Ok(t, err)
+
+	result, err := usecase.GetHotels(context.Background(), []string{"iJhz", "SjyX"}, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"SjyX", "iJhz"}, sortedHotelIDs(result.Hotels))
+
+	_, stats := usecase.CachedHotels()
+	testutil.Equals(t, uint64(2), stats.Hits)
+	testutil.Equals(t, uint64(0), stats.Misses)
+	testutil.Equals(t, 3, stats.Entries)
+}
+
+func TestUsecaseCachedHotelsExpireByDefault(t *testing.T) {
+	usecase := newFixtureUsecase(t, fixtureSetup{config: func(cfg *Config) {
+		cfg.Cache.TTL = 0
+	}})
+	_, err := usecase.GetHotels(context.Background(), []string{"iJhz"}, -1)
+	testutil.Ok(t, err)
+
+	items, _ := usecase.CachedHotels()
+	testutil.Equals(t, 1, len(items))
+	testutil.Equals(t, defaultCacheTTL, items[0].ExpiresAt.Sub(items[0].CreatedAt))
+}
+
+func TestUsecaseGetHotelsWithFaultySupplier(t *testing.T) {
+	usecase := newFixtureUsecase(t, fixtureSetup{config: func(cfg *Config) {
+		acme := cfg.Suppliers["Acme"]
+		acme.Faults = FaultsConfig{Seed: 1, ErrorRate: 1}
+		cfg.Suppliers["Acme"] = acme
+	}})
+
+	// the failing supplier is skipped and the hotels are merged from the others
+	result, err := usecase.GetHotels(context.Background(), []string{"iJhz"}, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(result.Hotels))
+	sort.Strings(result.Hotels[0].Provenance.Suppliers)
+	testutil.Equals(t, []string{"Paperflies", "Patagonia"}, result.Hotels[0].Provenance.Suppliers)
+	testutil.Equals(t, 1, len(result.Missing))
+	testutil.Equals(t, "Acme", result.Missing[0].Name)
+	testutil.Assert(t, !result.Missing[0].TimedOut(), "expected a failure, got %v", result.Missing[0].Err)
+}
+
+func TestUsecaseGetHotelsWithinLatencyBudget(t *testing.T) {
+	usecase := newFixtureUsecase(t, fixtureSetup{config: func(cfg *Config) {
+		cfg.Server.LatencyBudget = 100 * time.Millisecond
+		acme := cfg.Suppliers["Acme"]
+		acme.Faults = FaultsConfig{Latency: time.Minute}
+		cfg.Suppliers["Acme"] = acme
+		patagonia := cfg.Suppliers["Patagonia"]
+		patagonia.Faults = FaultsConfig{Latency: time.Minute}
+		patagonia.Budget = 10 * time.Millisecond
+		cfg.Suppliers["Patagonia"] = patagonia
+	}})
+
+	// the slow suppliers are abandoned, by the budget of the server or their own, and reported as missing
+	start := time.Now()
+	result, err := usecase.GetHotels(context.Background(), []string{"iJhz"}, -1)
+	testutil.Ok(t, err)
+	testutil.Assert(t, time.Since(start) < time.Second, "expected the search to be bounded, took %v", time.Since(start))
+	testutil.Equals(t, 1, len(result.Hotels))
+	testutil.Equals(t, []string{"Paperflies"}, result.Hotels[0].Provenance.Suppliers)
+	testutil.Equals(t, 2, len(result.Missing))
+	for i, name := range []string{"Acme", "Patagonia"} {
+		testutil.Equals(t, name, result.Missing[i].Name)
+		testutil.Assert(t, result.Missing[i].TimedOut(), "expected %s to time out, got %v", name, result.Missing[i].Err)
+	}
+}
+
+func TestUsecaseGetHotelsDoesNotCachePartialResults(t *testing.T) {
+	usecase := newFixtureUsecase(t, fixtureSetup{config: func(cfg *Config) {
+		cfg.Server.LatencyBudget = 50 * time.Millisecond
+		acme := cfg.Suppliers["Acme"]
+		acme.Faults = FaultsConfig{Latency: time.Minute}
+		cfg.Suppliers["Acme"] = acme
+	}})
+
+	// the hotels merged without the abandoned supplier are fetched again, and reported as partial again
+	for i := 0; i < 2; i++ {
+		result, err := usecase.GetHotels(context.Background(), []string{"iJhz"}, -1)
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"iJhz"}, sortedHotelIDs(result.Hotels))
+		testutil.Equals(t, 1, len(result.Missing))
+		testutil.Equals(t, "Acme", result.Missing[0].Name)
+	}
+	_, stats := usecase.CachedHotels()
+	testutil.Equals(t, 0, stats.Entries)
+	testutil.Equals(t, uint64(0), stats.Hits)
+}
+
+// capableSupplier is a supplier that declares the filters its API applies server-side.
+type capableSupplier struct {
+	HotelSupplier
+	capabilities supplier.Capabilities
+}
+
+func (s capableSupplier) Capabilities() supplier.Capabilities {
+	return s.capabilities
+}
+
+func TestFilterUnsupported(t *testing.T) {
+	hotels := []entity.Hotel{{ID: "a", DestinationID: 1}, {ID: "b", DestinationID: 2}}
+	for _, tc := range []struct {
+		name         string
+		capabilities supplier.Capabilities
+		expected     []string
+	}{
+		{name: "no capabilities", expected: []string{"a"}},
+		{name: "hotel IDs applied server-side", capabilities: supplier.Capabilities{HotelIDs: true}, expected: []string{"a"}},
+		{name: "destination applied server-side", capabilities: supplier.Capabilities{Destination: true}, expected: []string{"a", "b"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := capableSupplier{capabilities: tc.capabilities}
+			testutil.Equals(t, tc.expected, sortedHotelIDs(filterUnsupported(s, hotels, []string{"a", "b"}, 1)))
+		})
+	}
+}
+
+func TestUsecaseGetHotelsWithLocalSupplier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "curated.ndjson")
+	testutil.Ok(t, os.WriteFile(path, []byte(`{"Id": "iJhz", "DestinationId": 5432, "Facilities": ["Rooftop bar"]}
+{"Id": "curated1", "DestinationId": 5432, "Name": "Curated Hotel"}
+`), 0o600))
+	usecase := newFixtureUsecase(t, fixtureSetup{config: func(cfg *Config) {
+		cfg.Suppliers["Curated"] = SupplierConfig{Kind: "Acme", Path: path, Timeout: time.Second}
+	}})
+
+	// the curated hotels are merged alongside the live suppliers
+	result, err := usecase.GetHotels(context.Background(), nil, 5432)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"SjyX", "curated1", "iJhz"}, sortedHotelIDs(result.Hotels))
+	for _, hotel := range result.Hotels {
+		switch hotel.ID {
+		case "curated1":
+			testutil.Equals(t, []string{"Curated"}, hotel.Provenance.Suppliers)
+		case "iJhz":
+			testutil.Assert(t, slices.Contains(hotel.Provenance.Suppliers, "Curated"), "expected the curated data in %v", hotel.Provenance.Suppliers)
+			testutil.Assert(t, slices.Contains(hotel.Amenities.General, "rooftop bar"), "expected the curated amenity in %v", hotel.Amenities.General)
+		}
+	}
+}
+
+func TestUsecaseGetHotelsAppliesOverrides(t *testing.T) {
+	usecase := newFixtureUsecase(t)
+	result, err := usecase.GetHotels(context.Background(), []string{"iJhz"}, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "8 Sentosa Gateway, Beach Villas, 098269", result.Hotels[0].Location.Address)
+
+	added, err := usecase.AddOverride(override.Override{
+		HotelID: "iJhz", Field: "location.address", Op: override.Replace, Value: json.RawMessage(`"1 Beach View"`),
+	})
+	testutil.Ok(t, err)
+
+	// the override takes precedence over the suppliers, and the cached hotel is replaced
+	result, err = usecase.GetHotels(context.Background(), []string{"iJhz"}, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "1 Beach View", result.Hotels[0].Location.Address)
+	testutil.Equals(t, []string{added.ID}, result.Hotels[0].Provenance.Overrides)
+	result, err = usecase.GetHotels(context.Background(), []string{"iJhz"}, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "1 Beach View", result.Hotels[0].Location.Address)
+
+	deleted, err := usecase.DeleteOverride(added.ID)
+	testutil.Ok(t, err)
+	testutil.Assert(t, deleted, "expected the override to be deleted")
+	result, err = usecase.GetHotels(context.Background(), []string{"iJhz"}, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "8 Sentosa Gateway, Beach Villas, 098269", result.Hotels[0].Location.Address)
+	testutil.Equals(t, 0, len(result.Hotels[0].Provenance.Overrides))
+}
+
+func TestUsecaseGetHotelsSuppressesHotels(t *testing.T) {
+	rules, err := suppress.NewRuleSet([]suppress.Rule{
+		{Reason: "closed", HotelIDs: []string{"SjyX"}},
+		{Reason: "broken images", HotelIDs: []string{"iJhz"}, Images: `.`},
+	})
+	testutil.Ok(t, err)
+	usecase := newFixtureUsecase(t, fixtureSetup{opts: UsecaseOptions{Suppression: rules}})
+
+	// the suppressions are reported whether the hotels are fetched or cached
+	for _, source := range []string{"suppliers", "cache"} {
+		result, err := usecase.GetHotels(context.Background(), []string{"iJhz", "SjyX"}, -1)
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"iJhz"}, sortedHotelIDs(result.Hotels), source)
+		images := result.Hotels[0].Images
+		testutil.Equals(t, 0, len(images.Rooms)+len(images.Site)+len(images.Amenities), source)
+		// the merged hotels are not sorted, so neither are the suppressions
+		testutil.Assert(t, slices.Contains(result.Suppressed, suppress.Suppression{HotelID: "SjyX", Kind: suppress.Hotel, Rule: 0, Reason: "closed"}),
+			"%s: expected SjyX to be suppressed, got %v", source, result.Suppressed)
+		testutil.Assert(t, len(result.Suppressed) > 1, "%s: expected the images of iJhz to be suppressed", source)
+		for _, s := range result.Suppressed {
+			testutil.Assert(t, s.Kind == suppress.Hotel || s.Kind == suppress.Image && s.HotelID == "iJhz" && s.Reason == "broken images",
+				"%s: unexpected suppression %v", source, s)
+		}
+	}
+
+	// the cached hotels are kept intact
+	cached, _ := usecase.CachedHotels()
+	for _, item := range cached {
+		if item.Key == "iJhz" {
+			testutil.Assert(t, len(item.Value.Images.Rooms) > 0, "expected the cached hotel to keep its images")
+		}
+	}
+}
+
+// countingSupplier counts the fetches of a supplier.
+type countingSupplier struct {
+	HotelSupplier
+	fetches *atomic.Int32
+}
+
+func (s countingSupplier) FetchHotels(ctx context.Context, hotelIDs []string, destinationID int) ([]entity.Hotel, error) {
+	s.fetches.Add(1)
+	return s.HotelSupplier.FetchHotels(ctx, hotelIDs, destinationID)
+}
+
+func TestUsecaseIngestUpdatesCache(t *testing.T) {
+	var fetches atomic.Int32
+	usecase := newFixtureUsecase(t, fixtureSetup{suppliers: func(suppliers map[string]HotelSupplier) {
+		for name, s := range suppliers {
+			suppliers[name] = countingSupplier{HotelSupplier: s, fetches: &fetches}
+		}
+		suppliers["Direct"] = supplier.NewPushed("Direct", "key", supplier.JSONFiles(supplier.DecodePaperfliesHotels))
+	}})
+
+	_, ok := usecase.Pusher("Acme")
+	testutil.Assert(t, !ok, "Acme is polled, not pushed")
+	pusher, ok := usecase.Pusher("Direct")
+	testutil.Assert(t, ok, "expected Direct to accept pushes")
+
+	result, err := usecase.GetHotels(context.Background(), []string{"iJhz", "SjyX"}, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(result.Hotels))
+	cursor := usecase.Changes().Cursor()
+
+	cachedHotels := func() map[string]entity.Hotel {
+		cached := map[string]entity.Hotel{}
+		items, _ := usecase.CachedHotels()
+		for _, item := range items {
+			cached[item.Key] = item.Value
+		}
+		return cached
+	}
+	fetched := fetches.Load()
+	hotelIDs, err := usecase.Ingest(pusher, strings.NewReader(`[
+		{"hotel_id": "iJhz", "destination_id": 5432, "amenities": {"general": ["Rooftop Bar"]}},
+		{"hotel_id": "new1", "destination_id": 5432, "hotel_name": " Direct Hotel "}
+	]`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"iJhz", "new1"}, hotelIDs)
+	testutil.Equals(t, fetched, fetches.Load(), "expected no fetch from the other suppliers")
+
+	// the pushed hotel is merged with the cached hotel, cleaned like the fetched ones
+	cached := cachedHotels()
+	testutil.Assert(t, slices.Contains(cached["iJhz"].Amenities.General, "rooftop bar"), "expected the pushed amenity, got %v", cached["iJhz"].Amenities.General)
+	testutil.Assert(t, slices.Contains(cached["iJhz"].Provenance.Suppliers, "Direct"), "expected Direct in %v", cached["iJhz"].Provenance.Suppliers)
+	testutil.Assert(t, !slices.Contains(cached["SjyX"].Provenance.Suppliers, "Direct"), "expected SjyX to be untouched")
+	events, ok := usecase.Changes().Since(cursor)
+	testutil.Assert(t, ok, "expected the changes to be kept")
+	testutil.Equals(t, 1, len(events))
+	testutil.Equals(t, "iJhz", events[0].HotelID)
+
+	// the hotel that is not cached is merged with the other suppliers on the next search
+	_, found := cached["new1"]
+	testutil.Assert(t, !found, "expected new1 not to be cached")
+	result, err = usecase.GetHotels(context.Background(), []string{"new1"}, -1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "Direct Hotel", result.Hotels[0].Name)
+
+	// the data pushed before cannot be replaced in the merged hotel, so the hotel is evicted
+	fetched = fetches.Load()
+	_, err = usecase.Ingest(pusher, strings.NewReader(`{"hotel_id": "iJhz", "destination_id": 5432}`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, fetched, fetches.Load(), "expected no fetch from the other suppliers")
+	_, found = cachedHotels()["iJhz"]
+	testutil.Assert(t, !found, "expected iJhz to be evicted")
+
+	_, err = usecase.Ingest(pusher, strings.NewReader(`{"hotel_id": `))
+	testutil.NotOk(t, err)
+}
+
+func TestUsecaseGetHotelsRecordsChanges(t *testing.T) {
+	usecase := newFixtureUsecase(t)
+	_, err := usecase.GetHotels(context.Background(), nil, 5432)
+	testutil.Ok(t, err)
+	events, ok := usecase.Changes().Since(0)
+	testutil.Assert(t, ok, "expected the changes to be kept")
+	testutil.Equals(t, 2, len(events))
+	for _, event := range events {
+		testutil.Equals(t, changes.Created, event.Type)
+	}
+
+	// a cached search is not a merge, and a merge of the same data is not a change
+	cursor := usecase.Changes().Cursor()
+	_, err = usecase.GetHotels(context.Background(), []string{"iJhz"}, -1)
+	testutil.Ok(t, err)
+	_, err = usecase.GetHotels(context.Background(), nil, 5432)
+	testutil.Ok(t, err)
+	testutil.Equals(t, cursor, usecase.Changes().Cursor())
+
+	_, err = usecase.AddOverride(override.Override{HotelID: "iJhz", Field: "location.city", Op: override.Replace, Value: json.RawMessage(`"Sentosa"`)})
+	testutil.Ok(t, err)
+	_, err = usecase.GetHotels(context.Background(), []string{"iJhz"}, -1)
+	testutil.Ok(t, err)
+	events, ok = usecase.Changes().Since(cursor)
+	testutil.Assert(t, ok, "expected the changes to be kept")
+	testutil.Equals(t, 1, len(events))
+	testutil.Equals(t, changes.Updated, events[0].Type)
+	testutil.Equals(t, "iJhz", events[0].HotelID)
+	testutil.Equals(t, []string{"location.city"}, events[0].Fields)
+}
+
+func TestUsecaseGetHotelsDoesNotRecordSuppressedHotels(t *testing.T) {
+	rules, err := suppress.NewRuleSet([]suppress.Rule{
+		{Reason: "closed", HotelIDs: []string{"SjyX"}},
+		{Reason: "broken images", HotelIDs: []string{"iJhz"}, Images: `.`},
+	})
+	testutil.Ok(t, err)
+	usecase := newFixtureUsecase(t, fixtureSetup{opts: UsecaseOptions{Suppression: rules}})
+
+	// the suppressed hotel is not disclosed by the changes
+	_, err = usecase.GetHotels(context.Background(), nil, 5432)
+	testutil.Ok(t, err)
+	events, ok := usecase.Changes().Since(0)
+	testutil.Assert(t, ok, "expected the changes to be kept")
+	testutil.Equals(t, 1, len(events))
+	testutil.Equals(t, changes.Created, events[0].Type)
+	testutil.Equals(t, "iJhz", events[0].HotelID)
+
+	// the dropped images are not changes either, as the served hotel does not have them
+	cursor := usecase.Changes().Cursor()
+	_, err = usecase.AddOverride(override.Override{
+		HotelID: "iJhz", Field: "images.site", Op: override.Add, Value: json.RawMessage(`{"link": "https://img.example/1.jpg"}`),
+	})
+	testutil.Ok(t, err)
+	_, err = usecase.GetHotels(context.Background(), nil, 5432)
+	testutil.Ok(t, err)
+	testutil.Equals(t, cursor, usecase.Changes().Cursor())
+}